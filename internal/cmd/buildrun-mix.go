@@ -0,0 +1,218 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gonvenience/bunt"
+	"github.com/spf13/cobra"
+
+	"github.com/homeport/build-load/internal/load"
+)
+
+var buildRunMixCmdSettings struct {
+	parallel     int
+	namingCfg    load.NamingConfig
+	scenarioPath string
+
+	// defaults for all workloads of the scenario
+	buildCfg       load.BuildConfig
+	credentialsCfg load.CredentialsConfig
+
+	htmlOutput string
+	csvOutput  string
+}
+
+var buildRunMixCmdLong = `Run a mix of different buildrun types, so-called workloads, in parallel.
+
+The total number of parallel buildruns is split across the workloads
+according to their weights. The results are reported for each workload
+separately and combined. Workload settings that are not configured in
+the scenario file are taken from the respective command line flags.
+
+Example:
+---
+workloads:
+- name: node
+  weight: 6
+  clusterBuildStrategy: buildpacks-v3
+  sourceURL: https://github.com/shipwright-io/sample-nodejs
+  sourceContextDir: source-build
+
+- name: go
+  weight: 3
+  clusterBuildStrategy: kaniko
+  sourceURL: https://github.com/shipwright-io/sample-go
+  sourceContextDir: docker-build
+
+- name: java
+  weight: 1
+  clusterBuildStrategy: buildah
+  sourceURL: https://github.com/shipwright-io/sample-java
+  sourceContextDir: docker-build
+
+`
+
+var buildRunMixCmd = &cobra.Command{
+	Use:           "buildruns-mix",
+	Short:         "Creates buildruns of different types with weights",
+	Long:          buildRunMixCmdLong,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if buildRunMixCmdSettings.parallel < 1 {
+			return fmt.Errorf("the number of parallel buildruns must be at least one")
+		}
+
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		kubeAccess, err := newKubeAccess(cmd)
+		if err != nil {
+			return err
+		}
+
+		// The created credentials are defaults for the workloads, like the
+		// other flags, workloads can still use their own secrets
+		defaults, cleanupCredentials, err := load.ProvisionCredentials(*kubeAccess, buildRunMixCmdSettings.namingCfg, credentialsFromEnv(cmd, buildRunMixCmdSettings.credentialsCfg), buildRunMixCmdSettings.buildCfg)
+		if err != nil {
+			return err
+		}
+
+		defer cleanupCredentials()
+
+		workloads, err := loadWorkloads(buildRunMixCmdSettings.scenarioPath, defaults)
+		if err != nil {
+			return err
+		}
+
+		var buildCfgs = make([]load.BuildConfig, len(workloads))
+		for i, workload := range workloads {
+			buildCfgs[i] = workload.BuildConfig
+		}
+
+		namingCfg, cleanup, err := load.PrepareNamespaces(*kubeAccess, buildRunMixCmdSettings.namingCfg, buildCfgs...)
+		if err != nil {
+			return err
+		}
+
+		defer cleanup()
+
+		// The preflight checks cover the prepared namespaces, including the
+		// ones that were created for the test
+		if err := preflight(load.CheckWorkloads(*kubeAccess, namingCfg, workloads, buildRunMixCmdSettings.parallel)); err != nil {
+			return err
+		}
+
+		fingerprint := printFingerprint(load.CollectFingerprint(*kubeAccess, buildRunMixCmdSettings.namingCfg.Namespace, buildCfgs...))
+
+		observed, err := startObservers(kubeAccess, namingCfg, fingerprint)
+		if err != nil {
+			return err
+		}
+
+		// In case of errors or an interruption, the reports still contain
+		// the results of the buildruns that completed
+		workloadResults, runErr := load.ExecuteMixedBuildRuns(*kubeAccess, namingCfg, workloads, buildRunMixCmdSettings.parallel)
+		observed.stop()
+		if len(workloadResults) == 0 {
+			return runErr
+		}
+
+		var allResults = load.CombinedResults(workloadResults)
+		var options = observed.reportOptions(allResults)
+
+		if err := store(buildRunMixCmdSettings.htmlOutput, func(w io.Writer) error {
+			return load.CreateWorkloadResultsChartJS(workloadResults, w, options...)
+		}); err != nil {
+			return err
+		}
+
+		if err := store(buildRunMixCmdSettings.csvOutput, func(w io.Writer) error {
+			return load.CreateWorkloadResultsCSV(workloadResults, w, options...)
+		}); err != nil {
+			return err
+		}
+
+		for _, workloadResult := range workloadResults {
+			bunt.Printf("\nBuildRuns of workload *%s*\n", workloadResult.Name)
+			fmt.Print(load.CalculateResultSet(workloadResult.Results, "buildrun"))
+		}
+
+		bunt.Printf("\nBuildRuns of *all workloads*\n")
+		fmt.Print(load.CalculateResultSet(allResults, "buildrun"))
+		observed.print(allResults)
+
+		return runErr
+	},
+}
+
+func loadWorkloads(path string, defaults load.BuildConfig) ([]load.Workload, error) {
+	if path == "-" {
+		return load.NewWorkloads(os.Stdin, defaults)
+	}
+
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return load.NewWorkloads(file, defaults)
+}
+
+func init() {
+	rootCmd.AddCommand(buildRunMixCmd)
+
+	buildRunMixCmd.Flags().SortFlags = false
+	buildRunMixCmd.PersistentFlags().SortFlags = false
+
+	buildRunMixCmd.Flags().StringVar(&buildRunMixCmdSettings.scenarioPath, "scenario", "", "scenario file with the workloads, use - to read from standard input")
+	buildRunMixCmd.Flags().IntVar(&buildRunMixCmdSettings.parallel, "parallel", 10, "total number of parallel buildruns across all workloads")
+
+	buildRunMixCmd.Flags().StringVar(&buildRunMixCmdSettings.htmlOutput, "html", "", "filename of the HTML report")
+	buildRunMixCmd.Flags().StringVar(&buildRunMixCmdSettings.csvOutput, "csv", "", "filename of the CSV report")
+
+	_ = cobra.MarkFlagRequired(buildRunMixCmd.Flags(), "scenario")
+
+	applyNamingFlags(buildRunMixCmd, &buildRunMixCmdSettings.namingCfg)
+
+	var buildCfg = &buildRunMixCmdSettings.buildCfg
+	pf := buildRunMixCmd.PersistentFlags()
+	pf.StringVar(&buildCfg.ServiceAccountName, "service-account-name", "generated", "default service account of the workloads, use name 'generated' to generate a new one")
+	pf.StringVar(&buildCfg.SourceContextDir, "source-context", "/", "default directory to be used in the source repository")
+	pf.StringVar(&buildCfg.SourceRevision, "source-revision", "master", "default branch, tag, or commit to be used")
+	pf.StringVar(&buildCfg.SourceDockerfile, "dockerfile", "Dockerfile", "default name of the docker file")
+	pf.BoolVar(&buildCfg.SkipVerifySourceRepository, "skip-verify-repository", false, "skip the verification of the source repositories")
+	pf.StringVar(&buildCfg.OutputImageURL, "output-image-url", "", "default output image URL of the workloads")
+	pf.StringVar(&buildCfg.OutputSecretRef, "output-secret-ref", "", "default secret that contains the access credentials for the output registry")
+	pf.DurationVar(&buildCfg.Timeout, "timeout", time.Duration(0), "default maximum runtime of a build run")
+	pf.BoolVar(&buildCfg.SkipDelete, "skip-delete", false, "skip the clean-up of resources, which means no deletion of build, buildrun, and output image")
+
+	applyCredentialsFlags(buildRunMixCmd, &buildRunMixCmdSettings.credentialsCfg)
+	applyForceFlag(buildRunMixCmd)
+	applyControllerMetricsFlags(buildRunMixCmd)
+	applyArtifactsFlags(buildRunMixCmd)
+	applyUsageIntervalFlag(buildRunMixCmd)
+	applyRecordEventsFlag(buildRunMixCmd)
+}
@@ -33,6 +33,7 @@ var buildRunSeriesCmdSettings struct {
 	buildTestsIncrement int
 	namingCfg           load.NamingConfig
 	buildCfg            load.BuildConfig
+	credentialsCfg      load.CredentialsConfig
 
 	htmlOutput string
 	csvOutput  string
@@ -51,7 +52,7 @@ var buildRunSeriesCmd = &cobra.Command{
 			buildRunSeriesCmdSettings.buildTestsIncrement <= 0 ||
 			buildRunSeriesCmdSettings.buildTestsMin > buildRunSeriesCmdSettings.buildTestsMax {
 			return wrap.Errorf(
-				fmt.Errorf(cmd.UsageString()),
+				fmt.Errorf("%s", cmd.UsageString()),
 				"input parameters for min, max, and increment are out of bounds",
 			)
 		}
@@ -60,29 +61,65 @@ var buildRunSeriesCmd = &cobra.Command{
 	},
 
 	RunE: func(cmd *cobra.Command, args []string) error {
-		kubeAccess, err := load.NewKubeAccess()
+		kubeAccess, err := newKubeAccess(cmd)
 		if err != nil {
 			return err
 		}
 
-		if err := load.CheckSystemAndConfig(*kubeAccess, buildRunSeriesCmdSettings.buildCfg, buildRunSeriesCmdSettings.buildTestsMax); err != nil {
+		buildCfg, cleanupCredentials, err := load.ProvisionCredentials(*kubeAccess, buildRunSeriesCmdSettings.namingCfg, credentialsFromEnv(cmd, buildRunSeriesCmdSettings.credentialsCfg), buildRunSeriesCmdSettings.buildCfg)
+		if err != nil {
 			return err
 		}
 
-		results, err := load.ExecuteSeriesOfParallelBuildRuns(*kubeAccess, buildRunSeriesCmdSettings.namingCfg, buildRunSeriesCmdSettings.buildCfg, buildRunSeriesCmdSettings.buildTestsMin, buildRunSeriesCmdSettings.buildTestsMax, buildRunSeriesCmdSettings.buildTestsIncrement)
+		defer cleanupCredentials()
+
+		namingCfg, cleanup, err := load.PrepareNamespaces(*kubeAccess, buildRunSeriesCmdSettings.namingCfg, buildCfg)
 		if err != nil {
 			return err
 		}
 
-		if err := store(buildRunSeriesCmdSettings.htmlOutput, func(w io.Writer) error { return load.CreateChartJS(results, w) }); err != nil {
+		defer cleanup()
+
+		// The preflight checks cover the prepared namespaces, including the
+		// ones that were created for the test
+		if err := preflight(load.CheckSystemAndConfig(*kubeAccess, namingCfg, buildCfg, buildRunSeriesCmdSettings.buildTestsMax)); err != nil {
 			return err
 		}
 
-		if err := store(buildRunSeriesCmdSettings.csvOutput, func(w io.Writer) error { return load.CreateResultSetCSV(results, w) }); err != nil {
+		fingerprint := printFingerprint(load.CollectFingerprint(*kubeAccess, buildRunSeriesCmdSettings.namingCfg.Namespace, buildCfg))
+
+		observed, err := startObservers(kubeAccess, namingCfg, fingerprint)
+		if err != nil {
 			return err
 		}
 
-		return nil
+		// In case of errors or an interruption, the reports still contain
+		// the result sets of the iterations that completed
+		results, runErr := load.ExecuteSeriesOfParallelBuildRuns(*kubeAccess, namingCfg, buildCfg, buildRunSeriesCmdSettings.buildTestsMin, buildRunSeriesCmdSettings.buildTestsMax, buildRunSeriesCmdSettings.buildTestsIncrement)
+		observed.stop()
+		if len(results) == 0 {
+			return runErr
+		}
+
+		// The series only keeps the result sets of its iterations, which
+		// is why the controller metrics come without client-side means
+		var options = observed.reportOptions(nil)
+
+		if err := store(buildRunSeriesCmdSettings.htmlOutput, func(w io.Writer) error {
+			return load.CreateChartJS(results, w, options...)
+		}); err != nil {
+			return err
+		}
+
+		if err := store(buildRunSeriesCmdSettings.csvOutput, func(w io.Writer) error {
+			return load.CreateResultSetCSV(results, w, options...)
+		}); err != nil {
+			return err
+		}
+
+		observed.print(nil)
+
+		return runErr
 	},
 }
 
@@ -101,4 +138,10 @@ func init() {
 
 	applyNamingFlags(buildRunSeriesCmd, &buildRunSeriesCmdSettings.namingCfg)
 	applyBuildRunSettingsFlags(buildRunSeriesCmd, &buildRunSeriesCmdSettings.buildCfg)
+	applyCredentialsFlags(buildRunSeriesCmd, &buildRunSeriesCmdSettings.credentialsCfg)
+	applyForceFlag(buildRunSeriesCmd)
+	applyControllerMetricsFlags(buildRunSeriesCmd)
+	applyArtifactsFlags(buildRunSeriesCmd)
+	applyUsageIntervalFlag(buildRunSeriesCmd)
+	applyRecordEventsFlag(buildRunSeriesCmd)
 }
@@ -29,7 +29,12 @@ import (
 var buildRunOnceCmdSettings struct {
 	parallel  int
 	namingCfg load.NamingConfig
-	buildCfg  load.BuildConfig
+
+	buildRunsPerBuild   int
+	sequentialBuildRuns bool
+
+	buildCfg       load.BuildConfig
+	credentialsCfg load.CredentialsConfig
 
 	htmlOutput string
 	csvOutput  string
@@ -41,46 +46,170 @@ var buildRunOnceCmd = &cobra.Command{
 	Long:          bunt.Sprintf("*Creates a single buildrun*\n%s", buildRunSettingsDescription),
 	SilenceUsage:  true,
 	SilenceErrors: true,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		switch {
+		case buildRunOnceCmdSettings.buildRunsPerBuild < 1:
+			return fmt.Errorf("the number of buildruns per build must be at least one")
+
+		case buildRunOnceCmdSettings.buildRunsPerBuild > 1 && buildRunOnceCmdSettings.buildCfg.EmbedBuildSpec:
+			return fmt.Errorf("multiple buildruns per build cannot be used with standalone buildruns (--embed-build-spec)")
+		}
+
+		return nil
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		kubeAccess, err := load.NewKubeAccess()
+		kubeAccess, err := newKubeAccess(cmd)
+		if err != nil {
+			return err
+		}
+
+		buildCfg, cleanupCredentials, err := load.ProvisionCredentials(*kubeAccess, buildRunOnceCmdSettings.namingCfg, credentialsFromEnv(cmd, buildRunOnceCmdSettings.credentialsCfg), buildRunOnceCmdSettings.buildCfg)
+		if err != nil {
+			return err
+		}
+
+		defer cleanupCredentials()
+
+		if buildRunOnceCmdSettings.buildRunsPerBuild > 1 {
+			return runBuildRunsPerBuild(*kubeAccess, buildCfg)
+		}
+
+		namingCfg, cleanup, err := load.PrepareNamespaces(*kubeAccess, buildRunOnceCmdSettings.namingCfg, buildCfg)
 		if err != nil {
 			return err
 		}
 
-		if err := load.CheckSystemAndConfig(*kubeAccess, buildRunOnceCmdSettings.buildCfg, buildRunOnceCmdSettings.parallel); err != nil {
+		defer cleanup()
+
+		// The preflight checks cover the prepared namespaces, including the
+		// ones that were created for the test
+		if err := preflight(load.CheckSystemAndConfig(*kubeAccess, namingCfg, buildCfg, buildRunOnceCmdSettings.parallel)); err != nil {
 			return err
 		}
 
-		buildRunResults, err := load.ExecuteParallelBuildRuns(*kubeAccess, buildRunOnceCmdSettings.namingCfg, buildRunOnceCmdSettings.buildCfg, buildRunOnceCmdSettings.parallel)
+		fingerprint := printFingerprint(load.CollectFingerprint(*kubeAccess, buildRunOnceCmdSettings.namingCfg.Namespace, buildCfg))
+
+		observed, err := startObservers(kubeAccess, namingCfg, fingerprint)
 		if err != nil {
 			return err
 		}
 
-		if err := store(buildRunOnceCmdSettings.htmlOutput, func(w io.Writer) error { return load.CreateBuildrunResultsChartJS(buildRunResults, w) }); err != nil {
+		// In case of errors or an interruption, the reports still contain
+		// the results of the buildruns that completed
+		buildRunResults, runErr := load.ExecuteParallelBuildRuns(*kubeAccess, namingCfg, buildCfg, buildRunOnceCmdSettings.parallel)
+		observed.stop()
+		if len(buildRunResults) == 0 {
+			return runErr
+		}
+
+		var options = observed.reportOptions(buildRunResults)
+
+		if err := store(buildRunOnceCmdSettings.htmlOutput, func(w io.Writer) error {
+			return load.CreateBuildrunResultsChartJS(buildRunResults, w, options...)
+		}); err != nil {
 			return err
 		}
 
-		if err := store(buildRunOnceCmdSettings.csvOutput, func(w io.Writer) error { return load.CreateResultsCSV(buildRunResults, w) }); err != nil {
+		if err := store(buildRunOnceCmdSettings.csvOutput, func(w io.Writer) error {
+			return load.CreateResultsCSV(buildRunResults, w, options...)
+		}); err != nil {
 			return err
 		}
 
 		fmt.Print(load.CalculateResultSet(buildRunResults, "buildrun"))
+		observed.print(buildRunResults)
 
-		return nil
+		return runErr
 	},
 }
 
+func runBuildRunsPerBuild(kubeAccess load.KubeAccess, buildCfg load.BuildConfig) error {
+	var (
+		builds            = buildRunOnceCmdSettings.parallel
+		buildRunsPerBuild = buildRunOnceCmdSettings.buildRunsPerBuild
+		concurrent        = builds * buildRunsPerBuild
+	)
+
+	if buildRunOnceCmdSettings.sequentialBuildRuns {
+		concurrent = builds
+	}
+
+	namingCfg, cleanup, err := load.PrepareNamespaces(kubeAccess, buildRunOnceCmdSettings.namingCfg, buildCfg)
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	// The preflight checks cover the prepared namespaces, including the
+	// ones that were created for the test
+	if err := preflight(load.CheckSystemAndConfig(kubeAccess, namingCfg, buildCfg, concurrent)); err != nil {
+		return err
+	}
+
+	fingerprint := printFingerprint(load.CollectFingerprint(kubeAccess, buildRunOnceCmdSettings.namingCfg.Namespace, buildCfg))
+
+	observed, err := startObservers(&kubeAccess, namingCfg, fingerprint)
+	if err != nil {
+		return err
+	}
+
+	// In case of errors or an interruption, the reports still contain
+	// the results of the buildruns that completed
+	buildResults, runErr := load.ExecuteBuildRunsPerBuild(kubeAccess, namingCfg, buildCfg, builds, buildRunsPerBuild, buildRunOnceCmdSettings.sequentialBuildRuns)
+	observed.stop()
+	if len(buildResults) == 0 {
+		return runErr
+	}
+
+	var allResults = []load.Result{}
+	for _, buildResult := range buildResults {
+		allResults = append(allResults, buildResult.Results...)
+	}
+
+	var options = observed.reportOptions(allResults)
+
+	if err := store(buildRunOnceCmdSettings.htmlOutput, func(w io.Writer) error {
+		return load.CreateBuildResultsChartJS(buildResults, w, options...)
+	}); err != nil {
+		return err
+	}
+
+	if err := store(buildRunOnceCmdSettings.csvOutput, func(w io.Writer) error {
+		return load.CreateBuildResultsCSV(buildResults, w, options...)
+	}); err != nil {
+		return err
+	}
+
+	for _, buildResult := range buildResults {
+		bunt.Printf("\nBuildRuns of build *%s*\n", buildResult.BuildName)
+		fmt.Print(load.CalculateResultSet(buildResult.Results, "buildrun"))
+	}
+
+	observed.print(allResults)
+
+	return runErr
+}
+
 func init() {
 	rootCmd.AddCommand(buildRunOnceCmd)
 
 	buildRunOnceCmd.Flags().SortFlags = false
 	buildRunOnceCmd.PersistentFlags().SortFlags = false
 
-	buildRunOnceCmd.Flags().IntVar(&buildRunOnceCmdSettings.parallel, "parallel", 1, "number of parallel buildruns")
+	buildRunOnceCmd.Flags().IntVar(&buildRunOnceCmdSettings.parallel, "parallel", 1, "number of parallel buildruns, or builds in case of multiple buildruns per build")
+	buildRunOnceCmd.Flags().IntVar(&buildRunOnceCmdSettings.buildRunsPerBuild, "buildruns-per-build", 1, "number of buildruns to create for each build")
+	buildRunOnceCmd.Flags().BoolVar(&buildRunOnceCmdSettings.sequentialBuildRuns, "sequential-buildruns", false, "run the buildruns of a build one after another instead of concurrently")
 
 	buildRunOnceCmd.Flags().StringVar(&buildRunOnceCmdSettings.htmlOutput, "html", "", "filename of the HTML report")
 	buildRunOnceCmd.Flags().StringVar(&buildRunOnceCmdSettings.csvOutput, "csv", "", "filename of the CSV report")
 
 	applyNamingFlags(buildRunOnceCmd, &buildRunOnceCmdSettings.namingCfg)
 	applyBuildRunSettingsFlags(buildRunOnceCmd, &buildRunOnceCmdSettings.buildCfg)
+	applyCredentialsFlags(buildRunOnceCmd, &buildRunOnceCmdSettings.credentialsCfg)
+	applyForceFlag(buildRunOnceCmd)
+	applyControllerMetricsFlags(buildRunOnceCmd)
+	applyArtifactsFlags(buildRunOnceCmd)
+	applyUsageIntervalFlag(buildRunOnceCmd)
+	applyRecordEventsFlag(buildRunOnceCmd)
 }
@@ -17,18 +17,28 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/gonvenience/bunt"
 	"github.com/spf13/cobra"
 
 	"github.com/homeport/build-load/internal/load"
 )
 
+type testPlanSettings struct {
+	namespace    string
+	testplanPath string
+	variables    []string
+}
+
 var buildRunTestplanCmdSettings struct {
-	namespace              string
+	testPlanSettings
 	generateServiceAccount bool
-	testplanPath           string
+	skipDelete             bool
+	dryRun                 bool
 }
 
 var testplanCmdLong = `Run buildruns configured as steps in a testplan YAML file.
@@ -52,6 +62,9 @@ steps:
         name: reg-cred
 
 - name: buildpacks
+  parallel: 2
+  repeat: 3
+  warmup: 1
   buildSpec:
     source:
       url: https://github.com/sclorg/nodejs-ex
@@ -73,22 +86,60 @@ var buildRunTestplanCmd = &cobra.Command{
 	SilenceUsage:  true,
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		kubeAccess, err := load.NewKubeAccess()
+		testplan, err := loadTestPlan(buildRunTestplanCmdSettings.testPlanSettings)
+		if err != nil {
+			return err
+		}
+
+		// Without any service account configured in the testplan, the flag
+		// decides whether a service account is generated for each buildrun
+		if len(testplan.ServiceAccountName) == 0 && buildRunTestplanCmdSettings.generateServiceAccount {
+			testplan.ServiceAccountName = "generated"
+		}
+
+		if cmd.Flags().Changed("skip-delete") {
+			testplan.Defaults.SkipDelete = &buildRunTestplanCmdSettings.skipDelete
+		}
+
+		if buildRunTestplanCmdSettings.dryRun {
+			return load.RenderTestPlan(*testplan, os.Stdout)
+		}
+
+		kubeAccess, err := newKubeAccess(cmd)
 		if err != nil {
 			return err
 		}
 
-		testplan, err := loadTestPlan(buildRunTestplanCmdSettings.testplanPath)
+		if err := preflight(load.CheckTestPlan(*kubeAccess, *testplan)); err != nil {
+			return err
+		}
+
+		fingerprint := printFingerprint(load.CollectTestPlanFingerprint(*kubeAccess, *testplan))
+
+		observed, err := startObservers(kubeAccess, load.TestPlanNamingConfig(*testplan), fingerprint)
 		if err != nil {
 			return err
 		}
 
-		// Override testplan namespace if command line flag namespace is used
-		if len(buildRunTestplanCmdSettings.namespace) > 0 {
-			testplan.Namespace = buildRunTestplanCmdSettings.namespace
+		// In case of errors or an interruption, the results of the steps
+		// that completed are still printed
+		results, runErr := load.ExecuteTestPlan(*kubeAccess, *testplan)
+		observed.stop()
+		for _, result := range results {
+			if result.ResultSet.NumberOfResults > 0 {
+				bunt.Printf("\nResults of test plan step *%s*\n", result.Name)
+				fmt.Print(result.ResultSet)
+			}
+		}
+
+		if len(results) > 0 {
+			fmt.Println()
+			fmt.Print(load.TestPlanSummary(results))
 		}
 
-		return load.ExecuteTestPlan(*kubeAccess, *testplan)
+		observed.print(nil)
+
+		return runErr
 	},
 }
 
@@ -98,24 +149,72 @@ func init() {
 	buildRunTestplanCmd.Flags().SortFlags = false
 	buildRunTestplanCmd.PersistentFlags().SortFlags = false
 
-	buildRunTestplanCmd.Flags().StringVar(&buildRunTestplanCmdSettings.namespace, "namespace", "", "namespace to run tests in (takes precedence over namespace in testplan YAML)")
-	buildRunTestplanCmd.Flags().BoolVar(&buildRunTestplanCmdSettings.generateServiceAccount, "generate-service-account", true, "generate service account for build")
-	buildRunTestplanCmd.Flags().StringVar(&buildRunTestplanCmdSettings.testplanPath, "testplan", "", "testplan configuration file")
+	applyTestPlanFlags(buildRunTestplanCmd, &buildRunTestplanCmdSettings.testPlanSettings)
+	buildRunTestplanCmd.Flags().BoolVar(&buildRunTestplanCmdSettings.generateServiceAccount, "generate-service-account", true, "generate service account for build, unless the testplan configures a service account")
+	buildRunTestplanCmd.Flags().BoolVar(&buildRunTestplanCmdSettings.skipDelete, "skip-delete", false, "skip the deletion of builds, buildruns, and images (takes precedence over skipDelete in testplan defaults)")
+	buildRunTestplanCmd.Flags().BoolVar(&buildRunTestplanCmdSettings.dryRun, "dry-run", false, "print the builds and buildruns of the testplan instead of creating them")
+	applyForceFlag(buildRunTestplanCmd)
+	applyControllerMetricsFlags(buildRunTestplanCmd)
+	applyArtifactsFlags(buildRunTestplanCmd)
+	applyUsageIntervalFlag(buildRunTestplanCmd)
+	applyRecordEventsFlag(buildRunTestplanCmd)
+}
+
+func applyTestPlanFlags(cmd *cobra.Command, settings *testPlanSettings) {
+	cmd.Flags().StringVar(&settings.namespace, "namespace", "", "namespace to run tests in (takes precedence over namespace in testplan YAML)")
+	cmd.Flags().StringVar(&settings.testplanPath, "testplan", "", "testplan configuration file")
+	cmd.Flags().StringArrayVar(&settings.variables, "set", []string{}, "set testplan variable using key=value (takes precedence over variables in testplan YAML and environment)")
 
-	_ = cobra.MarkFlagRequired(buildRunTestplanCmd.Flags(), "testplan")
+	_ = cobra.MarkFlagRequired(cmd.Flags(), "testplan")
 }
 
-func loadTestPlan(path string) (*load.TestPlan, error) {
-	switch path {
+func loadTestPlan(settings testPlanSettings) (*load.TestPlan, error) {
+	variables, err := parseVariables(settings.variables)
+	if err != nil {
+		return nil, err
+	}
+
+	var testplan *load.TestPlan
+	switch settings.testplanPath {
 	case "-":
-		return load.NewTestPlan(os.Stdin)
+		testplan, err = load.NewTestPlan(os.Stdin, load.TestPlanVariables(variables))
 
 	default:
-		file, err := os.Open(filepath.Clean(path))
-		if err != nil {
-			return nil, err
+		file, openErr := os.Open(filepath.Clean(settings.testplanPath))
+		if openErr != nil {
+			return nil, openErr
+		}
+
+		defer file.Close()
+
+		testplan, err = load.NewTestPlan(file,
+			load.TestPlanBaseDir(filepath.Dir(settings.testplanPath)),
+			load.TestPlanVariables(variables),
+		)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Override testplan namespace if command line flag namespace is used
+	if len(settings.namespace) > 0 {
+		testplan.Namespace = settings.namespace
+	}
+
+	return testplan, nil
+}
+
+func parseVariables(assignments []string) (map[string]string, error) {
+	var variables = map[string]string{}
+	for _, assignment := range assignments {
+		key, value, ok := strings.Cut(assignment, "=")
+		if !ok || len(key) == 0 {
+			return nil, fmt.Errorf("invalid variable assignment %q, use key=value", assignment)
 		}
 
-		return load.NewTestPlan(file)
+		variables[key] = value
 	}
+
+	return variables, nil
 }
@@ -27,9 +27,10 @@ import (
 )
 
 var buildsCmdSettings struct {
-	count     int
-	namingCfg load.NamingConfig
-	buildCfg  load.BuildConfig
+	count          int
+	namingCfg      load.NamingConfig
+	buildCfg       load.BuildConfig
+	credentialsCfg load.CredentialsConfig
 
 	htmlOutput string
 	csvOutput  string
@@ -45,7 +46,7 @@ var buildsCmd = &cobra.Command{
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		if buildsCmdSettings.count <= 0 {
 			return wrap.Errorf(
-				fmt.Errorf(cmd.UsageString()),
+				fmt.Errorf("%s", cmd.UsageString()),
 				"input parameter for count is out bounds",
 			)
 		}
@@ -54,19 +55,35 @@ var buildsCmd = &cobra.Command{
 	},
 
 	RunE: func(cmd *cobra.Command, args []string) error {
-		kubeAccess, err := load.NewKubeAccess()
+		kubeAccess, err := newKubeAccess(cmd)
 		if err != nil {
 			return err
 		}
 
-		buildResults, err := load.ExecuteBuilds(*kubeAccess, buildsCmdSettings.namingCfg, buildsCmdSettings.buildCfg, buildsCmdSettings.count)
+		buildCfg, cleanupCredentials, err := load.ProvisionCredentials(*kubeAccess, buildsCmdSettings.namingCfg, credentialsFromEnv(cmd, buildsCmdSettings.credentialsCfg), buildsCmdSettings.buildCfg)
 		if err != nil {
 			return err
 		}
 
+		defer cleanupCredentials()
+
+		printFingerprint(load.CollectFingerprint(*kubeAccess, buildsCmdSettings.namingCfg.Namespace, buildCfg))
+
+		namingCfg, cleanup, err := load.PrepareNamespaces(*kubeAccess, buildsCmdSettings.namingCfg, buildCfg)
+		if err != nil {
+			return err
+		}
+
+		defer cleanup()
+
+		buildResults, runErr := load.ExecuteBuilds(*kubeAccess, namingCfg, buildCfg, buildsCmdSettings.count)
+		if len(buildResults) == 0 {
+			return runErr
+		}
+
 		fmt.Print(load.CalculateResultSet(buildResults, "build"))
 
-		return nil
+		return runErr
 	},
 }
 
@@ -80,4 +97,5 @@ func init() {
 
 	applyNamingFlags(buildsCmd, &buildsCmdSettings.namingCfg)
 	applyBuildRunSettingsFlags(buildsCmd, &buildsCmdSettings.buildCfg)
+	applyCredentialsFlags(buildsCmd, &buildsCmdSettings.credentialsCfg)
 }
@@ -18,11 +18,16 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gonvenience/bunt"
+	"github.com/gonvenience/text"
 	"github.com/spf13/cobra"
 
 	"github.com/homeport/build-load/internal/load"
@@ -37,6 +42,15 @@ Prerequisites:
       --docker-username=<docker-hub-username> \
       --docker-password=<docker-hub-password>}
 
+  _Alternatively, let build-load create the secret for the test and remove it afterwards:_
+    LightSteelBlue{build-load \
+      buildruns \
+      --cluster-build-strategy=kaniko \
+      --source-url=https://github.com/EmilyEmily/docker-simple \
+      --output-image-url=docker.io/boatyard \
+      --registry-username=<docker-hub-username> \
+      --registry-password=<docker-hub-password>}
+
 Examples:
   _Run a Kaniko based build with no concurrency:_
     LightSteelBlue{build-load \
@@ -56,17 +70,35 @@ Examples:
       --parallel=10}
 `)
 
+func applyClientFlags(cmd *cobra.Command, clientCfg *load.ClientConfig) {
+	pf := cmd.PersistentFlags()
+
+	pf.StringVar(&clientCfg.KubeConfig, "kubeconfig", "", "path to the kubeconfig file, by default the KUBECONFIG environment variable or the default location is used")
+	pf.StringVar(&clientCfg.Context, "context", "", "name of the kubeconfig context to use, by default the current context is used")
+	pf.BoolVar(&clientCfg.InCluster, "in-cluster", false, "use the service account of the pod to access the cluster, when running inside a cluster")
+	pf.StringVar(&clientCfg.Impersonate, "as", "", "username to impersonate for the cluster operations")
+	pf.StringSliceVar(&clientCfg.ImpersonateGroups, "as-group", nil, "group to impersonate for the cluster operations, can be repeated to specify multiple groups")
+	pf.Float32Var(&clientCfg.QPS, "qps", 500, "maximum queries per second to the Kubernetes API server")
+	pf.IntVar(&clientCfg.Burst, "burst", 500, "maximum burst of queries to the Kubernetes API server")
+	pf.StringVar(&clientCfg.ShipwrightAPIVersion, "shipwright-api-version", load.APIVersionAuto, "Shipwright Build API version to use, either auto, v1alpha1, or v1beta1")
+}
+
 func applyNamingFlags(cmd *cobra.Command, namingCfg *load.NamingConfig) {
 	pf := cmd.PersistentFlags()
 
 	pf.StringVar(&namingCfg.Namespace, "namespace", "default", "namespace to test in")
 	pf.StringVar(&namingCfg.Prefix, "prefix", "test", "prefix for kube resource names")
+	pf.StringSliceVar(&namingCfg.Namespaces, "namespaces", nil, "spread buildruns round-robin across these namespaces, secrets and service accounts are copied from the namespace defined by --namespace")
+	pf.IntVar(&namingCfg.NamespaceCount, "namespace-count", 0, "spread buildruns round-robin across this number of namespaces, which are created and deleted by the test")
+
+	cmd.MarkFlagsMutuallyExclusive("namespaces", "namespace-count")
 }
 
 func applyBuildRunSettingsFlags(cmd *cobra.Command, buildCfg *load.BuildConfig) {
 	pf := cmd.PersistentFlags()
 
 	pf.StringVar(&buildCfg.ClusterBuildStrategy, "cluster-build-strategy", "", "specify which cluster build strategy to be tested")
+	pf.StringVar(&buildCfg.BuildStrategy, "build-strategy", "", "specify which namespaced build strategy to be tested (in the test namespace)")
 
 	pf.StringVar(&buildCfg.ServiceAccountName, "service-account-name", "generated", "service account to be used, use name 'generated' to generate a new one, an empty string configures the system default service account")
 
@@ -84,10 +116,318 @@ func applyBuildRunSettingsFlags(cmd *cobra.Command, buildCfg *load.BuildConfig)
 
 	pf.BoolVar(&buildCfg.SkipDelete, "skip-delete", false, "skip the clean-up of resources, which means no deletion of build, buildrun, and output image")
 
+	pf.BoolVar(&buildCfg.EmbedBuildSpec, "embed-build-spec", false, "create standalone buildruns with an embedded build specification instead of separate builds")
+
 	_ = cobra.MarkFlagRequired(pf, "source-url")
 	_ = cobra.MarkFlagRequired(pf, "output-image-url")
+
+	cmd.MarkFlagsMutuallyExclusive("cluster-build-strategy", "build-strategy")
+	cmd.MarkFlagsOneRequired("cluster-build-strategy", "build-strategy")
+}
+
+func applyCredentialsFlags(cmd *cobra.Command, credentialsCfg *load.CredentialsConfig) {
+	pf := cmd.PersistentFlags()
+
+	pf.StringVar(&credentialsCfg.DockerConfig, "docker-config", "", "create the output secret from a local docker config file, for example ~/.docker/config.json")
+	pf.StringVar(&credentialsCfg.RegistryServer, "registry-server", "", "registry server of the created output secret, by default the registry of the output image")
+	pf.StringVar(&credentialsCfg.RegistryUsername, "registry-username", "", "create the output secret using this registry username")
+	pf.StringVar(&credentialsCfg.RegistryPassword, "registry-password", "", "registry password of the created output secret, by default the BUILD_LOAD_REGISTRY_PASSWORD environment variable is used")
+	pf.StringVar(&credentialsCfg.SourceUsername, "source-username", "", "create the source secret using this username")
+	pf.StringVar(&credentialsCfg.SourcePassword, "source-password", "", "password or token of the created source secret, by default the BUILD_LOAD_SOURCE_PASSWORD environment variable is used")
+	pf.BoolVar(&credentialsCfg.ServiceAccount, "create-service-account", false, "create a service account that links the output and source secrets and use it for the buildruns")
+
+	cmd.MarkFlagsMutuallyExclusive("docker-config", "registry-username")
+}
+
+// credentialsFromEnv uses the passwords from the environment in case they
+// were not configured using flags, they are no flag defaults, since these
+// would be shown in the usage
+func credentialsFromEnv(cmd *cobra.Command, credentialsCfg load.CredentialsConfig) load.CredentialsConfig {
+	if !cmd.Flags().Changed("registry-password") {
+		credentialsCfg.RegistryPassword = os.Getenv("BUILD_LOAD_REGISTRY_PASSWORD")
+	}
+
+	if !cmd.Flags().Changed("source-password") {
+		credentialsCfg.SourcePassword = os.Getenv("BUILD_LOAD_SOURCE_PASSWORD")
+	}
+
+	return credentialsCfg
+}
+
+// force defines whether the buildruns are created even though the preflight
+// checks found that they do not fit into the cluster
+var force bool
+
+func applyForceFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&force, "force", false, "create the buildruns even though they do not fit into the free resources of the cluster")
+}
+
+// controllerMetrics defines whether the metrics of the Shipwright and
+// Tekton controllers are scraped before and after the run
+var controllerMetrics struct {
+	enabled        bool
+	shipwrightPort int
+	tektonPort     int
+}
+
+func applyControllerMetricsFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&controllerMetrics.enabled, "controller-metrics", false, "scrape the Shipwright and Tekton controller metrics before and after the run and report the changes")
+	cmd.Flags().IntVar(&controllerMetrics.shipwrightPort, "shipwright-metrics-port", load.DefaultMetricsEndpoints[0].Port, "metrics port of the Shipwright build controller pods")
+	cmd.Flags().IntVar(&controllerMetrics.tektonPort, "tekton-metrics-port", load.DefaultMetricsEndpoints[1].Port, "metrics port of the Tekton pipelines controller pods")
+}
+
+// controllerEndpoints returns the metrics endpoints of the controllers with
+// the configured metrics ports
+func controllerEndpoints() []load.MetricsEndpoint {
+	var endpoints = []load.MetricsEndpoint{load.DefaultMetricsEndpoints[0], load.DefaultMetricsEndpoints[1]}
+	endpoints[0].Port = controllerMetrics.shipwrightPort
+	endpoints[1].Port = controllerMetrics.tektonPort
+	return endpoints
+}
+
+// measureControllerMetrics scrapes the controller metrics before the run,
+// the returned function scrapes them again after the run and returns the
+// changes of the duration histograms
+func measureControllerMetrics(kubeAccess load.KubeAccess) func() []load.HistogramDelta {
+	if !controllerMetrics.enabled {
+		return func() []load.HistogramDelta { return nil }
+	}
+
+	var endpoints = controllerEndpoints()
+	var before = load.ScrapeControllerMetrics(kubeAccess, endpoints)
+	return func() []load.HistogramDelta {
+		// the run might have been interrupted, the metrics are still of
+		// interest, therefore the cleanup context is used
+		if kubeAccess.CleanupContext != nil {
+			kubeAccess.Context = kubeAccess.CleanupContext
+		}
+
+		return load.HistogramDeltas(before, load.ScrapeControllerMetrics(kubeAccess, endpoints))
+	}
+}
+
+// printControllerMetrics prints the controller metrics next to the mean of
+// the client-side results, in case controller metrics are enabled
+func printControllerMetrics(deltas []load.HistogramDelta, results []load.Result) {
+	if controllerMetrics.enabled {
+		fmt.Println()
+		fmt.Print(load.ControllerMetricsReport(deltas, results))
+	}
+}
+
+// measureAPIRequests drops the API requests recorded so far, for example
+// during the preflight checks, the returned function returns the statistics
+// of the requests made since then
+func measureAPIRequests(kubeAccess load.KubeAccess) func() load.APIStats {
+	kubeAccess.APIMetrics.Reset()
+	return kubeAccess.APIMetrics.Stats
+}
+
+// eventRecording defines whether the events of the run are recorded
+var eventRecording bool
+
+func applyRecordEventsFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&eventRecording, "record-events", true, "watch the events of the objects of the run and attach them to the buildruns, use --record-events=false to disable")
+}
+
+// recordEvents starts to record the events in the namespaces of the run and
+// uses the event recorder, so that the events are attached to the buildruns,
+// the returned function stops the recording and returns the summary of the
+// events
+func recordEvents(kubeAccess *load.KubeAccess, namingCfg load.NamingConfig) func() load.EventSummary {
+	if !eventRecording {
+		return func() load.EventSummary { return load.EventSummary{} }
+	}
+
+	var recorder = load.StartEventRecording(*kubeAccess, namingCfg)
+	kubeAccess.Events = recorder
+	return recorder.Stop
+}
+
+// printEvents prints the top event reasons of the run, in case the events
+// are recorded
+func printEvents(summary load.EventSummary) {
+	if eventRecording {
+		fmt.Println()
+		fmt.Print(load.EventReport(summary))
+	}
+}
+
+// artifacts defines where the artifacts of failed or slow buildruns are
+// written to, and from which completion time on a buildrun is slow
+var artifacts struct {
+	dir       string
+	threshold time.Duration
+}
+
+func applyArtifactsFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&artifacts.dir, "artifacts-dir", "", "directory to write the objects, container logs, and events of failed or slow buildruns to")
+	cmd.Flags().DurationVar(&artifacts.threshold, "artifacts-threshold", 0, "completion time from which on the artifacts of successful buildruns are written as well, zero only writes failed buildruns")
+}
+
+// collectArtifacts configures the artifact collector of the Kubernetes
+// access, in case an artifacts directory is configured
+func collectArtifacts(kubeAccess *load.KubeAccess) error {
+	if artifacts.dir == "" {
+		if artifacts.threshold > 0 {
+			bunt.Printf("DarkOrange{*Warning:*} --artifacts-threshold has no effect without --artifacts-dir, no artifacts are written\n\n")
+		}
+
+		return nil
+	}
+
+	collector, err := load.NewArtifactCollector(artifacts.dir, artifacts.threshold)
+	if err != nil {
+		return err
+	}
+
+	kubeAccess.Artifacts = collector
+	return nil
+}
+
+// printArtifacts prints where the artifacts of failed or slow buildruns
+// were written to
+func printArtifacts(collector *load.ArtifactCollector) {
+	if index := collector.Index(); len(index) > 0 {
+		bunt.Printf("\nWrote artifacts of %s to _%s_\n", text.Plural(len(index), "buildrun"), collector.IndexFile())
+	}
+}
+
+// usageInterval defines how often the resource usage of the controller
+// pods and nodes is sampled during the run, zero disables the sampling
+var usageInterval time.Duration
+
+func applyUsageIntervalFlag(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&usageInterval, "usage-interval", 0, "sample the CPU and memory usage of the controller pods and nodes in this interval during the run (requires the metrics server), zero disables the sampling")
+}
+
+// sampleResourceUsage starts to sample the resource usage and the active
+// buildruns of the run, the returned function stops the sampling and
+// returns the samples
+func sampleResourceUsage(kubeAccess load.KubeAccess, namingCfg load.NamingConfig) func() []load.UsageSample {
+	if usageInterval <= 0 {
+		return func() []load.UsageSample { return nil }
+	}
+
+	return load.StartUsageSampling(kubeAccess, namingCfg, controllerEndpoints(), usageInterval).Stop
+}
+
+// printResourceUsage prints the peak resource usage during the run, in case
+// the sampling is enabled
+func printResourceUsage(samples []load.UsageSample) {
+	if usageInterval > 0 {
+		fmt.Println()
+		fmt.Print(load.UsageReport(samples))
+	}
+}
+
+// printAPIStats prints the statistics of the requests to the Kubernetes API
+// server during the run
+func printAPIStats(stats load.APIStats) {
+	fmt.Println()
+	fmt.Print(load.APIStatsReport(stats))
+}
+
+// observers measure and record what happens in the cluster during a run,
+// they are started right before and stopped right after the buildruns
+// observers bundles the observers that run alongside the buildruns of a
+// command, and their observations once they are stopped
+type observers struct {
+	kubeAccess  *load.KubeAccess
+	fingerprint *load.Fingerprint
+
+	measured  func() []load.HistogramDelta
+	requested func() load.APIStats
+	recorded  func() load.EventSummary
+	sampled   func() []load.UsageSample
+
+	deltas   []load.HistogramDelta
+	apiStats load.APIStats
+	events   load.EventSummary
+	samples  []load.UsageSample
+}
+
+// startObservers configures the artifact collector and starts the
+// observers of the run, which are configured using the command flags, the
+// naming config defines the namespaces and names of the buildruns of the run
+func startObservers(kubeAccess *load.KubeAccess, namingCfg load.NamingConfig, fingerprint *load.Fingerprint) (*observers, error) {
+	if err := collectArtifacts(kubeAccess); err != nil {
+		return nil, err
+	}
+
+	return &observers{
+		kubeAccess:  kubeAccess,
+		fingerprint: fingerprint,
+		measured:    measureControllerMetrics(*kubeAccess),
+		requested:   measureAPIRequests(*kubeAccess),
+		recorded:    recordEvents(kubeAccess, namingCfg),
+		sampled:     sampleResourceUsage(*kubeAccess, namingCfg),
+	}, nil
 }
 
+// stop stops all observers, the controller metrics are scraped last, so
+// that their requests are not part of the API statistics of the run
+func (o *observers) stop() {
+	o.samples = o.sampled()
+	o.events = o.recorded()
+	o.apiStats = o.requested()
+	o.deltas = o.measured()
+}
+
+// reportOptions returns the report options with the observations of the
+// run, the results are compared with the controller metrics
+func (o *observers) reportOptions(results []load.Result) []load.ReportOption {
+	return []load.ReportOption{
+		load.WithFingerprint(o.fingerprint),
+		load.WithControllerMetrics(o.deltas, results),
+		load.WithResourceUsage(o.samples),
+		load.WithAPIStats(o.apiStats),
+		load.WithEvents(o.events),
+	}
+}
+
+// print prints the observations of the run, the results are compared with
+// the controller metrics
+func (o *observers) print(results []load.Result) {
+	printControllerMetrics(o.deltas, results)
+	printResourceUsage(o.samples)
+	printAPIStats(o.apiStats)
+	printEvents(o.events)
+	printArtifacts(o.kubeAccess.Artifacts)
+}
+
+// preflight returns the error of the preflight checks, unless the checks
+// only found insufficient capacity and the force flag is used
+func preflight(err error) error {
+	if err != nil && force && errors.Is(err, load.ErrInsufficientCapacity) {
+		bunt.Printf("DarkOrange{*Warning:*} %v, continuing anyway due to --force\n\n", err)
+		return nil
+	}
+
+	return err
+}
+
+// printFingerprint prints the fingerprint of the system under test, which
+// is embedded in the reports as well
+func printFingerprint(fingerprint *load.Fingerprint) *load.Fingerprint {
+	bunt.Printf("System under test:\n%s\n\n", fingerprint)
+	return fingerprint
+}
+
+func newKubeAccess(cmd *cobra.Command) (*load.KubeAccess, error) {
+	kubeAccess, err := load.NewKubeAccess(clientCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp := kubeAccess.WithContext(cmd.Context(), gracePeriod)
+	return &tmp, nil
+}
+
+// storedReports keeps the content of all stored reports, so that they can
+// be published in a config map when running inside the cluster
+var storedReports = map[string][]byte{}
+
 func store(filename string, f func(w io.Writer) error) error {
 	if len(filename) == 0 {
 		return nil
@@ -98,5 +438,25 @@ func store(filename string, f func(w io.Writer) error) error {
 		return err
 	}
 
+	storedReports[filename] = buf.Bytes()
+
 	return os.WriteFile(filename, buf.Bytes(), os.FileMode(0644))
 }
+
+func publishStoredReports(ctx context.Context) error {
+	if len(resultsConfigMap) == 0 || len(storedReports) == 0 {
+		return nil
+	}
+
+	namespace, name, found := strings.Cut(resultsConfigMap, "/")
+	if !found {
+		return fmt.Errorf("failed to parse results config map %q, expected format is namespace/name", resultsConfigMap)
+	}
+
+	kubeAccess, err := load.NewKubeAccess(clientCfg)
+	if err != nil {
+		return err
+	}
+
+	return load.PublishResults(kubeAccess.WithContext(ctx, gracePeriod), namespace, name, storedReports)
+}
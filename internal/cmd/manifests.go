@@ -0,0 +1,89 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/gonvenience/bunt"
+	"github.com/spf13/cobra"
+
+	"github.com/homeport/build-load/internal/load"
+)
+
+var manifestsCmdSettings struct {
+	deployCfg load.DeployConfig
+}
+
+var manifestsCmd = &cobra.Command{
+	Use:   "manifests [flags] -- <build-load command and flags>",
+	Short: "Renders the manifests to run build-load as a Job inside the cluster",
+	Long: bunt.Sprintf(`*Renders the manifests to run build-load as a Job inside the cluster*
+
+Running build-load inside the cluster avoids the client-side latency, for
+example of a VPN connection, being added to every API call. The output
+contains the service account, the RBAC rules, the Job, and optionally a
+persistent volume claim to store the results. The rules to run buildruns
+are only granted in the target namespaces, which are taken from the
+namespace flags of the command unless _--target-namespaces_ is set. Use the _results fetch_
+command to wait for the Job and download its output and reports.
+
+Examples:
+  _Run ten Kaniko buildruns in parallel from within the cluster:_
+    LightSteelBlue{build-load manifests \
+      --namespace=test-namespace \
+      --image=<registry>/build-load:latest \
+      -- \
+      buildruns \
+      --namespace=test-namespace \
+      --cluster-build-strategy=kaniko \
+      --source-url=https://github.com/EmilyEmily/docker-simple \
+      --output-image-url=docker.io/boatyard \
+      --output-secret-ref=registry-credentials \
+      --parallel=10 \
+      --csv=results.csv | kubectl apply -f -}
+`),
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manifestsCmdSettings.deployCfg.Args = args
+		return load.RenderDeployManifests(manifestsCmdSettings.deployCfg, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(manifestsCmd)
+
+	manifestsCmd.Flags().SortFlags = false
+
+	applyDeployFlags(manifestsCmd, &manifestsCmdSettings.deployCfg)
+	manifestsCmd.Flags().StringVar(&manifestsCmdSettings.deployCfg.Image, "image", "", "container image that contains the build-load binary")
+	manifestsCmd.Flags().StringVar(&manifestsCmdSettings.deployCfg.PVCSize, "pvc-size", "100Mi", "size of the persistent volume claim, when results are stored in a volume")
+	manifestsCmd.Flags().StringSliceVar(&manifestsCmdSettings.deployCfg.TargetNamespaces, "target-namespaces", nil, "namespaces in which the Job may run buildruns, defaults to the namespaces of the --namespace and --namespaces flags of the command")
+	manifestsCmd.Flags().StringSliceVar(&manifestsCmdSettings.deployCfg.ControllerNamespaces, "controller-namespaces", load.DefaultControllerNamespaces, "namespaces of the Shipwright and Tekton controllers, in which the Job may read pods and scrape metrics")
+
+	_ = cobra.MarkFlagRequired(manifestsCmd.Flags(), "image")
+}
+
+func applyDeployFlags(cmd *cobra.Command, deployCfg *load.DeployConfig) {
+	f := cmd.Flags()
+
+	f.StringVar(&deployCfg.Namespace, "namespace", "default", "namespace of the build-load Job")
+	f.StringVar(&deployCfg.Name, "name", "build-load", "name of the build-load Job and related resources")
+	f.StringVar(&deployCfg.Results, "results", load.ResultsConfigMap, "storage for the results, either configmap, or pvc")
+}
@@ -0,0 +1,74 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"time"
+
+	"github.com/gonvenience/bunt"
+	"github.com/spf13/cobra"
+
+	"github.com/homeport/build-load/internal/load"
+)
+
+var resultsFetchCmdSettings struct {
+	deployCfg load.DeployConfig
+	timeout   time.Duration
+	outputDir string
+}
+
+var resultsCmd = &cobra.Command{
+	Use:   "results",
+	Short: "Manages the results of build-load Jobs running inside the cluster",
+}
+
+var resultsFetchCmd = &cobra.Command{
+	Use:           "fetch",
+	Short:         "Waits for a build-load Job and downloads its output and reports",
+	Long:          bunt.Sprintf("*Waits for a build-load Job and downloads its output and reports*\n\nThe Job needs to be created using the manifests of the _manifests_ command."),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		kubeAccess, err := newKubeAccess(cmd)
+		if err != nil {
+			return err
+		}
+
+		if err := load.FetchResults(*kubeAccess, resultsFetchCmdSettings.deployCfg, resultsFetchCmdSettings.timeout, resultsFetchCmdSettings.outputDir); err != nil {
+			return err
+		}
+
+		bunt.Printf("Results of Job _%s/%s_ are stored in CornflowerBlue{~%s~}\n",
+			resultsFetchCmdSettings.deployCfg.Namespace,
+			resultsFetchCmdSettings.deployCfg.Name,
+			resultsFetchCmdSettings.outputDir,
+		)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resultsCmd)
+	resultsCmd.AddCommand(resultsFetchCmd)
+
+	resultsFetchCmd.Flags().SortFlags = false
+
+	applyDeployFlags(resultsFetchCmd, &resultsFetchCmdSettings.deployCfg)
+	resultsFetchCmd.Flags().DurationVar(&resultsFetchCmdSettings.timeout, "timeout", time.Hour, "maximum time to wait for the Job to finish")
+	resultsFetchCmd.Flags().StringVar(&resultsFetchCmdSettings.outputDir, "output-dir", "results", "directory to store the Job output and reports in")
+}
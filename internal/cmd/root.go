@@ -18,9 +18,13 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gonvenience/bunt"
 	"github.com/gonvenience/neat"
@@ -33,17 +37,48 @@ import (
 
 var shipwriteBuildURL = bunt.Sprintf("CornflowerBlue{~https://github.com/shipwright-io/build~}")
 
+var (
+	clientCfg        load.ClientConfig
+	gracePeriod      time.Duration
+	resultsConfigMap string
+)
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "build-load",
 	Short: fmt.Sprintf("Create synthetic load for %s", shipwriteBuildURL),
 	Long:  fmt.Sprintf("Create synthetic load for %s", shipwriteBuildURL),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(clientCfg.ImpersonateGroups) > 0 && clientCfg.Impersonate == "" {
+			return fmt.Errorf("impersonating groups (--as-group) requires a user to impersonate (--as)")
+		}
+
+		return nil
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Restore the default signal behavior after the first signal, so that a
+	// second signal terminates the program without waiting for the clean-up
+	context.AfterFunc(ctx, func() {
+		stop()
+		bunt.Fprintf(os.Stderr, "\nDarkOrange{*Interrupted:*} cancelling buildruns and cleaning up within %v, interrupt again to exit immediately\n", gracePeriod)
+	})
+
+	err := rootCmd.ExecuteContext(ctx)
+
+	// Reports are published regardless of the command outcome, since they
+	// might contain the partial results of an interrupted or failed run
+	if err := publishStoredReports(context.WithoutCancel(ctx)); err != nil {
+		fmt.Fprint(os.Stderr, readableError(err))
+	}
+
+	if err != nil {
 		fmt.Fprint(os.Stderr, readableError(err))
 		os.Exit(1)
 	}
@@ -88,7 +123,16 @@ func readableError(err error) string {
 func init() {
 	cobra.OnInitialize(initConfig)
 
+	rootCmd.PersistentFlags().SortFlags = false
+
 	rootCmd.PersistentFlags().BoolVar(&load.Debug, "debug", false, "enable additional output messages")
+	rootCmd.PersistentFlags().DurationVar(&gracePeriod, "grace-period", 30*time.Second, "maximum time to wait for the clean-up of resources after an interruption")
+
+	rootCmd.PersistentFlags().StringVar(&resultsConfigMap, "results-configmap", "", "store the reports in the given config map (format namespace/name), used when running inside the cluster")
+
+	applyClientFlags(rootCmd, &clientCfg)
+	rootCmd.MarkFlagsMutuallyExclusive("in-cluster", "kubeconfig")
+	rootCmd.MarkFlagsMutuallyExclusive("in-cluster", "context")
 }
 
 func initConfig() {
@@ -0,0 +1,76 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gonvenience/bunt"
+	"github.com/gonvenience/text"
+	"github.com/spf13/cobra"
+
+	"github.com/homeport/build-load/internal/load"
+)
+
+var testplanValidateCmdSettings testPlanSettings
+
+var testplanCmd = &cobra.Command{
+	Use:   "testplan",
+	Short: "Validate testplans and show the testplan schema",
+}
+
+var testplanValidateCmd = &cobra.Command{
+	Use:           "validate",
+	Short:         "Validates a testplan without running it",
+	Long:          "Validates a testplan, including includes, variables, and the matrix, without accessing the cluster. Use buildruns-testplan --dry-run to see the resulting builds and buildruns.",
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		testplan, err := loadTestPlan(testplanValidateCmdSettings)
+		if err != nil {
+			return err
+		}
+
+		bunt.Printf("Testplan is valid, it has %s\n", text.Plural(len(testplan.Steps), "step"))
+		return nil
+	},
+}
+
+var testplanSchemaCmd = &cobra.Command{
+	Use:           "schema",
+	Short:         "Prints the JSON Schema of the testplan format",
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		schema, err := load.TestPlanJSONSchema()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(schema))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(testplanCmd)
+	testplanCmd.AddCommand(testplanValidateCmd)
+	testplanCmd.AddCommand(testplanSchemaCmd)
+
+	testplanValidateCmd.Flags().SortFlags = false
+	applyTestPlanFlags(testplanValidateCmd, &testplanValidateCmdSettings)
+}
@@ -0,0 +1,348 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+
+	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+	shipwrightBuildBeta "github.com/shipwright-io/build/pkg/apis/build/v1beta1"
+)
+
+// Supported Shipwright Build API versions, use auto to detect the version
+// that is preferred by the cluster
+const (
+	APIVersionAuto     = "auto"
+	APIVersionV1Alpha1 = "v1alpha1"
+	APIVersionV1Beta1  = "v1beta1"
+)
+
+const shipwrightGroupName = "shipwright.io"
+
+// Internally, all Shipwright objects are handled in their v1alpha1 form. In
+// case the cluster serves v1beta1, the objects are converted when they are
+// sent to or received from the API server using the conversion functions of
+// the Shipwright API package.
+
+type betaObject interface {
+	ConvertTo(ctx context.Context, obj *unstructured.Unstructured) error
+	ConvertFrom(ctx context.Context, obj *unstructured.Unstructured) error
+}
+
+func detectShipwrightAPIVersion(client discovery.DiscoveryInterface, configured string) (string, error) {
+	switch configured {
+	case APIVersionV1Alpha1, APIVersionV1Beta1:
+		return configured, nil
+
+	case "", APIVersionAuto:
+		groups, err := client.ServerGroups()
+		if err != nil {
+			return "", fmt.Errorf("failed to discover the Shipwright Build API version: %w", err)
+		}
+
+		for _, group := range groups.Groups {
+			if group.Name != shipwrightGroupName {
+				continue
+			}
+
+			switch group.PreferredVersion.Version {
+			case APIVersionV1Alpha1, APIVersionV1Beta1:
+				debug("Using Shipwright Build API version %s", group.PreferredVersion.Version)
+				return group.PreferredVersion.Version, nil
+			}
+
+			// Fall back to any of the served versions that is supported
+			for _, version := range group.Versions {
+				switch version.Version {
+				case APIVersionV1Beta1, APIVersionV1Alpha1:
+					return version.Version, nil
+				}
+			}
+		}
+
+		// The Shipwright API is not installed (or not discoverable), stay
+		// with the default to fail on the first actual API call
+		return APIVersionV1Alpha1, nil
+
+	default:
+		return "", fmt.Errorf("unsupported Shipwright Build API version %q, use one of %s, %s, or %s", configured, APIVersionAuto, APIVersionV1Alpha1, APIVersionV1Beta1)
+	}
+}
+
+func toAlpha[T any](ctx context.Context, obj betaObject) (*T, error) {
+	var tmp unstructured.Unstructured
+	if err := obj.ConvertTo(ctx, &tmp); err != nil {
+		return nil, err
+	}
+
+	var result T
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(tmp.Object, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func toBeta[T any, PT interface {
+	*T
+	betaObject
+}](ctx context.Context, obj interface{}) (*T, error) {
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var result PT = new(T)
+	if err := result.ConvertFrom(ctx, &unstructured.Unstructured{Object: data}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func getBuild(kubeAccess KubeAccess, namespace string, name string) (*shipwrightBuild.Build, error) {
+	if kubeAccess.ShipwrightAPIVersion != APIVersionV1Beta1 {
+		return kubeAccess.BuildClient.ShipwrightV1alpha1().Builds(namespace).Get(kubeAccess.Context, name, metav1.GetOptions{})
+	}
+
+	build, err := kubeAccess.BuildClient.ShipwrightV1beta1().Builds(namespace).Get(kubeAccess.Context, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return toAlpha[shipwrightBuild.Build](kubeAccess.Context, build)
+}
+
+func createBuild(kubeAccess KubeAccess, build shipwrightBuild.Build) (*shipwrightBuild.Build, error) {
+	if kubeAccess.ShipwrightAPIVersion != APIVersionV1Beta1 {
+		return kubeAccess.BuildClient.ShipwrightV1alpha1().Builds(build.Namespace).Create(kubeAccess.Context, &build, metav1.CreateOptions{})
+	}
+
+	betaBuild, err := toBeta[shipwrightBuildBeta.Build](kubeAccess.Context, &build)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := kubeAccess.BuildClient.ShipwrightV1beta1().Builds(build.Namespace).Create(kubeAccess.Context, betaBuild, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return toAlpha[shipwrightBuild.Build](kubeAccess.Context, result)
+}
+
+func deleteBuildObject(kubeAccess KubeAccess, namespace string, name string, deleteOptions metav1.DeleteOptions) error {
+	if kubeAccess.ShipwrightAPIVersion != APIVersionV1Beta1 {
+		return kubeAccess.BuildClient.ShipwrightV1alpha1().Builds(namespace).Delete(kubeAccess.Context, name, deleteOptions)
+	}
+
+	return kubeAccess.BuildClient.ShipwrightV1beta1().Builds(namespace).Delete(kubeAccess.Context, name, deleteOptions)
+}
+
+func getBuildRun(kubeAccess KubeAccess, namespace string, name string) (*shipwrightBuild.BuildRun, error) {
+	if kubeAccess.ShipwrightAPIVersion != APIVersionV1Beta1 {
+		return kubeAccess.BuildClient.ShipwrightV1alpha1().BuildRuns(namespace).Get(kubeAccess.Context, name, metav1.GetOptions{})
+	}
+
+	buildRun, err := kubeAccess.BuildClient.ShipwrightV1beta1().BuildRuns(namespace).Get(kubeAccess.Context, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return toAlpha[shipwrightBuild.BuildRun](kubeAccess.Context, buildRun)
+}
+
+func listBuildRuns(kubeAccess KubeAccess, namespace string) ([]shipwrightBuild.BuildRun, error) {
+	if kubeAccess.ShipwrightAPIVersion != APIVersionV1Beta1 {
+		list, err := kubeAccess.BuildClient.ShipwrightV1alpha1().BuildRuns(namespace).List(kubeAccess.Context, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		return list.Items, nil
+	}
+
+	list, err := kubeAccess.BuildClient.ShipwrightV1beta1().BuildRuns(namespace).List(kubeAccess.Context, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var result = make([]shipwrightBuild.BuildRun, len(list.Items))
+	for i := range list.Items {
+		buildRun, err := toAlpha[shipwrightBuild.BuildRun](kubeAccess.Context, &list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+
+		result[i] = *buildRun
+	}
+
+	return result, nil
+}
+
+func createBuildRun(kubeAccess KubeAccess, buildRun shipwrightBuild.BuildRun) (*shipwrightBuild.BuildRun, error) {
+	if kubeAccess.ShipwrightAPIVersion != APIVersionV1Beta1 {
+		return kubeAccess.BuildClient.ShipwrightV1alpha1().BuildRuns(buildRun.Namespace).Create(kubeAccess.Context, &buildRun, metav1.CreateOptions{})
+	}
+
+	betaBuildRun, err := toBeta[shipwrightBuildBeta.BuildRun](kubeAccess.Context, &buildRun)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := kubeAccess.BuildClient.ShipwrightV1beta1().BuildRuns(buildRun.Namespace).Create(kubeAccess.Context, betaBuildRun, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return toAlpha[shipwrightBuild.BuildRun](kubeAccess.Context, result)
+}
+
+func patchBuildRun(kubeAccess KubeAccess, namespace string, name string, patchType types.PatchType, data []byte) error {
+	var err error
+	if kubeAccess.ShipwrightAPIVersion != APIVersionV1Beta1 {
+		_, err = kubeAccess.BuildClient.ShipwrightV1alpha1().BuildRuns(namespace).Patch(kubeAccess.Context, name, patchType, data, metav1.PatchOptions{})
+	} else {
+		_, err = kubeAccess.BuildClient.ShipwrightV1beta1().BuildRuns(namespace).Patch(kubeAccess.Context, name, patchType, data, metav1.PatchOptions{})
+	}
+
+	return err
+}
+
+func deleteBuildRunObject(kubeAccess KubeAccess, namespace string, name string, deleteOptions metav1.DeleteOptions) error {
+	if kubeAccess.ShipwrightAPIVersion != APIVersionV1Beta1 {
+		return kubeAccess.BuildClient.ShipwrightV1alpha1().BuildRuns(namespace).Delete(kubeAccess.Context, name, deleteOptions)
+	}
+
+	return kubeAccess.BuildClient.ShipwrightV1beta1().BuildRuns(namespace).Delete(kubeAccess.Context, name, deleteOptions)
+}
+
+func getBuildStrategy(kubeAccess KubeAccess, namespace string, name string) (*shipwrightBuild.BuildStrategy, error) {
+	if kubeAccess.ShipwrightAPIVersion != APIVersionV1Beta1 {
+		return kubeAccess.BuildClient.ShipwrightV1alpha1().BuildStrategies(namespace).Get(kubeAccess.Context, name, metav1.GetOptions{})
+	}
+
+	buildStrategy, err := kubeAccess.BuildClient.ShipwrightV1beta1().BuildStrategies(namespace).Get(kubeAccess.Context, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return toAlpha[shipwrightBuild.BuildStrategy](kubeAccess.Context, buildStrategy)
+}
+
+func createBuildStrategy(kubeAccess KubeAccess, buildStrategy shipwrightBuild.BuildStrategy) (*shipwrightBuild.BuildStrategy, error) {
+	if kubeAccess.ShipwrightAPIVersion != APIVersionV1Beta1 {
+		return kubeAccess.BuildClient.ShipwrightV1alpha1().BuildStrategies(buildStrategy.Namespace).Create(kubeAccess.Context, &buildStrategy, metav1.CreateOptions{})
+	}
+
+	betaBuildStrategy, err := toBeta[shipwrightBuildBeta.BuildStrategy](kubeAccess.Context, &buildStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := kubeAccess.BuildClient.ShipwrightV1beta1().BuildStrategies(buildStrategy.Namespace).Create(kubeAccess.Context, betaBuildStrategy, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return toAlpha[shipwrightBuild.BuildStrategy](kubeAccess.Context, result)
+}
+
+func deleteBuildStrategyObject(kubeAccess KubeAccess, namespace string, name string, deleteOptions metav1.DeleteOptions) error {
+	if kubeAccess.ShipwrightAPIVersion != APIVersionV1Beta1 {
+		return kubeAccess.BuildClient.ShipwrightV1alpha1().BuildStrategies(namespace).Delete(kubeAccess.Context, name, deleteOptions)
+	}
+
+	return kubeAccess.BuildClient.ShipwrightV1beta1().BuildStrategies(namespace).Delete(kubeAccess.Context, name, deleteOptions)
+}
+
+func listBuildStrategyNames(kubeAccess KubeAccess, namespace string) ([]string, error) {
+	var names = []string{}
+
+	if kubeAccess.ShipwrightAPIVersion != APIVersionV1Beta1 {
+		list, err := kubeAccess.BuildClient.ShipwrightV1alpha1().BuildStrategies(namespace).List(kubeAccess.Context, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range list.Items {
+			names = append(names, entry.GetName())
+		}
+
+		return names, nil
+	}
+
+	list, err := kubeAccess.BuildClient.ShipwrightV1beta1().BuildStrategies(namespace).List(kubeAccess.Context, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range list.Items {
+		names = append(names, entry.GetName())
+	}
+
+	return names, nil
+}
+
+func getClusterBuildStrategy(kubeAccess KubeAccess, name string) (*shipwrightBuild.ClusterBuildStrategy, error) {
+	if kubeAccess.ShipwrightAPIVersion != APIVersionV1Beta1 {
+		return kubeAccess.BuildClient.ShipwrightV1alpha1().ClusterBuildStrategies().Get(kubeAccess.Context, name, metav1.GetOptions{})
+	}
+
+	clusterBuildStrategy, err := kubeAccess.BuildClient.ShipwrightV1beta1().ClusterBuildStrategies().Get(kubeAccess.Context, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return toAlpha[shipwrightBuild.ClusterBuildStrategy](kubeAccess.Context, clusterBuildStrategy)
+}
+
+func listClusterBuildStrategyNames(kubeAccess KubeAccess) ([]string, error) {
+	var names = []string{}
+
+	if kubeAccess.ShipwrightAPIVersion != APIVersionV1Beta1 {
+		list, err := kubeAccess.BuildClient.ShipwrightV1alpha1().ClusterBuildStrategies().List(kubeAccess.Context, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range list.Items {
+			names = append(names, entry.GetName())
+		}
+
+		return names, nil
+	}
+
+	list, err := kubeAccess.BuildClient.ShipwrightV1beta1().ClusterBuildStrategies().List(kubeAccess.Context, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range list.Items {
+		names = append(names, entry.GetName())
+	}
+
+	return names, nil
+}
@@ -0,0 +1,417 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gonvenience/bunt"
+	"github.com/gonvenience/neat"
+	"github.com/gonvenience/text"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// rateLimiterDelay is the wait time for the client-side rate limiter from
+// which on a request counts as delayed
+const rateLimiterDelay = time.Millisecond
+
+// APIMetrics records the latency of all requests to the Kubernetes API
+// server by verb and resource, the responses that indicate throttling or
+// server errors, and the time requests wait for the client-side rate limiter
+type APIMetrics struct {
+	sync.Mutex
+	requests    map[apiRequestKey]*apiRequestRecord
+	waits       int
+	delayed     int
+	waitTotal   time.Duration
+	waitMaximum time.Duration
+	qps         float32
+	burst       int
+}
+
+type apiRequestKey struct {
+	verb     string
+	resource string
+}
+
+type apiRequestRecord struct {
+	latencies    []time.Duration
+	throttled    int
+	serverErrors int
+}
+
+// APIRequestStats are the statistics of the requests with the same verb and
+// resource
+type APIRequestStats struct {
+	Verb         string
+	Resource     string
+	Count        int
+	Mean         time.Duration
+	P95          time.Duration
+	Maximum      time.Duration
+	Throttled    int
+	ServerErrors int
+}
+
+// APIStats are the statistics of all requests to the Kubernetes API server
+// since the API metrics were last reset
+type APIStats struct {
+	Requests           []APIRequestStats
+	RateLimiterWaits   int
+	RateLimiterDelayed int
+	RateLimiterTotal   time.Duration
+	RateLimiterMaximum time.Duration
+	QPS                float32
+	Burst              int
+}
+
+// NewAPIMetrics creates empty API metrics
+func NewAPIMetrics() *APIMetrics {
+	return &APIMetrics{requests: map[apiRequestKey]*apiRequestRecord{}}
+}
+
+// Instrument returns a copy of the REST config with a wrapped transport that
+// records every request, and a rate limiter that records the time spent
+// waiting for it
+func (metrics *APIMetrics) Instrument(restConfig *rest.Config) *rest.Config {
+	var config = rest.CopyConfig(restConfig)
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &apiMetricsTransport{metrics: metrics, next: rt}
+	})
+
+	// every client gets its own rate limiter, like it would get from the
+	// REST config without an explicit rate limiter
+	config.RateLimiter = &apiMetricsRateLimiter{
+		RateLimiter: flowcontrol.NewTokenBucketRateLimiter(config.QPS, config.Burst),
+		metrics:     metrics,
+	}
+
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.qps, metrics.burst = config.QPS, config.Burst
+
+	return config
+}
+
+// Reset drops all recorded requests and rate limiter waits
+func (metrics *APIMetrics) Reset() {
+	if metrics == nil {
+		return
+	}
+
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.requests = map[apiRequestKey]*apiRequestRecord{}
+	metrics.waits, metrics.delayed = 0, 0
+	metrics.waitTotal, metrics.waitMaximum = 0, 0
+}
+
+// Stats returns the statistics of the recorded requests, sorted by verb and
+// resource
+func (metrics *APIMetrics) Stats() APIStats {
+	if metrics == nil {
+		return APIStats{}
+	}
+
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	var stats = APIStats{
+		RateLimiterWaits:   metrics.waits,
+		RateLimiterDelayed: metrics.delayed,
+		RateLimiterTotal:   metrics.waitTotal,
+		RateLimiterMaximum: metrics.waitMaximum,
+		QPS:                metrics.qps,
+		Burst:              metrics.burst,
+	}
+
+	for key, record := range metrics.requests {
+		var latencies = make([]time.Duration, len(record.latencies))
+		copy(latencies, record.latencies)
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+		var sum time.Duration
+		for _, latency := range latencies {
+			sum += latency
+		}
+
+		stats.Requests = append(stats.Requests, APIRequestStats{
+			Verb:         key.verb,
+			Resource:     key.resource,
+			Count:        len(latencies),
+			Mean:         sum / time.Duration(len(latencies)),
+			P95:          latencies[(len(latencies)*95+99)/100-1],
+			Maximum:      latencies[len(latencies)-1],
+			Throttled:    record.throttled,
+			ServerErrors: record.serverErrors,
+		})
+	}
+
+	sort.Slice(stats.Requests, func(i, j int) bool {
+		if stats.Requests[i].Resource != stats.Requests[j].Resource {
+			return stats.Requests[i].Resource < stats.Requests[j].Resource
+		}
+
+		return stats.Requests[i].Verb < stats.Requests[j].Verb
+	})
+
+	return stats
+}
+
+func (metrics *APIMetrics) observeRequest(req *http.Request, statusCode int, latency time.Duration) {
+	var key = apiRequestKey{}
+	key.verb, key.resource = requestVerbAndResource(req)
+
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	record, ok := metrics.requests[key]
+	if !ok {
+		record = &apiRequestRecord{}
+		metrics.requests[key] = record
+	}
+
+	record.latencies = append(record.latencies, latency)
+
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		record.throttled++
+
+	case statusCode >= 500:
+		record.serverErrors++
+	}
+}
+
+func (metrics *APIMetrics) observeWait(wait time.Duration) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	metrics.waits++
+	metrics.waitTotal += wait
+	if wait >= rateLimiterDelay {
+		metrics.delayed++
+	}
+
+	if wait > metrics.waitMaximum {
+		metrics.waitMaximum = wait
+	}
+}
+
+type apiMetricsTransport struct {
+	metrics *APIMetrics
+	next    http.RoundTripper
+}
+
+func (transport *apiMetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var start = time.Now()
+	resp, err := transport.next.RoundTrip(req)
+
+	// for watches, the latency is the time until the response header
+	var statusCode int
+	if resp != nil {
+		statusCode = resp.StatusCode
+	}
+
+	transport.metrics.observeRequest(req, statusCode, time.Since(start))
+	return resp, err
+}
+
+type apiMetricsRateLimiter struct {
+	flowcontrol.RateLimiter
+	metrics *APIMetrics
+}
+
+func (rateLimiter *apiMetricsRateLimiter) Accept() {
+	var start = time.Now()
+	rateLimiter.RateLimiter.Accept()
+	rateLimiter.metrics.observeWait(time.Since(start))
+}
+
+func (rateLimiter *apiMetricsRateLimiter) Wait(ctx context.Context) error {
+	var start = time.Now()
+	err := rateLimiter.RateLimiter.Wait(ctx)
+	rateLimiter.metrics.observeWait(time.Since(start))
+	return err
+}
+
+// requestVerbAndResource derives the Kubernetes verb and the resource from
+// the request, for example list and buildruns.shipwright.io, requests that
+// are not for resources, like discovery, use their path as the resource
+func requestVerbAndResource(req *http.Request) (string, string) {
+	var parts = strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+	var group string
+	switch {
+	case len(parts) > 2 && parts[0] == "api":
+		parts = parts[2:]
+
+	case len(parts) > 3 && parts[0] == "apis":
+		group, parts = parts[1], parts[3:]
+
+	default:
+		return strings.ToLower(req.Method), req.URL.Path
+	}
+
+	if len(parts) > 2 && parts[0] == "namespaces" {
+		parts = parts[2:]
+	}
+
+	var resource, name = parts[0], ""
+	if len(parts) > 1 {
+		name = parts[1]
+	}
+
+	if len(parts) > 2 {
+		resource = resource + "/" + parts[2]
+	}
+
+	if group != "" {
+		resource = resource + "." + group
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		switch {
+		case req.URL.Query().Get("watch") == "true" || req.URL.Query().Get("watch") == "1":
+			return "watch", resource
+
+		case name != "":
+			return "get", resource
+
+		default:
+			return "list", resource
+		}
+
+	case http.MethodPost:
+		return "create", resource
+
+	case http.MethodPut:
+		return "update", resource
+
+	case http.MethodPatch:
+		return "patch", resource
+
+	case http.MethodDelete:
+		if name == "" {
+			return "deletecollection", resource
+		}
+
+		return "delete", resource
+
+	default:
+		return strings.ToLower(req.Method), resource
+	}
+}
+
+// Table lists the statistics of the requests by verb and resource
+func (stats APIStats) Table() [][]string {
+	var tableData = [][]string{{"Verb", "Resource", "Requests", "Mean", "p95", "Max", "429", "5xx"}}
+	for _, request := range stats.Requests {
+		tableData = append(tableData, []string{
+			request.Verb,
+			request.Resource,
+			strconv.Itoa(request.Count),
+			request.Mean.Round(time.Millisecond).String(),
+			request.P95.Round(time.Millisecond).String(),
+			request.Maximum.Round(time.Millisecond).String(),
+			strconv.Itoa(request.Throttled),
+			strconv.Itoa(request.ServerErrors),
+		})
+	}
+
+	return tableData
+}
+
+func (stats APIStats) totals() (requests int, throttled int, serverErrors int) {
+	for _, request := range stats.Requests {
+		requests += request.Count
+		throttled += request.Throttled
+		serverErrors += request.ServerErrors
+	}
+
+	return requests, throttled, serverErrors
+}
+
+// Entries lists the totals of all requests and the client-side rate limiter
+// as name and value pairs
+func (stats APIStats) Entries() [][]string {
+	var requests, throttled, serverErrors = stats.totals()
+	return [][]string{
+		{"requests", strconv.Itoa(requests)},
+		{"throttled by the API server (429)", strconv.Itoa(throttled)},
+		{"server errors (5xx)", strconv.Itoa(serverErrors)},
+		{"client-side rate limit", fmt.Sprintf("%v QPS, %d burst", stats.QPS, stats.Burst)},
+		{"requests delayed by the rate limiter", fmt.Sprintf("%d of %d", stats.RateLimiterDelayed, stats.RateLimiterWaits)},
+		{"rate limiter wait time", stats.RateLimiterTotal.Round(time.Millisecond).String()},
+		{"max rate limiter wait time", stats.RateLimiterMaximum.Round(time.Millisecond).String()},
+	}
+}
+
+// APIStatsReport renders the statistics of the requests to the Kubernetes API
+// server and points out whether the API server or the client-side rate
+// limiter slowed down the requests
+func APIStatsReport(stats APIStats) string {
+	if len(stats.Requests) == 0 {
+		return "No Kubernetes API requests during the run.\n"
+	}
+
+	var tableData = stats.Table()
+	for i := range tableData[0] {
+		tableData[0][i] = bunt.Sprintf("*%s*", tableData[0][i])
+	}
+
+	table, err := neat.Table(tableData, neat.AlignRight(2, 3, 4, 5, 6, 7), neat.CustomSeparator(bunt.Sprintf(" DimGray{│} ")))
+	if err != nil {
+		panic(err)
+	}
+
+	var summaryData = [][]string{}
+	for _, entry := range stats.Entries() {
+		summaryData = append(summaryData, []string{bunt.Sprintf("*%s*", entry[0]), entry[1]})
+	}
+
+	summary, err := neat.Table(summaryData, neat.CustomSeparator(bunt.Sprintf(" DimGray{│} ")))
+	if err != nil {
+		panic(err)
+	}
+
+	var out strings.Builder
+	out.WriteString(bunt.Sprintf("Kubernetes API requests during the run:\n%s\n%s\n", table, summary))
+
+	if _, throttled, _ := stats.totals(); throttled > 0 {
+		out.WriteString(bunt.Sprintf("DarkOrange{*Note:*} the API server throttled %s, the results might be limited by the API server\n",
+			text.Plural(throttled, "request"),
+		))
+	}
+
+	if stats.RateLimiterDelayed > 0 {
+		out.WriteString(bunt.Sprintf("DarkOrange{*Note:*} %s waited %v in total for the client-side rate limiter, consider increasing --qps and --burst\n",
+			text.Plural(stats.RateLimiterDelayed, "request"),
+			stats.RateLimiterTotal.Round(time.Millisecond),
+		))
+	}
+
+	return out.String()
+}
@@ -0,0 +1,106 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+var _ = Describe("API request metrics", func() {
+	var server *httptest.Server
+	var client kubernetes.Interface
+	var apiMetrics *APIMetrics
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/api/v1/namespaces/test/pods":
+				_, _ = w.Write([]byte(`{"kind":"PodList","apiVersion":"v1","items":[]}`))
+
+			case "/api/v1/namespaces/test/secrets/throttled":
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","code":429}`))
+
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","code":500}`))
+			}
+		}))
+
+		apiMetrics = NewAPIMetrics()
+
+		var err error
+		client, err = kubernetes.NewForConfig(apiMetrics.Instrument(&rest.Config{Host: server.URL, QPS: 5, Burst: 1}))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should record requests by verb and resource with throttled and failed responses", func() {
+		_, err := client.CoreV1().Pods("test").List(context.Background(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = client.CoreV1().Secrets("test").Get(context.Background(), "throttled", metav1.GetOptions{})
+		Expect(err).To(HaveOccurred())
+
+		err = client.CoreV1().ConfigMaps("test").Delete(context.Background(), "broken", metav1.DeleteOptions{})
+		Expect(err).To(HaveOccurred())
+
+		stats := apiMetrics.Stats()
+		Expect(stats.Requests).To(HaveLen(3))
+
+		Expect(stats.Requests[0].Verb).To(Equal("delete"))
+		Expect(stats.Requests[0].Resource).To(Equal("configmaps"))
+		Expect(stats.Requests[0].ServerErrors).To(Equal(1))
+
+		Expect(stats.Requests[1].Verb).To(Equal("list"))
+		Expect(stats.Requests[1].Resource).To(Equal("pods"))
+		Expect(stats.Requests[1].Count).To(Equal(1))
+
+		Expect(stats.Requests[2].Verb).To(Equal("get"))
+		Expect(stats.Requests[2].Resource).To(Equal("secrets"))
+		Expect(stats.Requests[2].Throttled).To(Equal(1))
+
+		// with a burst of one, the rate limiter has to delay requests
+		Expect(stats.RateLimiterWaits).To(BeNumerically(">=", 3))
+		Expect(stats.RateLimiterDelayed).To(BeNumerically(">=", 1))
+		Expect(APIStatsReport(stats)).To(ContainSubstring("the API server throttled one request"))
+	})
+
+	It("should drop all recorded requests on reset", func() {
+		_, err := client.CoreV1().Pods("test").List(context.Background(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		apiMetrics.Reset()
+		Expect(apiMetrics.Stats().Requests).To(BeEmpty())
+		Expect(apiMetrics.Stats().RateLimiterWaits).To(BeZero())
+	})
+})
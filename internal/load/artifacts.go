@@ -0,0 +1,282 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gonvenience/bunt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"sigs.k8s.io/yaml"
+
+	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+)
+
+// Reasons why the artifacts of a buildrun are collected
+const (
+	ArtifactsFailed = "failed"
+	ArtifactsSlow   = "slow"
+)
+
+const artifactsIndexFile = "index.yaml"
+
+// ArtifactCollector writes the objects, container logs, and events of failed
+// or slow buildruns into a directory, so that they can be attached to bug
+// reports, an index file lists all collected buildruns
+type ArtifactCollector struct {
+	dir       string
+	threshold time.Duration
+
+	sync.Mutex
+	index       []ArtifactIndexEntry
+	directories map[string]struct{}
+}
+
+// ArtifactIndexEntry describes the collected artifacts of one buildrun
+type ArtifactIndexEntry struct {
+	Namespace string   `json:"namespace"`
+	BuildRun  string   `json:"buildRun"`
+	Reason    string   `json:"reason"`
+	Duration  string   `json:"duration,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	Directory string   `json:"directory"`
+	Files     []string `json:"files"`
+}
+
+// NewArtifactCollector creates the artifacts directory, buildruns that take
+// longer than the threshold are collected as slow, in case the threshold is
+// greater than zero
+func NewArtifactCollector(dir string, threshold time.Duration) (*ArtifactCollector, error) {
+	if err := os.MkdirAll(dir, os.FileMode(0755)); err != nil {
+		return nil, fmt.Errorf("failed to create artifacts directory: %w", err)
+	}
+
+	return &ArtifactCollector{dir: dir, threshold: threshold, directories: map[string]struct{}{}}, nil
+}
+
+// Index returns the entries of all buildruns with collected artifacts
+func (collector *ArtifactCollector) Index() []ArtifactIndexEntry {
+	if collector == nil {
+		return nil
+	}
+
+	collector.Lock()
+	defer collector.Unlock()
+	return append([]ArtifactIndexEntry{}, collector.index...)
+}
+
+// IndexFile returns the path of the index file
+func (collector *ArtifactCollector) IndexFile() string {
+	return filepath.Join(collector.dir, artifactsIndexFile)
+}
+
+// collectFailed writes the artifacts of a buildrun that failed
+func (collector *ArtifactCollector) collectFailed(kubeAccess KubeAccess, namespace string, name string, failure error) {
+	if collector == nil {
+		return
+	}
+
+	collector.collect(kubeAccess.forCleanup(), ArtifactIndexEntry{
+		Namespace: namespace,
+		BuildRun:  name,
+		Reason:    ArtifactsFailed,
+		Error:     firstLine(bunt.RemoveAllEscapeSequences(failure.Error())),
+	}, failure)
+}
+
+// collectSlow writes the artifacts of a buildrun in case it took longer
+// than the threshold
+func (collector *ArtifactCollector) collectSlow(kubeAccess KubeAccess, namespace string, name string, completionTime time.Duration) {
+	if collector == nil || collector.threshold <= 0 || completionTime <= collector.threshold {
+		return
+	}
+
+	collector.collect(kubeAccess, ArtifactIndexEntry{
+		Namespace: namespace,
+		BuildRun:  name,
+		Reason:    ArtifactsSlow,
+		Duration:  completionTime.Round(time.Second).String(),
+	}, nil)
+}
+
+func (collector *ArtifactCollector) collect(kubeAccess KubeAccess, entry ArtifactIndexEntry, failure error) {
+	entry.Directory = collector.directoryOf(entry.Namespace, entry.BuildRun)
+
+	var dir = filepath.Join(collector.dir, entry.Directory)
+	if err := os.MkdirAll(filepath.Join(dir, "logs"), os.FileMode(0755)); err != nil {
+		warn("failed to create artifacts directory of buildrun %s: %v", entry.BuildRun, err)
+		return
+	}
+
+	var write = func(name string, content []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), content, os.FileMode(0644)); err != nil {
+			warn("failed to write artifact %s of buildrun %s: %v", name, entry.BuildRun, err)
+			return
+		}
+
+		entry.Files = append(entry.Files, filepath.ToSlash(filepath.Join(entry.Directory, name)))
+	}
+
+	var writeYAML = func(name string, obj interface{}) {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			warn("failed to render artifact %s of buildrun %s: %v", name, entry.BuildRun, err)
+			return
+		}
+
+		write(name, data)
+	}
+
+	if failure != nil {
+		write("error.txt", []byte(bunt.RemoveAllEscapeSequences(failure.Error())+"\n"))
+	}
+
+	var names = []string{entry.BuildRun}
+
+	buildRun, err := getBuildRun(kubeAccess, entry.Namespace, entry.BuildRun)
+	if err != nil {
+		warn("failed to look up buildrun %s for its artifacts: %v", entry.BuildRun, err)
+	}
+
+	if buildRun != nil {
+		buildRun.ManagedFields = nil
+		buildRun.TypeMeta = metav1.TypeMeta{APIVersion: shipwrightBuild.SchemeGroupVersion.String(), Kind: "BuildRun"}
+		writeYAML("buildrun.yaml", buildRun)
+
+		if buildRun.Spec.BuildRef != nil {
+			if build, err := getBuild(kubeAccess, entry.Namespace, buildRun.Spec.BuildRef.Name); err == nil {
+				build.ManagedFields = nil
+				build.TypeMeta = metav1.TypeMeta{APIVersion: shipwrightBuild.SchemeGroupVersion.String(), Kind: "Build"}
+				writeYAML("build.yaml", build)
+				names = append(names, build.Name)
+			}
+		}
+
+		taskRun, pod := lookUpTaskRunAndPod(kubeAccess, *buildRun)
+		if taskRun != nil {
+			taskRun.ManagedFields = nil
+			taskRun.TypeMeta = metav1.TypeMeta{APIVersion: "tekton.dev/v1beta1", Kind: "TaskRun"}
+			writeYAML("taskrun.yaml", taskRun)
+			names = append(names, taskRun.Name)
+		}
+
+		if pod != nil {
+			pod.ManagedFields = nil
+			pod.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"}
+			writeYAML("pod.yaml", pod)
+			names = append(names, pod.Name)
+
+			for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+				logs, err := podLogs(kubeAccess, pod.Namespace, pod.Name, container.Name)
+				if err != nil {
+					debug("failed to get logs of container %s of pod %s: %v", container.Name, pod.Name, err)
+					continue
+				}
+
+				write(filepath.Join("logs", container.Name+".log"), logs)
+			}
+		}
+	}
+
+	var events strings.Builder
+	for _, event := range objectEvents(kubeAccess, entry.Namespace, names) {
+		fmt.Fprintf(&events, "%s\n", event)
+	}
+
+	write("events.txt", []byte(events.String()))
+
+	collector.Lock()
+	defer collector.Unlock()
+
+	collector.index = append(collector.index, entry)
+	sort.SliceStable(collector.index, func(i, j int) bool { return collector.index[i].Directory < collector.index[j].Directory })
+
+	// the index is rewritten after each buildrun, so that it is complete
+	// even in case the run is interrupted
+	data, err := yaml.Marshal(collector.index)
+	if err == nil {
+		err = os.WriteFile(collector.IndexFile(), data, os.FileMode(0644))
+	}
+
+	if err != nil {
+		warn("failed to write artifacts index: %v", err)
+	}
+}
+
+// directoryOf returns the relative directory for the artifacts of the
+// buildrun, a suffix is added in case the same buildrun was collected before,
+// for example when a test plan step is retried, the directory is reserved
+// right away, so that buildruns collected concurrently do not share it
+func (collector *ArtifactCollector) directoryOf(namespace string, name string) string {
+	collector.Lock()
+	defer collector.Unlock()
+
+	var dir = filepath.ToSlash(filepath.Join(namespace, name))
+	for i := 2; ; i++ {
+		if _, ok := collector.directories[dir]; !ok {
+			collector.directories[dir] = struct{}{}
+			return dir
+		}
+
+		dir = filepath.ToSlash(filepath.Join(namespace, fmt.Sprintf("%s-%d", name, i)))
+	}
+}
+
+// objectEvents returns the events of the objects with the given names, from
+// the event recorder if it is used, otherwise from the API server
+func objectEvents(kubeAccess KubeAccess, namespace string, names []string) []RecordedEvent {
+	if kubeAccess.Events != nil {
+		kubeAccess.Events.Lock()
+		defer kubeAccess.Events.Unlock()
+		return kubeAccess.Events.eventsOf(namespace, names...)
+	}
+
+	var events = []RecordedEvent{}
+	for _, name := range names {
+		list, err := kubeAccess.Client.CoreV1().Events(namespace).List(kubeAccess.Context, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("involvedObject.name", name).String(),
+		})
+
+		if err != nil {
+			debug("failed to list events of %s: %v", name, err)
+			continue
+		}
+
+		for _, event := range list.Items {
+			events = append(events, newRecordedEvent(event))
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if idx := strings.IndexByte(s, '\n'); idx >= 0 {
+		return s[:idx]
+	}
+
+	return s
+}
@@ -0,0 +1,261 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+
+	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+	buildfake "github.com/shipwright-io/build/pkg/client/clientset/versioned/fake"
+	tektonPipeline "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+)
+
+var _ = Describe("failure artifacts", func() {
+	It("should create the artifacts directory with an empty index", func() {
+		var dir = filepath.Join(GinkgoT().TempDir(), "artifacts", "run")
+
+		collector, err := NewArtifactCollector(dir, time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dir).To(BeADirectory())
+		Expect(collector.Index()).To(BeEmpty())
+		Expect(collector.IndexFile()).To(Equal(filepath.Join(dir, "index.yaml")))
+	})
+
+	It("should fail in case the artifacts directory cannot be created", func() {
+		var file = filepath.Join(GinkgoT().TempDir(), "file")
+		Expect(os.WriteFile(file, []byte{}, os.FileMode(0644))).To(Succeed())
+
+		_, err := NewArtifactCollector(filepath.Join(file, "artifacts"), 0)
+		Expect(err).To(MatchError(ContainSubstring("failed to create artifacts directory")))
+	})
+
+	It("should report no artifacts when no collector is configured", func() {
+		var collector *ArtifactCollector
+		Expect(collector.Index()).To(BeEmpty())
+	})
+
+	Context("collecting the artifacts of buildruns", func() {
+		var (
+			dir         string
+			kubeAccess  KubeAccess
+			buildClient *buildfake.Clientset
+			created     bool
+		)
+
+		var buildSpec = shipwrightBuild.BuildSpec{
+			Source:   shipwrightBuild.Source{URL: p("https://github.com/shipwright-io/sample-go")},
+			Strategy: shipwrightBuild.Strategy{Name: "kaniko", Kind: p(shipwrightBuild.ClusterBuildStrategyKind)},
+			Output:   shipwrightBuild.Image{Image: "registry.example.com/test"},
+		}
+
+		// completeBuildRun lets the buildrun complete as soon as it is looked
+		// up after its creation, with the given duration and status
+		var completeBuildRun = func(duration time.Duration, status corev1.ConditionStatus, taskRun *string) {
+			buildClient.PrependReactor("get", "buildruns", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if !created {
+					return false, nil, nil
+				}
+
+				var now = metav1.Now()
+				return true, &shipwrightBuild.BuildRun{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "test-0", CreationTimestamp: metav1.NewTime(now.Add(-duration))},
+					Spec:       shipwrightBuild.BuildRunSpec{BuildRef: &shipwrightBuild.BuildRef{Name: "test-0"}},
+					Status: shipwrightBuild.BuildRunStatus{
+						LatestTaskRunRef: taskRun,
+						CompletionTime:   &now,
+						Conditions: shipwrightBuild.Conditions{
+							{Type: shipwrightBuild.Succeeded, Status: status, Reason: "Failed", Message: "step-build failed"},
+						},
+					},
+				}, nil
+			})
+		}
+
+		var collector = func(threshold time.Duration) *ArtifactCollector {
+			collector, err := NewArtifactCollector(dir, threshold)
+			Expect(err).ToNot(HaveOccurred())
+			kubeAccess.Artifacts = collector
+			return collector
+		}
+
+		var index = func() []ArtifactIndexEntry {
+			data, err := os.ReadFile(filepath.Join(dir, "index.yaml"))
+			Expect(err).ToNot(HaveOccurred())
+
+			var entries []ArtifactIndexEntry
+			Expect(yaml.Unmarshal(data, &entries)).To(Succeed())
+			return entries
+		}
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+			created = false
+
+			buildClient = buildfake.NewSimpleClientset()
+			buildClient.PrependReactor("create", "buildruns", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				created = true
+				return false, nil, nil
+			})
+
+			kubeAccess = KubeAccess{
+				Context:        context.Background(),
+				CleanupContext: context.Background(),
+				Client: fake.NewSimpleClientset(
+					&corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "test-0-x7k2p-pod"},
+						Spec: corev1.PodSpec{
+							InitContainers: []corev1.Container{{Name: "prepare"}},
+							Containers:     []corev1.Container{{Name: "step-build"}},
+						},
+					},
+					&corev1.Event{
+						ObjectMeta:     metav1.ObjectMeta{Namespace: "test", Name: "test-0-x7k2p-pod.backoff"},
+						InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "test", Name: "test-0-x7k2p-pod"},
+						Type:           corev1.EventTypeWarning,
+						Reason:         "BackOff",
+						Message:        "Back-off pulling image",
+						Count:          1,
+					},
+				),
+				BuildClient: buildClient,
+				TektonClient: tektonfake.NewSimpleClientset(&tektonPipeline.TaskRun{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "test-0-x7k2p"},
+					Status: tektonPipeline.TaskRunStatus{
+						TaskRunStatusFields: tektonPipeline.TaskRunStatusFields{PodName: "test-0-x7k2p-pod"},
+					},
+				}),
+				ShipwrightAPIVersion: APIVersionV1Alpha1,
+			}
+		})
+
+		It("should write the objects, logs, events, and error of a failed buildrun", func() {
+			collector(0)
+			completeBuildRun(time.Minute, corev1.ConditionFalse, p("test-0-x7k2p"))
+
+			_, err := ExecuteSingleBuildRun(kubeAccess, "test", "test-0", buildSpec, nil, SkipDelete(true))
+			Expect(err).To(HaveOccurred())
+
+			var buildRunDir = filepath.Join(dir, "test", "test-0")
+			for _, file := range []string{"build.yaml", "buildrun.yaml", "taskrun.yaml", "pod.yaml", "logs/prepare.log", "logs/step-build.log", "events.txt", "error.txt"} {
+				Expect(filepath.Join(buildRunDir, file)).To(BeARegularFile())
+			}
+
+			buildRun, err := os.ReadFile(filepath.Join(buildRunDir, "buildrun.yaml"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buildRun)).To(ContainSubstring("kind: BuildRun"))
+			Expect(string(buildRun)).To(ContainSubstring("latestTaskRunRef: test-0-x7k2p"))
+
+			pod, err := os.ReadFile(filepath.Join(buildRunDir, "pod.yaml"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(pod)).To(ContainSubstring("name: test-0-x7k2p-pod"))
+
+			logs, err := os.ReadFile(filepath.Join(buildRunDir, "logs", "step-build.log"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(logs).ToNot(BeEmpty())
+
+			events, err := os.ReadFile(filepath.Join(buildRunDir, "events.txt"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(events)).To(ContainSubstring("BackOff"))
+
+			failure, err := os.ReadFile(filepath.Join(buildRunDir, "error.txt"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(failure)).To(ContainSubstring("step-build failed"))
+
+			var entries = index()
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Namespace).To(Equal("test"))
+			Expect(entries[0].BuildRun).To(Equal("test-0"))
+			Expect(entries[0].Reason).To(Equal(ArtifactsFailed))
+			Expect(entries[0].Error).ToNot(BeEmpty())
+			Expect(entries[0].Directory).To(Equal("test/test-0"))
+			Expect(entries[0].Files).To(ConsistOf(
+				"test/test-0/error.txt",
+				"test/test-0/buildrun.yaml",
+				"test/test-0/build.yaml",
+				"test/test-0/taskrun.yaml",
+				"test/test-0/pod.yaml",
+				"test/test-0/logs/prepare.log",
+				"test/test-0/logs/step-build.log",
+				"test/test-0/events.txt",
+			))
+		})
+
+		It("should use a separate directory each time the same buildrun fails", func() {
+			collector(0)
+			completeBuildRun(time.Minute, corev1.ConditionFalse, p("test-0-x7k2p"))
+
+			for i := 0; i < 2; i++ {
+				created = false
+				_, err := ExecuteSingleBuildRun(kubeAccess, "test", "test-0", buildSpec, nil, SkipDelete(true))
+				Expect(err).To(HaveOccurred())
+			}
+
+			var entries = index()
+			Expect(entries).To(HaveLen(2))
+			Expect(entries[0].Directory).To(Equal("test/test-0"))
+			Expect(entries[1].Directory).To(Equal("test/test-0-2"))
+			Expect(filepath.Join(dir, "test", "test-0-2", "error.txt")).To(BeARegularFile())
+		})
+
+		It("should write the artifacts of successful buildruns that exceed the threshold", func() {
+			collector(5 * time.Minute)
+			completeBuildRun(10*time.Minute, corev1.ConditionTrue, nil)
+
+			_, err := ExecuteSingleBuildRun(kubeAccess, "test", "test-0", buildSpec, nil, SkipDelete(true))
+			Expect(err).ToNot(HaveOccurred())
+
+			var entries = index()
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Reason).To(Equal(ArtifactsSlow))
+			Expect(entries[0].Duration).To(Equal("10m0s"))
+			Expect(entries[0].Error).To(BeEmpty())
+			Expect(entries[0].Files).To(ConsistOf(
+				"test/test-0/buildrun.yaml",
+				"test/test-0/build.yaml",
+				"test/test-0/events.txt",
+			))
+		})
+
+		It("should not write the artifacts of successful buildruns within the threshold", func() {
+			var collector = collector(15 * time.Minute)
+			completeBuildRun(10*time.Minute, corev1.ConditionTrue, nil)
+
+			_, err := ExecuteSingleBuildRun(kubeAccess, "test", "test-0", buildSpec, nil, SkipDelete(true))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(collector.Index()).To(BeEmpty())
+			Expect(filepath.Join(dir, "index.yaml")).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(dir, "test")).ToNot(BeADirectory())
+		})
+	})
+})
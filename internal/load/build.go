@@ -17,6 +17,7 @@ limitations under the License.
 package load
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -50,7 +51,7 @@ func registerSingleBuild(kubeAccess KubeAccess, namespace string, name string, b
 
 	if !buildRunOptions.skipDelete {
 		defer func() {
-			if err := deleteBuild(kubeAccess, build.Namespace, build.Name, defaultDeleteOptions); err != nil {
+			if err := deleteBuild(kubeAccess.forCleanup(), build.Namespace, build.Name, defaultDeleteOptions); err != nil {
 				warn("failed to delete build %s, %v\n", name, err)
 			}
 		}()
@@ -98,8 +99,8 @@ func waitForBuildRegistered(kubeAccess KubeAccess, build *shipwrightBuild.Build)
 	)
 
 	debug("Polling every %v to wait for registration of build %s", interval, build.Name)
-	err := wait.PollImmediate(interval, timeout, func() (done bool, err error) {
-		build, err = kubeAccess.BuildClient.ShipwrightV1alpha1().Builds(namespace).Get(kubeAccess.Context, name, metav1.GetOptions{})
+	err := wait.PollUntilContextTimeout(kubeAccess.Context, interval, timeout, true, func(_ context.Context) (done bool, err error) {
+		build, err = getBuild(kubeAccess, namespace, name)
 		if err != nil {
 			return false, err
 		}
@@ -166,5 +167,5 @@ func ExecuteBuilds(kubeAccess KubeAccess, namingCfg NamingConfig, buildCfg Build
 	wg.Wait()
 	close(errors)
 
-	return buildResults, wrapErrorChanResults(errors, "failed to execute buildruns")
+	return completedResults(buildResults), wrapErrorChanResults(errors, "failed to execute buildruns")
 }
@@ -24,10 +24,8 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
 
 	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
 
@@ -38,6 +36,11 @@ import (
 type buildRunOptions struct {
 	serviceAccountName string
 	skipDelete         bool
+	embedBuildSpec     bool
+
+	// skipImageDelete is used when multiple buildruns share the same output
+	// image, which can only be deleted after the last buildrun completed
+	skipImageDelete bool
 }
 
 // BuildRunOption specifies optional settings for a buildrun
@@ -46,47 +49,47 @@ type BuildRunOption func(*buildRunOptions)
 // CheckSystemAndConfig sanity checks the cluster using the provided buildrun
 // settings to verify whether a buildrun can work and how much pressure it
 // would put onto the system
-func CheckSystemAndConfig(kubeAccess KubeAccess, buildCfg BuildConfig, parallel int) error {
-	// Check whether the configured cluster build strategy is available
-	clusterBuildStrategy, err := kubeAccess.BuildClient.ShipwrightV1alpha1().ClusterBuildStrategies().Get(kubeAccess.Context, buildCfg.ClusterBuildStrategy, metav1.GetOptions{})
+func CheckSystemAndConfig(kubeAccess KubeAccess, namingCfg NamingConfig, buildCfg BuildConfig, parallel int) error {
+	// Check whether the permissions allow to run buildruns
+	if err := checkPermissions(kubeAccess, namingCfg); err != nil {
+		return err
+	}
+
+	// Check whether the configured build strategy is available
+	buildStrategy, err := lookUpBuildStrategy(kubeAccess, namingCfg.Namespace, buildCfg)
 	if err != nil {
-		clusterBuildStrategy = nil
-
-		switch terr := err.(type) {
-		case *errors.StatusError:
-			switch terr.ErrStatus.Code {
-			case http.StatusNotFound:
-				if list, _ := kubeAccess.BuildClient.ShipwrightV1alpha1().ClusterBuildStrategies().List(kubeAccess.Context, metav1.ListOptions{}); list != nil {
-					var names = make([]string, len(list.Items))
-					for i, entry := range list.Items {
-						names[i] = entry.GetName()
-					}
-
-					if len(names) > 0 {
-						return bunt.Errorf("failed to find ClusterBuildStrategy _%s_, available strategies are: %s",
-							buildCfg.ClusterBuildStrategy,
-							strings.Join(names, "\n"),
-						)
-					}
-
-					return bunt.Errorf("failed to find ClusterBuildStrategy _%s_", buildCfg.ClusterBuildStrategy)
-				}
+		return err
+	}
 
-			case http.StatusForbidden:
-				warn("The current permissions do not allow to check whether build strategy CadetBlue{*%s*} is available.\n", buildCfg.ClusterBuildStrategy)
-			}
+	// Check whether the configured secrets and service account are usable
+	if err := checkCredentials(kubeAccess, namingCfg.Namespace, buildCfg); err != nil {
+		return err
+	}
+
+	checkExistingBuildRuns(kubeAccess)
+
+	if buildStrategy != nil {
+		var demands = []podDemand{newPodDemand(lookUpResourceEstimate(kubeAccess, namingCfg.Namespace, buildStrategy), parallel, buildStrategy.GetName(), buildCfg)}
+		if err := checkNamespacePolicies(kubeAccess, namingCfg, demands); err != nil {
+			return err
 		}
+
+		return checkResources(kubeAccess, demands)
 	}
 
-	// Given that the permissions allow it, check how many buildruns are
-	// currently in the system already
-	if buildRunsResults, err := kubeAccess.BuildClient.ShipwrightV1alpha1().BuildRuns("").List(kubeAccess.Context, metav1.ListOptions{}); err == nil {
+	return nil
+}
+
+// checkExistingBuildRuns prints how many buildruns are currently in the
+// system, given that the permissions allow it
+func checkExistingBuildRuns(kubeAccess KubeAccess) {
+	if buildRuns, err := listBuildRuns(kubeAccess, ""); err == nil {
 		var (
 			totalBuildRuns     int
 			completedBuildRuns int
 		)
 
-		for _, buildRun := range buildRunsResults.Items {
+		for _, buildRun := range buildRuns {
 			if buildRun.Status.CompletionTime != nil {
 				completedBuildRuns++
 			}
@@ -110,47 +113,64 @@ func CheckSystemAndConfig(kubeAccess KubeAccess, buildCfg BuildConfig, parallel
 			fmt.Println()
 		}
 	}
+}
 
-	if nodesResults, err := kubeAccess.Client.CoreV1().Nodes().List(kubeAccess.Context, metav1.ListOptions{}); err == nil {
-		var totalCPU int64
-		var totalMemory int64
-		for _, node := range nodesResults.Items {
-			totalCPU += node.Status.Capacity.Cpu().MilliValue()
-			totalMemory += node.Status.Capacity.Memory().Value()
-		}
+// lookUpBuildStrategy returns the configured namespaced or cluster build
+// strategy, in case the permissions do not allow to look it up, no strategy
+// and no error is returned
+func lookUpBuildStrategy(kubeAccess KubeAccess, namespace string, buildCfg BuildConfig) (shipwrightBuild.BuilderStrategy, error) {
+	var (
+		strategyName, strategyKind = buildCfg.strategy()
+
+		buildStrategy shipwrightBuild.BuilderStrategy
+		err           error
+		listNames     func() ([]string, error)
+	)
 
-		totalNodeResources := corev1.ResourceList{
-			corev1.ResourceCPU:    *resource.NewMilliQuantity(totalCPU, resource.DecimalSI),
-			corev1.ResourceMemory: *resource.NewQuantity(totalMemory, resource.BinarySI),
+	switch strategyKind {
+	case shipwrightBuild.NamespacedBuildStrategyKind:
+		var tmp *shipwrightBuild.BuildStrategy
+		if tmp, err = getBuildStrategy(kubeAccess, namespace, strategyName); err == nil {
+			buildStrategy = tmp
 		}
 
-		if clusterBuildStrategy != nil {
-			resourcesForClusterBuildStrategy := estimateResourceRequests(*clusterBuildStrategy, int64(parallel))
+		listNames = func() ([]string, error) { return listBuildStrategyNames(kubeAccess, namespace) }
 
-			scaleToString := func(q *resource.Quantity) string {
-				var mods = []string{"Byte", "KiB", "MiB", "GiB", "TiB"}
+	default:
+		var tmp *shipwrightBuild.ClusterBuildStrategy
+		if tmp, err = getClusterBuildStrategy(kubeAccess, strategyName); err == nil {
+			buildStrategy = tmp
+		}
+
+		listNames = func() ([]string, error) { return listClusterBuildStrategyNames(kubeAccess) }
+	}
 
-				tmp := float64(q.Value())
+	if err == nil {
+		return buildStrategy, nil
+	}
 
-				var i int
-				for i = 0; tmp > 1023.9 && i < len(mods); i++ {
-					tmp /= 1024.0
+	switch terr := err.(type) {
+	case *errors.StatusError:
+		switch terr.ErrStatus.Code {
+		case http.StatusNotFound:
+			if names, err := listNames(); err == nil {
+				if len(names) > 0 {
+					return nil, bunt.Errorf("failed to find %s _%s_, available strategies are: %s",
+						strategyKind,
+						strategyName,
+						strings.Join(names, "\n"),
+					)
 				}
 
-				return fmt.Sprintf("%.1f %s", tmp, mods[i])
+				return nil, bunt.Errorf("failed to find %s _%s_", strategyKind, strategyName)
 			}
 
-			bunt.Printf("With Moccasin{_%s_}, the estimated resource request will be roughly SlateGray{%v CPU cores} and LightSlateGray{%v system memory}. Available in the cluster are SlateGray{%v CPU cores} and LightSlateGray{%v system memory}.\n\n",
-				text.Plural(parallel, "concurrent buildrun"),
-				resourcesForClusterBuildStrategy.Cpu(),
-				scaleToString(resourcesForClusterBuildStrategy.Memory()),
-				totalNodeResources.Cpu(),
-				scaleToString(totalNodeResources.Memory()),
-			)
+		case http.StatusForbidden:
+			warn("The current permissions do not allow to check whether build strategy CadetBlue{*%s*} is available.\n", strategyName)
 		}
 	}
 
-	return nil
+	return nil, nil
 }
 
 // ServiceAccountName sets the service account to be used, use empty string to generate one
@@ -167,6 +187,14 @@ func SkipDelete(value bool) BuildRunOption {
 	}
 }
 
+// EmbedBuildSpec sets whether the build specification should be embedded in
+// the buildrun, which means that no separate build is created
+func EmbedBuildSpec(value bool) BuildRunOption {
+	return func(o *buildRunOptions) {
+		o.embedBuildSpec = value
+	}
+}
+
 // ExecuteSingleBuildRun executes a single buildrun based on the given settings
 func ExecuteSingleBuildRun(kubeAccess KubeAccess, namespace string, name string, buildSpec shipwrightBuild.BuildSpec, buildAnnotations map[string]string, options ...BuildRunOption) (*Result, error) {
 	var buildRunOptions = buildRunOptions{}
@@ -174,41 +202,63 @@ func ExecuteSingleBuildRun(kubeAccess KubeAccess, namespace string, name string,
 		option(&buildRunOptions)
 	}
 
-	build, err := applyBuild(kubeAccess, newBuild(namespace, name, buildSpec, buildAnnotations))
-	if err != nil {
-		return nil, err
-	}
+	var buildRunDefinition shipwrightBuild.BuildRun
+	switch {
+	case buildRunOptions.embedBuildSpec:
+		buildRunDefinition = newEmbeddedBuildRun(namespace, name, buildSpec, buildAnnotations, buildRunOptions.serviceAccountName)
 
-	if !buildRunOptions.skipDelete {
-		defer func() {
-			if err := deleteBuild(kubeAccess, build.Namespace, build.Name, defaultDeleteOptions); err != nil {
-				warn("failed to delete build %s, %v\n", name, err)
-			}
-		}()
+	default:
+		build, err := applyBuild(kubeAccess, newBuild(namespace, name, buildSpec, buildAnnotations))
+		if err != nil {
+			return nil, err
+		}
+
+		if !buildRunOptions.skipDelete {
+			defer func() {
+				if err := deleteBuild(kubeAccess.forCleanup(), build.Namespace, build.Name, defaultDeleteOptions); err != nil {
+					warn("failed to delete build %s, %v\n", name, err)
+				}
+			}()
+		}
+
+		buildRunDefinition = newBuildRun(name, *build, buildRunOptions.serviceAccountName)
 	}
 
-	buildRun, err := applyBuildRun(kubeAccess, newBuildRun(name, *build, buildRunOptions.serviceAccountName))
+	return runBuildRun(kubeAccess, buildRunDefinition, buildSpec.Output.Credentials, buildRunOptions)
+}
+
+// runBuildRun creates the buildrun, waits for its completion, and collects
+// the timing results before the buildrun is deleted again
+func runBuildRun(kubeAccess KubeAccess, buildRunDefinition shipwrightBuild.BuildRun, outputCredentials *corev1.LocalObjectReference, buildRunOptions buildRunOptions) (*Result, error) {
+	var (
+		namespace = buildRunDefinition.Namespace
+		name      = buildRunDefinition.Name
+	)
+
+	buildRun, err := applyBuildRun(kubeAccess, buildRunDefinition)
 	if err != nil {
 		return nil, err
 	}
 
 	if !buildRunOptions.skipDelete {
 		defer func() {
-			if err := deleteBuildRun(kubeAccess, buildRun.Namespace, buildRun.Name, defaultDeleteOptions); err != nil {
+			if err := deleteBuildRun(kubeAccess.forCleanup(), namespace, name, defaultDeleteOptions); err != nil {
 				warn("failed to delete buildrun %s, %v\n", name, err)
 			}
 		}()
 	}
 
 	buildRun, err = waitForBuildRunCompletion(kubeAccess, buildRun)
+	kubeAccess.Events.attach(buildRun)
 	if err != nil {
+		kubeAccess.Artifacts.collectFailed(kubeAccess, namespace, name, err)
 		return nil, fmt.Errorf("failed while waiting for buildrun completion: %w", err)
 	}
 
-	if !buildRunOptions.skipDelete {
+	if !buildRunOptions.skipDelete && !buildRunOptions.skipImageDelete {
 		defer func() {
 			debug("Delete container image %s", buildRun.Status.BuildSpec.Output.Image)
-			if err := deleteContainerImage(kubeAccess, buildRun.Namespace, build.Spec.Output.Credentials, buildRun.Status.BuildSpec.Output.Image); err != nil {
+			if err := deleteContainerImage(kubeAccess.forCleanup(), buildRun.Namespace, outputCredentials, buildRun.Status.BuildSpec.Output.Image); err != nil {
 				warn("failed to delete image %s, %v\n", buildRun.Status.BuildSpec.Output.Image, err)
 			}
 		}()
@@ -262,6 +312,8 @@ func ExecuteSingleBuildRun(kubeAccess KubeAccess, namespace string, name string,
 		)
 	}
 
+	kubeAccess.Artifacts.collectSlow(kubeAccess, namespace, name, buildRunResult.ValueOf(BuildrunCompletionTime))
+
 	debug("buildrun _%s/%s_ results: %v",
 		namespace,
 		name,
@@ -272,7 +324,8 @@ func ExecuteSingleBuildRun(kubeAccess KubeAccess, namespace string, name string,
 }
 
 // ExecuteParallelBuildRuns executes the same buildrun multiple times in
-// parallel
+// parallel, in case of errors, the results of the buildruns that did
+// complete are returned alongside the error
 func ExecuteParallelBuildRuns(kubeAccess KubeAccess, namingCfg NamingConfig, buildCfg BuildConfig, parallel int) ([]Result, error) {
 	var errors = make(chan error, parallel)
 	var wg sync.WaitGroup
@@ -301,6 +354,7 @@ func ExecuteParallelBuildRuns(kubeAccess KubeAccess, namingCfg NamingConfig, bui
 				buildAnnotations,
 				ServiceAccountName(buildCfg.ServiceAccountName),
 				SkipDelete(buildCfg.SkipDelete),
+				EmbedBuildSpec(buildCfg.EmbedBuildSpec),
 			)
 
 			if err != nil {
@@ -315,18 +369,148 @@ func ExecuteParallelBuildRuns(kubeAccess KubeAccess, namingCfg NamingConfig, bui
 	wg.Wait()
 	close(errors)
 
-	return buildRunResults, wrapErrorChanResults(errors, "failed to execute buildruns")
+	return completedResults(buildRunResults), wrapErrorChanResults(errors, "failed to execute buildruns")
+}
+
+// ExecuteBuildRunsPerBuild creates the given number of builds in parallel
+// and runs multiple buildruns for each of these builds, either one after
+// another or concurrently, in case of errors, the results of the buildruns
+// that did complete are returned alongside the error
+func ExecuteBuildRunsPerBuild(kubeAccess KubeAccess, namingCfg NamingConfig, buildCfg BuildConfig, builds int, buildRunsPerBuild int, sequential bool) ([]BuildResults, error) {
+	var errors = make(chan error, builds*buildRunsPerBuild)
+	var wg sync.WaitGroup
+	wg.Add(builds)
+
+	var buildResults = make([]BuildResults, builds)
+	for i := 0; i < builds; i++ {
+		go func(idx int) {
+			defer wg.Done()
+
+			namespace, name := createNamespaceAndName(namingCfg, buildCfg, idx)
+			buildResults[idx].BuildName = name
+
+			buildSpec, err := createBuildSpec(name, buildCfg)
+			if err != nil {
+				errors <- err
+				return
+			}
+
+			results, numbers, err := executeBuildRunsForBuild(kubeAccess, namespace, name, *buildSpec, createBuildAnnotations(buildCfg), buildCfg, buildRunsPerBuild, sequential)
+			if err != nil {
+				errors <- err
+			}
+
+			buildResults[idx].Results = results
+			buildResults[idx].BuildRunNumbers = numbers
+		}(i)
+	}
+
+	wg.Wait()
+	close(errors)
+
+	var completed = []BuildResults{}
+	for _, buildResult := range buildResults {
+		if len(buildResult.Results) > 0 {
+			completed = append(completed, buildResult)
+		}
+	}
+
+	return completed, wrapErrorChanResults(errors, "failed to execute buildruns")
+}
+
+// executeBuildRunsForBuild creates one build and runs the given number of
+// buildruns against it, since all buildruns push to the same output image,
+// the image is deleted only once after the last buildrun, next to the
+// results of the completed buildruns, their numbers are returned
+func executeBuildRunsForBuild(kubeAccess KubeAccess, namespace string, name string, buildSpec shipwrightBuild.BuildSpec, buildAnnotations map[string]string, buildCfg BuildConfig, buildRunsPerBuild int, sequential bool) ([]Result, []int, error) {
+	build, err := applyBuild(kubeAccess, newBuild(namespace, name, buildSpec, buildAnnotations))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var buildRunOptions = buildRunOptions{
+		serviceAccountName: buildCfg.ServiceAccountName,
+		skipDelete:         buildCfg.SkipDelete,
+		skipImageDelete:    true,
+	}
+
+	if !buildCfg.SkipDelete {
+		defer func() {
+			if err := deleteBuild(kubeAccess.forCleanup(), build.Namespace, build.Name, defaultDeleteOptions); err != nil {
+				warn("failed to delete build %s, %v\n", name, err)
+			}
+
+			debug("Delete container image %s", buildSpec.Output.Image)
+			if err := deleteContainerImage(kubeAccess.forCleanup(), namespace, buildSpec.Output.Credentials, buildSpec.Output.Image); err != nil {
+				warn("failed to delete image %s, %v\n", buildSpec.Output.Image, err)
+			}
+		}()
+	}
+
+	var errors = make(chan error, buildRunsPerBuild)
+	var results = make([]Result, buildRunsPerBuild)
+	var runSingle = func(idx int) {
+		buildRunDefinition := newBuildRun(fmt.Sprintf("%s-%d", name, idx), *build, buildRunOptions.serviceAccountName)
+
+		result, err := runBuildRun(kubeAccess, buildRunDefinition, buildSpec.Output.Credentials, buildRunOptions)
+		if err != nil {
+			errors <- err
+			return
+		}
+
+		results[idx] = *result
+	}
+
+	switch {
+	case sequential:
+		for j := 0; j < buildRunsPerBuild && !kubeAccess.Interrupted(); j++ {
+			runSingle(j)
+		}
+
+	default:
+		var wg sync.WaitGroup
+		wg.Add(buildRunsPerBuild)
+		for j := 0; j < buildRunsPerBuild; j++ {
+			go func(idx int) {
+				defer wg.Done()
+				runSingle(idx)
+			}(j)
+		}
+
+		wg.Wait()
+	}
+
+	close(errors)
+
+	var completed, numbers = []Result{}, []int{}
+	for idx, result := range results {
+		if len(result) > 0 {
+			completed = append(completed, result)
+			numbers = append(numbers, idx+1)
+		}
+	}
+
+	return completed, numbers, wrapErrorChanResults(errors, "failed to execute buildruns of build %s", name)
 }
 
 // ExecuteSeriesOfParallelBuildRuns executes a series of parallel buildruns
-// increasing the number of parallel buildruns with each interation
+// increasing the number of parallel buildruns with each interation, in case
+// of errors, the result sets of the completed iterations are returned
+// alongside the error
 func ExecuteSeriesOfParallelBuildRuns(kubeAccess KubeAccess, namingCfg NamingConfig, buildCfg BuildConfig, start int, end int, increment int) ([]ResultSet, error) {
 	var results = []ResultSet{}
 
 	for parallelBuilds := start; parallelBuilds <= end; parallelBuilds += increment {
 		buildRunResults, err := ExecuteParallelBuildRuns(kubeAccess, namingCfg, buildCfg, parallelBuilds)
 		if err != nil {
-			return nil, err
+			// the buildruns of this iteration that did complete are kept
+			// as a partial result set, its number of results is lower
+			// than the number of parallel buildruns
+			if len(buildRunResults) > 0 {
+				results = append(results, CalculateResultSet(buildRunResults, "buildrun"))
+			}
+
+			return results, err
 		}
 
 		buildRunResultSet := CalculateResultSet(buildRunResults, "buildrun")
@@ -340,66 +524,303 @@ func ExecuteSeriesOfParallelBuildRuns(kubeAccess KubeAccess, namingCfg NamingCon
 	return results, nil
 }
 
-// ExecuteTestPlan executes the given test plan step by step
-func ExecuteTestPlan(kubeAccess KubeAccess, testplan TestPlan) error {
+// ExecuteTestPlan executes the given test plan step by step, steps that are
+// configured to run concurrently with another step are executed together.
+// The result contains the outcome of every step, including the ones that
+// were skipped, because a failed step aborted the test plan.
+func ExecuteTestPlan(kubeAccess KubeAccess, testplan TestPlan) ([]TestPlanStepResult, error) {
+	if err := testplan.Validate(); err != nil {
+		return nil, err
+	}
+
+	groups, err := testplan.stepGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	var results = make([]TestPlanStepResult, len(testplan.Steps))
 	for i, step := range testplan.Steps {
-		bunt.Printf("Running test plan step %d/%d: LightSlateGray{%s}, using cluster build strategy _%s_ to build CornflowerBlue{~%s~}\n",
-			i+1,
-			len(testplan.Steps),
-			step.Name,
-			step.BuildSpec.Strategy.Name,
-			*step.BuildSpec.Source.URL,
-		)
+		results[i] = TestPlanStepResult{Name: step.Name, Outcome: StepSkipped}
+	}
 
-		name := fmt.Sprintf("test-plan-step-%s", step.Name)
+	var (
+		aborted bool
+		failed  []string
+	)
 
-		outputImageURL, err := getOutputImageURL(name, step.BuildSpec.Output.Image)
-		if err != nil {
-			return err
+	for _, group := range groups {
+		if aborted || kubeAccess.Interrupted() {
+			break
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(len(group))
+		for _, idx := range group {
+			go func(idx int) {
+				defer wg.Done()
+
+				step := testplan.Steps[idx]
+				bunt.Printf("Running test plan step %d/%d: LightSlateGray{%s}, using %s _%s_ to build CornflowerBlue{~%s~}\n",
+					idx+1,
+					len(testplan.Steps),
+					step.Name,
+					stepStrategyKind(step),
+					step.BuildSpec.Strategy.Name,
+					stepSource(step),
+				)
+
+				results[idx] = executeTestPlanStep(kubeAccess, testplan, step)
+			}(idx)
+		}
+
+		wg.Wait()
+
+		for _, idx := range group {
+			if results[idx].Outcome != StepFailed {
+				continue
+			}
+
+			failed = append(failed, results[idx].Name)
+
+			if policy, _, _ := testplan.settingsOf(testplan.Steps[idx]).onFailure(); policy != OnFailureContinue {
+				aborted = true
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return results, fmt.Errorf("test plan %s failed: %s", text.Plural(len(failed), "step"), strings.Join(failed, ", "))
+	}
+
+	return results, nil
+}
+
+// CheckTestPlan sanity checks the cluster for the test plan, like
+// CheckSystemAndConfig does for a single type of buildruns. It verifies that
+// the build strategies of all steps are available and checks the resources
+// of the step group with the most concurrent buildruns.
+func CheckTestPlan(kubeAccess KubeAccess, testplan TestPlan) error {
+	if err := testplan.Validate(); err != nil {
+		return err
+	}
+
+	groups, err := testplan.stepGroups()
+	if err != nil {
+		return err
+	}
+
+	if err := checkPermissions(kubeAccess, NamingConfig{Namespace: testplan.Namespace}); err != nil {
+		return err
+	}
+
+	var (
+		strategies    = map[string]shipwrightBuild.BuilderStrategy{}
+		estimates     = map[string]ResourceEstimate{}
+		maxConcurrent int
+		maxDemands    []podDemand
+	)
+
+	for _, group := range groups {
+		var concurrent int
+		var demands = []podDemand{}
+
+		for _, idx := range group {
+			step := testplan.Steps[idx]
+
+			var buildCfg = stepBuildConfig(step)
+			var key = fmt.Sprintf("%s/%s", stepStrategyKind(step), step.BuildSpec.Strategy.Name)
+			buildStrategy, ok := strategies[key]
+			if !ok {
+				var err error
+				if buildStrategy, err = lookUpBuildStrategy(kubeAccess, testplan.Namespace, buildCfg); err != nil {
+					return fmt.Errorf("test plan step %s: %w", step.Name, err)
+				}
+
+				strategies[key] = buildStrategy
+				if buildStrategy != nil {
+					estimates[key] = lookUpResourceEstimate(kubeAccess, testplan.Namespace, buildStrategy)
+				}
+			}
+
+			concurrent += step.parallel()
+			if estimate, ok := estimates[key]; ok {
+				demands = append(demands, newPodDemand(estimate, step.parallel(), step.BuildSpec.Strategy.Name, BuildConfig{
+					ServiceAccountName: testplan.settingsOf(step).ServiceAccountName,
+				}))
+			}
 		}
 
-		step.BuildSpec.Output.Image = outputImageURL
+		if concurrent > maxConcurrent {
+			maxConcurrent, maxDemands = concurrent, demands
+		}
+	}
+
+	checkExistingBuildRuns(kubeAccess)
 
-		if _, err := ExecuteSingleBuildRun(kubeAccess, testplan.Namespace, name, step.BuildSpec, step.BuildAnnotations, ServiceAccountName(testplan.ServiceAccountName)); err != nil {
+	if len(maxDemands) > 0 {
+		if err := checkNamespacePolicies(kubeAccess, NamingConfig{Namespace: testplan.Namespace}, maxDemands); err != nil {
 			return err
 		}
+
+		return checkResources(kubeAccess, maxDemands)
 	}
 
 	return nil
 }
 
-func estimateResourceRequests(clusterBuildStrategy shipwrightBuild.ClusterBuildStrategy, concurrent int64) corev1.ResourceList {
+// executeTestPlanStep runs the warm-up and measured repetitions of a test
+// plan step one after another, a failed repetition is repeated in case the
+// failure policy of the step allows retries
+func executeTestPlanStep(kubeAccess KubeAccess, testplan TestPlan, step TestPlanStep) TestPlanStepResult {
+	// the failure policy was already checked as part of the validation
+	var settings = testplan.settingsOf(step)
+	_, maxRetries, _ := settings.onFailure()
+
 	var (
-		maxCPU *resource.Quantity
-		maxMem *resource.Quantity
+		parallel   = step.parallel()
+		results    = []Result{}
+		run        int
+		stepResult = TestPlanStepResult{Name: step.Name, Outcome: StepSucceeded}
 	)
 
-	// TODO Verify that this approach by searching for the biggest resource
-	// values is actually what happens with tekton in a real use case.
-	for i := range clusterBuildStrategy.Spec.BuildSteps {
-		step := clusterBuildStrategy.Spec.BuildSteps[i]
+	for iteration := 0; iteration < step.Warmup+step.repeat(); {
+		if kubeAccess.Interrupted() {
+			stepResult.Outcome = StepInterrupted
+			break
+		}
+
+		iterationResults, err := executeTestPlanStepIteration(kubeAccess, testplan, step, settings, run, parallel)
+		run += parallel
+
+		if err != nil {
+			if stepResult.Retries < maxRetries && !kubeAccess.Interrupted() {
+				stepResult.Retries++
+				warn("test plan step %s failed, retrying (%d/%d): %v", step.Name, stepResult.Retries, maxRetries, err)
+				continue
+			}
+
+			if iteration >= step.Warmup {
+				results = append(results, iterationResults...)
+			}
 
-		if maxCPU == nil || step.Resources.Requests.Cpu().AsDec().Cmp(maxCPU.AsDec()) > 0 {
-			maxCPU = step.Resources.Requests.Cpu()
+			stepResult.Outcome, stepResult.Error = StepFailed, err
+			break
 		}
 
-		if maxMem == nil || step.Resources.Requests.Memory().AsDec().Cmp(maxMem.AsDec()) > 0 {
-			maxMem = step.Resources.Requests.Memory()
+		if iteration >= step.Warmup {
+			results = append(results, iterationResults...)
 		}
+
+		iteration++
+	}
+
+	stepResult.ResultSet = CalculateResultSet(results, "buildrun")
+	return stepResult
+}
+
+func executeTestPlanStepIteration(kubeAccess KubeAccess, testplan TestPlan, step TestPlanStep, settings TestPlanStepSettings, offset int, parallel int) ([]Result, error) {
+	var errors = make(chan error, parallel)
+	var wg sync.WaitGroup
+	wg.Add(parallel)
+
+	var results = make([]Result, parallel)
+	for i := 0; i < parallel; i++ {
+		go func(idx int) {
+			defer wg.Done()
+
+			name, buildSpec, err := testPlanRun(step, settings, offset+idx)
+			if err != nil {
+				errors <- err
+				return
+			}
+
+			result, err := ExecuteSingleBuildRun(kubeAccess, testplan.Namespace, name, buildSpec, settings.BuildAnnotations,
+				ServiceAccountName(settings.ServiceAccountName),
+				SkipDelete(settings.skipDelete()),
+			)
+
+			if err != nil {
+				errors <- err
+				return
+			}
+
+			results[idx] = *result
+		}(i)
+	}
+
+	wg.Wait()
+	close(errors)
+
+	return completedResults(results), wrapErrorChanResults(errors, "failed to execute buildruns of test plan step %s", step.Name)
+}
+
+// testPlanRun returns the name and build spec of the given run of a test
+// plan step, where runs are counted across all repetitions of the step
+func testPlanRun(step TestPlanStep, settings TestPlanStepSettings, run int) (string, shipwrightBuild.BuildSpec, error) {
+	name := fmt.Sprintf("%s-%s-%d", testPlanPrefix, step.Name, run)
+
+	buildSpec := *step.BuildSpec.DeepCopy()
+	outputImageURL, err := getOutputImageURL(name, buildSpec.Output.Image)
+	if err != nil {
+		return "", buildSpec, err
 	}
 
-	return corev1.ResourceList{
-		corev1.ResourceCPU: *resource.NewMilliQuantity(
-			maxCPU.MilliValue()*concurrent,
-			resource.DecimalSI,
-		),
-		corev1.ResourceMemory: *resource.NewQuantity(
-			maxMem.Value()*concurrent,
-			resource.BinarySI,
-		),
+	buildSpec.Output.Image = outputImageURL
+
+	if buildSpec.Timeout == nil && settings.Timeout != nil {
+		buildSpec.Timeout = settings.Timeout.DeepCopy()
+	}
+
+	return name, buildSpec, nil
+}
+
+func stepSource(step TestPlanStep) string {
+	switch {
+	case step.BuildSpec.Source.URL != nil:
+		return *step.BuildSpec.Source.URL
+
+	case step.BuildSpec.Source.BundleContainer != nil:
+		return step.BuildSpec.Source.BundleContainer.Image
+
+	default:
+		return ""
 	}
 }
 
+func stepStrategyKind(step TestPlanStep) shipwrightBuild.BuildStrategyKind {
+	if step.BuildSpec.Strategy.Kind != nil {
+		return *step.BuildSpec.Strategy.Kind
+	}
+
+	return shipwrightBuild.ClusterBuildStrategyKind
+}
+
+// stepBuildConfig returns a build configuration with the build strategy of
+// the test plan step
+func stepBuildConfig(step TestPlanStep) BuildConfig {
+	var buildCfg BuildConfig
+	switch stepStrategyKind(step) {
+	case shipwrightBuild.NamespacedBuildStrategyKind:
+		buildCfg.BuildStrategy = step.BuildSpec.Strategy.Name
+
+	default:
+		buildCfg.ClusterBuildStrategy = step.BuildSpec.Strategy.Name
+	}
+
+	return buildCfg
+}
+
+func completedResults(results []Result) []Result {
+	var completed = []Result{}
+	for _, result := range results {
+		if len(result) > 0 {
+			completed = append(completed, result)
+		}
+	}
+
+	return completed
+}
+
 func duration(start, end time.Time) time.Duration {
 	if start.After(end) {
 		warn("start time %v is after end time %v, return 0 as the duration", start, end)
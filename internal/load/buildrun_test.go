@@ -0,0 +1,187 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+	buildfake "github.com/shipwright-io/build/pkg/client/clientset/versioned/fake"
+	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+)
+
+var _ = Describe("executing buildruns", func() {
+	var buildClient *buildfake.Clientset
+	var kubeAccess KubeAccess
+
+	var buildSpec = shipwrightBuild.BuildSpec{
+		Source:   shipwrightBuild.Source{URL: p("https://github.com/shipwright-io/sample-go")},
+		Strategy: shipwrightBuild.Strategy{Name: "kaniko", Kind: p(shipwrightBuild.ClusterBuildStrategyKind)},
+		Output:   shipwrightBuild.Image{Image: "registry.example.com/test"},
+	}
+
+	BeforeEach(func() {
+		buildClient = buildfake.NewSimpleClientset()
+		kubeAccess = KubeAccess{
+			Context:              context.Background(),
+			Client:               fake.NewSimpleClientset(),
+			BuildClient:          buildClient,
+			TektonClient:         tektonfake.NewSimpleClientset(),
+			ShipwrightAPIVersion: APIVersionV1Beta1,
+		}
+	})
+
+	It("should set the build annotations on standalone buildruns", func() {
+		var buildRun *shipwrightBuild.BuildRun
+		buildClient.PrependReactor("create", "buildruns", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			buildRun = action.(k8stesting.CreateAction).GetObject().(*shipwrightBuild.BuildRun)
+			return true, nil, errors.NewForbidden(shipwrightBuild.Resource("buildruns"), buildRun.Name, fmt.Errorf("exceeded quota"))
+		})
+
+		kubeAccess.ShipwrightAPIVersion = APIVersionV1Alpha1
+		_, err := ExecuteSingleBuildRun(kubeAccess, "test", "test-0", buildSpec,
+			map[string]string{shipwrightBuild.AnnotationBuildVerifyRepository: "false"},
+			EmbedBuildSpec(true),
+		)
+
+		Expect(err).To(MatchError(ContainSubstring("exceeded quota")))
+		Expect(buildRun).ToNot(BeNil())
+		Expect(buildRun.Spec.BuildSpec).ToNot(BeNil())
+		Expect(buildRun.Annotations).To(HaveKeyWithValue(shipwrightBuild.AnnotationBuildVerifyRepository, "false"))
+	})
+
+	It("should fail without a panic when the buildrun cannot be looked up using the v1beta1 API", func() {
+		// the buildrun can be looked up until it is created, afterwards the
+		// API server fails to respond while waiting for its completion
+		var created bool
+		buildClient.PrependReactor("create", "buildruns", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			created = true
+			return false, nil, nil
+		})
+
+		buildClient.PrependReactor("get", "buildruns", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if !created {
+				return false, nil, nil
+			}
+
+			return true, nil, errors.NewServiceUnavailable("etcdserver: request timed out")
+		})
+
+		var result *Result
+		var err error
+		Expect(func() {
+			result, err = ExecuteSingleBuildRun(kubeAccess, "test", "test-0", buildSpec, nil)
+		}).ToNot(Panic())
+
+		Expect(result).To(BeNil())
+		Expect(err).To(MatchError(ContainSubstring("etcdserver: request timed out")))
+
+		// the build is still deleted, although the buildrun cannot be looked up
+		_, err = buildClient.ShipwrightV1beta1().Builds("test").Get(context.Background(), "test-0", metav1.GetOptions{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should attach the events of the taskrun and pod without looking them up again", func() {
+		var client = fake.NewSimpleClientset()
+		var tektonClient = tektonfake.NewSimpleClientset()
+		kubeAccess.Client = client
+		kubeAccess.TektonClient = tektonClient
+		kubeAccess.ShipwrightAPIVersion = APIVersionV1Alpha1
+
+		// the buildrun completes as soon as it is looked up after its creation
+		var created bool
+		buildClient.PrependReactor("create", "buildruns", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			created = true
+			return false, nil, nil
+		})
+
+		buildClient.PrependReactor("get", "buildruns", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if !created {
+				return false, nil, nil
+			}
+
+			var now = metav1.Now()
+			return true, &shipwrightBuild.BuildRun{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "test-0", CreationTimestamp: now},
+				Status: shipwrightBuild.BuildRunStatus{
+					LatestTaskRunRef: p("test-0-x7k2p"),
+					CompletionTime:   &now,
+					Conditions: shipwrightBuild.Conditions{
+						{Type: shipwrightBuild.Succeeded, Status: corev1.ConditionTrue},
+					},
+				},
+			}, nil
+		})
+
+		var recorder = StartEventRecording(kubeAccess, NamingConfig{Namespace: "test", Prefix: "test"})
+		kubeAccess.Events = recorder
+
+		Eventually(func() bool {
+			for _, action := range client.Actions() {
+				if action.GetVerb() == "watch" && action.GetResource().Resource == "events" {
+					return true
+				}
+			}
+
+			return false
+		}).Should(BeTrue())
+
+		for _, object := range []string{"test-0-x7k2p", "test-0-x7k2p-pod"} {
+			_, err := client.CoreV1().Events("test").Create(context.Background(), &corev1.Event{
+				ObjectMeta:     metav1.ObjectMeta{Namespace: "test", Name: object + ".event", UID: types.UID(object)},
+				InvolvedObject: corev1.ObjectReference{Namespace: "test", Name: object},
+				Type:           corev1.EventTypeNormal,
+				Reason:         "Started",
+				LastTimestamp:  metav1.NewTime(time.Now().Add(time.Second)),
+			}, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		_, err := ExecuteSingleBuildRun(kubeAccess, "test", "test-0", buildSpec, nil, EmbedBuildSpec(true), SkipDelete(true))
+		Expect(err).ToNot(HaveOccurred())
+
+		// the taskrun is only looked up once for the results of the buildrun
+		var taskRunLookups int
+		for _, action := range tektonClient.Actions() {
+			if action.GetVerb() == "get" && action.GetResource().Resource == "taskruns" {
+				taskRunLookups++
+			}
+		}
+
+		Expect(taskRunLookups).To(Equal(1))
+
+		summary := recorder.Stop()
+		Expect(summary.Runs).To(HaveLen(1))
+		Expect(summary.Runs[0].BuildRun).To(Equal("test-0"))
+		Expect(summary.Runs[0].Events).To(HaveLen(2))
+	})
+})
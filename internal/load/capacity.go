@@ -0,0 +1,366 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gonvenience/bunt"
+	"github.com/gonvenience/text"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrInsufficientCapacity is returned by the checks in case the cluster does
+// not have enough free resources for the concurrent buildruns
+var ErrInsufficientCapacity = errors.New("insufficient cluster capacity")
+
+// maxFittingBuildRuns limits the search for the number of buildruns that fit
+// into the cluster, for example when buildruns do not request any resources
+const maxFittingBuildRuns = 10000
+
+// podDemand is the number of concurrent buildruns of the same build
+// strategy, including whether they create a build and a service account
+type podDemand struct {
+	estimate ResourceEstimate
+	count    int
+
+	strategy                string
+	separateBuild           bool
+	generatedServiceAccount bool
+}
+
+// NodeCapacity contains the free resources of a node, which can be used
+// by buildrun pods
+type NodeCapacity struct {
+	Name        string
+	Allocatable corev1.ResourceList
+	Free        corev1.ResourceList
+	FreePods    int64
+}
+
+// ClusterCapacity contains the nodes that buildrun pods can be scheduled on
+// and the number of nodes that were excluded, by reason
+type ClusterCapacity struct {
+	Nodes    []NodeCapacity
+	Excluded map[string]int
+}
+
+// NewClusterCapacity calculates the free resources of the nodes that the
+// buildrun pods can be scheduled on. Nodes that are cordoned, not ready, or
+// have taints that the buildrun pods do not tolerate are excluded. The
+// requests of the pods that currently run on a node are subtracted from its
+// allocatable resources.
+func NewClusterCapacity(nodes []corev1.Node, pods []corev1.Pod) ClusterCapacity {
+	var capacity = ClusterCapacity{Excluded: map[string]int{}}
+
+	var used = map[string]corev1.ResourceList{}
+	var podCount = map[string]int64{}
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		podCount[pod.Spec.NodeName]++
+
+		var list, ok = used[pod.Spec.NodeName]
+		if !ok {
+			list = corev1.ResourceList{}
+			used[pod.Spec.NodeName] = list
+		}
+
+		for name, quantity := range podRequests(pod) {
+			var sum = list[name]
+			sum.Add(quantity)
+			list[name] = sum
+		}
+	}
+
+	for _, node := range nodes {
+		if reason := unschedulableReason(node); reason != "" {
+			capacity.Excluded[reason]++
+			continue
+		}
+
+		var nodeCapacity = NodeCapacity{
+			Name:        node.Name,
+			Allocatable: corev1.ResourceList{},
+			Free:        corev1.ResourceList{},
+			FreePods:    node.Status.Allocatable.Pods().Value() - podCount[node.Name],
+		}
+
+		for _, name := range estimatedResources {
+			var allocatable = node.Status.Allocatable[name]
+			var free = allocatable.DeepCopy()
+			free.Sub(used[node.Name][name])
+			if free.Sign() < 0 {
+				free = resource.Quantity{}
+			}
+
+			nodeCapacity.Allocatable[name] = allocatable
+			nodeCapacity.Free[name] = free
+		}
+
+		capacity.Nodes = append(capacity.Nodes, nodeCapacity)
+	}
+
+	return capacity
+}
+
+func unschedulableReason(node corev1.Node) string {
+	if node.Spec.Unschedulable {
+		return "cordoned"
+	}
+
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect == corev1.TaintEffectNoSchedule || taint.Effect == corev1.TaintEffectNoExecute {
+			return "tainted"
+		}
+	}
+
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady && condition.Status != corev1.ConditionTrue {
+			return "not ready"
+		}
+	}
+
+	return ""
+}
+
+// podRequests returns the effective requests of a pod as the scheduler sees
+// them, init containers that are restartable sidecars run alongside the
+// containers of the pod
+func podRequests(pod corev1.Pod) corev1.ResourceList {
+	var result = corev1.ResourceList{}
+	for _, name := range estimatedResources {
+		var sum, maxInit resource.Quantity
+		for _, container := range pod.Spec.Containers {
+			sum.Add(container.Resources.Requests[name])
+		}
+
+		for _, container := range pod.Spec.InitContainers {
+			if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+				sum.Add(container.Resources.Requests[name])
+				continue
+			}
+
+			maxInit = maxQuantity(maxInit, container.Resources.Requests[name])
+		}
+
+		var request = maxQuantity(sum, maxInit)
+		if overhead, ok := pod.Spec.Overhead[name]; ok {
+			request.Add(overhead)
+		}
+
+		result[name] = request
+	}
+
+	return result
+}
+
+// Fit returns how many of the given pods can be scheduled, the pods are
+// placed one after another onto the node with the most free resources that
+// fits the pod
+func (capacity ClusterCapacity) Fit(pods []ResourceEstimate) int {
+	var nodes = make([]NodeCapacity, len(capacity.Nodes))
+	for i, node := range capacity.Nodes {
+		nodes[i] = NodeCapacity{Name: node.Name, Free: corev1.ResourceList{}, FreePods: node.FreePods}
+		for name, quantity := range node.Free {
+			nodes[i].Free[name] = quantity.DeepCopy()
+		}
+	}
+
+	var fits = func(node NodeCapacity, pod ResourceEstimate) bool {
+		if node.FreePods < 1 {
+			return false
+		}
+
+		for _, name := range estimatedResources {
+			if free := node.Free[name]; free.Cmp(pod.Requests[name]) < 0 {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	for i, pod := range pods {
+		sort.SliceStable(nodes, func(a, b int) bool {
+			return nodes[a].Free.Cpu().Cmp(*nodes[b].Free.Cpu()) > 0
+		})
+
+		var placed bool
+		for j := range nodes {
+			if fits(nodes[j], pod) {
+				for _, name := range estimatedResources {
+					var free = nodes[j].Free[name]
+					free.Sub(pod.Requests[name])
+					nodes[j].Free[name] = free
+				}
+
+				nodes[j].FreePods--
+				placed = true
+				break
+			}
+		}
+
+		if !placed {
+			return i
+		}
+	}
+
+	return len(pods)
+}
+
+// maxConcurrent returns how many concurrent buildruns fit into the cluster
+// in case the buildruns are mixed like the given demands, the result is
+// capped at a maximum number
+func (capacity ClusterCapacity) maxConcurrent(demands []podDemand) int {
+	var pattern = interleave(demands)
+	if len(pattern) == 0 {
+		return 0
+	}
+
+	var pods = make([]ResourceEstimate, 0, maxFittingBuildRuns)
+	for len(pods) < maxFittingBuildRuns {
+		pods = append(pods, demands[pattern[len(pods)%len(pattern)]].estimate)
+	}
+
+	return capacity.Fit(pods)
+}
+
+// interleave lists the indices of the demands for each of their buildruns
+// in a round-robin manner, so that a prefix of the list has roughly the
+// same mix as the complete list
+func interleave(demands []podDemand) []int {
+	var result = []int{}
+	var placed = make([]int, len(demands))
+
+	for {
+		var added bool
+		for i, demand := range demands {
+			if placed[i] < demand.count {
+				result = append(result, i)
+				placed[i]++
+				added = true
+			}
+		}
+
+		if !added {
+			return result
+		}
+	}
+}
+
+func estimates(demands []podDemand) []ResourceEstimate {
+	var result = []ResourceEstimate{}
+	for _, idx := range interleave(demands) {
+		result = append(result, demands[idx].estimate)
+	}
+
+	return result
+}
+
+// checkResources prints the estimated resource requests and limits of the
+// concurrent buildruns in comparison to the free resources of the cluster
+// nodes. In case not all buildruns fit into the cluster, an error wrapping
+// ErrInsufficientCapacity is returned.
+func checkResources(kubeAccess KubeAccess, demands []podDemand) error {
+	nodeList, err := kubeAccess.Client.CoreV1().Nodes().List(kubeAccess.Context, metav1.ListOptions{})
+	if err != nil {
+		return nil
+	}
+
+	var pods []corev1.Pod
+	if podList, err := kubeAccess.Client.CoreV1().Pods("").List(kubeAccess.Context, metav1.ListOptions{FieldSelector: "status.phase!=Succeeded,status.phase!=Failed"}); err == nil {
+		pods = podList.Items
+	} else {
+		warn("unable to look up the running pods, the capacity check only considers the allocatable node resources: %v", err)
+	}
+
+	var capacity = NewClusterCapacity(nodeList.Items, pods)
+
+	var concurrent int
+	var total = noResources()
+	for _, demand := range demands {
+		concurrent += demand.count
+		total = total.plus(demand.estimate.scaled(int64(demand.count)))
+	}
+
+	var allocatable, free = noResources(), noResources()
+	for _, node := range capacity.Nodes {
+		allocatable = allocatable.plus(ResourceEstimate{Requests: node.Allocatable})
+		free = free.plus(ResourceEstimate{Requests: node.Free})
+	}
+
+	var limits = "no limits"
+	if len(total.Limits) > 0 {
+		var parts = []string{}
+		if cpu, ok := total.Limits[corev1.ResourceCPU]; ok {
+			parts = append(parts, bunt.Sprintf("SlateGray{%v CPU cores}", &cpu))
+		}
+
+		if memory, ok := total.Limits[corev1.ResourceMemory]; ok {
+			parts = append(parts, bunt.Sprintf("LightSlateGray{%v system memory}", humanReadableMemory(&memory)))
+		}
+
+		limits = "limits of " + strings.Join(parts, " and ")
+	}
+
+	var excluded = []string{}
+	for _, reason := range []string{"cordoned", "tainted", "not ready"} {
+		if count, ok := capacity.Excluded[reason]; ok {
+			excluded = append(excluded, fmt.Sprintf("%d %s", count, reason))
+		}
+	}
+
+	var nodes = text.Plural(len(capacity.Nodes), "schedulable node")
+	if len(excluded) > 0 {
+		nodes = fmt.Sprintf("%s (excluded %s)", nodes, strings.Join(excluded, ", "))
+	}
+
+	bunt.Printf("With Moccasin{_%s_}, the estimated resource request will be roughly SlateGray{%v CPU cores} and LightSlateGray{%v system memory} (%s). Free on %s are SlateGray{%v of %v CPU cores} and LightSlateGray{%v of %v system memory}.\n\n",
+		text.Plural(concurrent, "concurrent buildrun"),
+		total.Requests.Cpu(),
+		humanReadableMemory(total.Requests.Memory()),
+		limits,
+		nodes,
+		free.Requests.Cpu(),
+		allocatable.Requests.Cpu(),
+		humanReadableMemory(free.Requests.Memory()),
+		humanReadableMemory(allocatable.Requests.Memory()),
+	)
+
+	var maxConcurrent = capacity.maxConcurrent(demands)
+	if maxConcurrent < maxFittingBuildRuns {
+		bunt.Printf("At most Moccasin{_%s_} fit into the cluster at the same time.\n\n", text.Plural(maxConcurrent, "concurrent buildrun"))
+	}
+
+	if fitting := capacity.Fit(estimates(demands)); fitting < concurrent {
+		return fmt.Errorf("%w: only %d of %s fit into the free resources of the cluster",
+			ErrInsufficientCapacity,
+			fitting,
+			text.Plural(concurrent, "concurrent buildrun"),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("cluster capacity", func() {
+	var resources = func(cpu string, memory string) corev1.ResourceList {
+		return corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		}
+	}
+
+	var node = func(name string, cpu string, memory string, modify ...func(*corev1.Node)) corev1.Node {
+		var allocatable = resources(cpu, memory)
+		allocatable[corev1.ResourcePods] = resource.MustParse("110")
+
+		var result = corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				Capacity:    resources("64", "256Gi"),
+				Allocatable: allocatable,
+				Conditions:  []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+			},
+		}
+
+		for _, f := range modify {
+			f(&result)
+		}
+
+		return result
+	}
+
+	var pod = func(nodeName string, phase corev1.PodPhase, cpu string, memory string) corev1.Pod {
+		return corev1.Pod{
+			Spec: corev1.PodSpec{
+				NodeName: nodeName,
+				InitContainers: []corev1.Container{
+					{Resources: corev1.ResourceRequirements{Requests: resources("4", "1Gi")}},
+				},
+				Containers: []corev1.Container{
+					{Resources: corev1.ResourceRequirements{Requests: resources(cpu, memory)}},
+				},
+			},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+	}
+
+	var buildRunPods = func(count int, cpu string, memory string) []ResourceEstimate {
+		var result = make([]ResourceEstimate, count)
+		for i := range result {
+			result[i] = ResourceEstimate{Requests: resources(cpu, memory)}
+		}
+
+		return result
+	}
+
+	It("should only consider the nodes that buildrun pods can be scheduled on", func() {
+		var capacity = NewClusterCapacity([]corev1.Node{
+			node("worker", "4", "16Gi"),
+			node("cordoned", "4", "16Gi", func(n *corev1.Node) { n.Spec.Unschedulable = true }),
+			node("control-plane", "4", "16Gi", func(n *corev1.Node) {
+				n.Spec.Taints = []corev1.Taint{{Key: "node-role.kubernetes.io/control-plane", Effect: corev1.TaintEffectNoSchedule}}
+			}),
+			node("preferred", "4", "16Gi", func(n *corev1.Node) {
+				n.Spec.Taints = []corev1.Taint{{Key: "spot", Effect: corev1.TaintEffectPreferNoSchedule}}
+			}),
+			node("broken", "4", "16Gi", func(n *corev1.Node) {
+				n.Status.Conditions[0].Status = corev1.ConditionFalse
+			}),
+		}, nil)
+
+		Expect(capacity.Nodes).To(HaveLen(2))
+		Expect(capacity.Nodes[0].Name).To(Equal("worker"))
+		Expect(capacity.Nodes[1].Name).To(Equal("preferred"))
+		Expect(capacity.Excluded).To(Equal(map[string]int{"cordoned": 1, "tainted": 1, "not ready": 1}))
+	})
+
+	It("should subtract the requests of running pods from the allocatable resources", func() {
+		var capacity = NewClusterCapacity(
+			[]corev1.Node{node("worker", "8", "16Gi")},
+			[]corev1.Pod{
+				pod("worker", corev1.PodRunning, "1", "2Gi"),
+				pod("worker", corev1.PodPending, "500m", "1Gi"),
+				pod("worker", corev1.PodSucceeded, "8", "16Gi"),
+				pod("", corev1.PodPending, "8", "16Gi"),
+			},
+		)
+
+		// the init container requests more CPU than the containers
+		Expect(capacity.Nodes[0].Free.Cpu().String()).To(Equal("0"))
+		Expect(capacity.Nodes[0].Free.Memory().String()).To(Equal("13Gi"))
+		Expect(capacity.Nodes[0].FreePods).To(Equal(int64(108)))
+	})
+
+	It("should place buildrun pods onto the nodes with free resources", func() {
+		var capacity = NewClusterCapacity([]corev1.Node{
+			node("small", "2", "8Gi"),
+			node("large", "4", "8Gi"),
+		}, nil)
+
+		Expect(capacity.Fit(buildRunPods(3, "1500m", "1Gi"))).To(Equal(3))
+		Expect(capacity.Fit(buildRunPods(4, "1500m", "1Gi"))).To(Equal(3))
+		Expect(capacity.Fit(buildRunPods(8, "500m", "2Gi"))).To(Equal(8))
+		Expect(capacity.Fit(buildRunPods(9, "500m", "2Gi"))).To(Equal(8))
+	})
+})
@@ -18,8 +18,6 @@ package load
 
 import (
 	"context"
-	"os"
-	"path/filepath"
 	"time"
 
 	buildclient "github.com/shipwright-io/build/pkg/client/clientset/versioned"
@@ -28,72 +26,125 @@ import (
 	"github.com/gonvenience/bunt"
 	"github.com/gonvenience/wrap"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
 // Debug enables or disables additional output
 var Debug bool
 
-func p[T any](t T) *T { return &t }
+const (
+	defaultQPS   = 500
+	defaultBurst = 500
+)
 
-func lookUpKubeConfigFilePath() (string, error) {
-	if value, present := os.LookupEnv("KUBECONFIG"); present {
-		return value, nil
-	}
+func p[T any](t T) *T { return &t }
 
-	homedir, err := os.UserHomeDir()
+// NewKubeAccess creates a new kubernetes access handle
+func NewKubeAccess(clientCfg ClientConfig) (*KubeAccess, error) {
+	restConfig, err := newRestConfig(clientCfg)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	defaultLocation := filepath.Join(homedir, ".kube", "config")
-	if _, err := os.Stat(defaultLocation); err != nil {
-		return "", err
+	if len(clientCfg.Impersonate) > 0 || len(clientCfg.ImpersonateGroups) > 0 {
+		restConfig.Impersonate = rest.ImpersonationConfig{
+			UserName: clientCfg.Impersonate,
+			Groups:   clientCfg.ImpersonateGroups,
+		}
 	}
 
-	return defaultLocation, nil
-}
+	// the default QPS is 5 which is not very much to make load on the system
+	restConfig.QPS = defaultQPS
+	if clientCfg.QPS > 0 {
+		restConfig.QPS = clientCfg.QPS
+	}
 
-// NewKubeAccess creates a new kubernetes access handle
-func NewKubeAccess() (*KubeAccess, error) {
-	kubeConfigFilePath, err := lookUpKubeConfigFilePath()
-	if err != nil {
-		return nil, err
+	restConfig.Burst = defaultBurst
+	if clientCfg.Burst > 0 {
+		restConfig.Burst = clientCfg.Burst
 	}
 
-	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeConfigFilePath)
+	var apiMetrics = NewAPIMetrics()
+
+	client, err := kubernetes.NewForConfig(apiMetrics.Instrument(restConfig))
 	if err != nil {
 		return nil, err
 	}
 
-	// the default QPS is 5 which is not very much to make load on the system
-	restConfig.QPS = 500
-	restConfig.Burst = 500
-
-	client, err := kubernetes.NewForConfig(restConfig)
+	buildClient, err := buildclient.NewForConfig(apiMetrics.Instrument(restConfig))
 	if err != nil {
 		return nil, err
 	}
 
-	buildClient, err := buildclient.NewForConfig(restConfig)
+	tektonClient, err := tektonclient.NewForConfig(apiMetrics.Instrument(restConfig))
 	if err != nil {
 		return nil, err
 	}
 
-	tektonClient, err := tektonclient.NewForConfig(restConfig)
+	shipwrightAPIVersion, err := detectShipwrightAPIVersion(client.Discovery(), clientCfg.ShipwrightAPIVersion)
 	if err != nil {
 		return nil, err
 	}
 
 	return &KubeAccess{
-		Context:      context.Background(),
-		RestConfig:   restConfig,
-		Client:       client,
-		BuildClient:  buildClient,
-		TektonClient: tektonClient,
+		Context:              context.Background(),
+		CleanupContext:       context.Background(),
+		RestConfig:           restConfig,
+		Client:               client,
+		BuildClient:          buildClient,
+		TektonClient:         tektonClient,
+		ShipwrightAPIVersion: shipwrightAPIVersion,
+		APIMetrics:           apiMetrics,
 	}, nil
 }
 
+func newRestConfig(clientCfg ClientConfig) (*rest.Config, error) {
+	if clientCfg.InCluster {
+		return rest.InClusterConfig()
+	}
+
+	// Use the well known loading rules, i.e. KUBECONFIG environment variable
+	// and the default location in the home directory, unless an explicit
+	// file is configured. In case no configuration can be found while
+	// running inside a pod, the service account config is used instead.
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = clientCfg.KubeConfig
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: clientCfg.Context},
+	).ClientConfig()
+}
+
+// WithContext returns a copy of the Kubernetes access handle, which uses the
+// provided context for all operations. Once the context is done, clean-up
+// operations are still possible within the provided grace period.
+func (kubeAccess KubeAccess) WithContext(ctx context.Context, gracePeriod time.Duration) KubeAccess {
+	cleanupContext, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	context.AfterFunc(ctx, func() {
+		time.AfterFunc(gracePeriod, cancel)
+	})
+
+	kubeAccess.Context = ctx
+	kubeAccess.CleanupContext = cleanupContext
+	return kubeAccess
+}
+
+// Interrupted returns whether the context of the Kubernetes access handle
+// is done, for example due to a received termination signal
+func (kubeAccess KubeAccess) Interrupted() bool {
+	return kubeAccess.Context.Err() != nil
+}
+
+func (kubeAccess KubeAccess) forCleanup() KubeAccess {
+	if kubeAccess.CleanupContext != nil {
+		kubeAccess.Context = kubeAccess.CleanupContext
+	}
+
+	return kubeAccess
+}
+
 func wrapErrorChanResults(errors chan error, format string, a ...interface{}) error {
 	errorList := []error{}
 	for err := range errors {
@@ -0,0 +1,44 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+)
+
+var _ = Describe("Kubernetes access handle", func() {
+	Context("using a cancelable context", func() {
+		It("should keep the clean-up context usable for the grace period after an interruption", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			kubeAccess := KubeAccess{}.WithContext(ctx, 250*time.Millisecond)
+			Expect(kubeAccess.Interrupted()).To(BeFalse())
+
+			cancel()
+			Expect(kubeAccess.Interrupted()).To(BeTrue())
+			Expect(kubeAccess.CleanupContext.Err()).ToNot(HaveOccurred())
+
+			Eventually(kubeAccess.CleanupContext.Done()).Should(BeClosed())
+		})
+	})
+})
@@ -0,0 +1,356 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const dockerHubServer = "https://index.docker.io/v1/"
+
+// CredentialsConfig contains all fields required to create the secrets and
+// the service account that are used by the buildruns
+type CredentialsConfig struct {
+	// DockerConfig is the path of a local docker config file, for example
+	// ~/.docker/config.json, to create the registry secret from
+	DockerConfig string
+
+	// RegistryServer, RegistryUsername, and RegistryPassword are used to
+	// create the registry secret in case no docker config is configured, the
+	// server defaults to the registry of the output image
+	RegistryServer   string
+	RegistryUsername string
+	RegistryPassword string
+
+	// SourceUsername and SourcePassword are used to create a basic
+	// authentication secret to access the source repository
+	SourceUsername string
+	SourcePassword string
+
+	// ServiceAccount defines whether a service account is created, which
+	// links the registry and source secrets
+	ServiceAccount bool
+}
+
+type dockerConfigAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+func (auth dockerConfigAuth) credentials() (string, string) {
+	if auth.Username != "" || auth.Auth == "" {
+		return auth.Username, auth.Password
+	}
+
+	data, err := base64.StdEncoding.DecodeString(auth.Auth)
+	if err != nil {
+		return "", ""
+	}
+
+	username, password, _ := strings.Cut(string(data), ":")
+	return username, password
+}
+
+type dockerConfig struct {
+	Auths map[string]dockerConfigAuth `json:"auths"`
+}
+
+// ProvisionCredentials creates the configured secrets and service account
+// in the namespace defined in the naming config. The returned build config
+// references the created objects, the returned function removes them again,
+// unless skip delete is configured. Existing secrets or service accounts are
+// never overwritten.
+func ProvisionCredentials(kubeAccess KubeAccess, namingCfg NamingConfig, credentialsCfg CredentialsConfig, buildCfg BuildConfig) (BuildConfig, func(), error) {
+	var created provisioned
+
+	var cleanup = func() {
+		if buildCfg.SkipDelete {
+			return
+		}
+
+		created.remove(kubeAccess.forCleanup())
+	}
+
+	var namespace = namingCfg.Namespace
+
+	if credentialsCfg.DockerConfig == "" && credentialsCfg.RegistryUsername != "" && credentialsCfg.RegistryPassword == "" {
+		return buildCfg, cleanup, fmt.Errorf("the registry username %s requires a registry password", credentialsCfg.RegistryUsername)
+	}
+
+	if credentialsCfg.DockerConfig != "" || credentialsCfg.RegistryUsername != "" {
+		data, err := dockerConfigJSON(credentialsCfg, buildCfg.OutputImageURL)
+		if err != nil {
+			return buildCfg, cleanup, err
+		}
+
+		if buildCfg.OutputSecretRef == "" {
+			buildCfg.OutputSecretRef = fmt.Sprintf("%s-registry-credentials", namingCfg.Prefix)
+		}
+
+		if err := created.createSecret(kubeAccess, namespace, buildCfg.OutputSecretRef, corev1.SecretTypeDockerConfigJson, map[string][]byte{corev1.DockerConfigJsonKey: data}); err != nil {
+			cleanup()
+			return buildCfg, cleanup, err
+		}
+	}
+
+	if credentialsCfg.SourceUsername != "" || credentialsCfg.SourcePassword != "" {
+		if buildCfg.SourceSecretRef == "" {
+			buildCfg.SourceSecretRef = fmt.Sprintf("%s-source-credentials", namingCfg.Prefix)
+		}
+
+		if err := created.createSecret(kubeAccess, namespace, buildCfg.SourceSecretRef, corev1.SecretTypeBasicAuth, map[string][]byte{
+			corev1.BasicAuthUsernameKey: []byte(credentialsCfg.SourceUsername),
+			corev1.BasicAuthPasswordKey: []byte(credentialsCfg.SourcePassword),
+		}); err != nil {
+			cleanup()
+			return buildCfg, cleanup, err
+		}
+	}
+
+	if credentialsCfg.ServiceAccount {
+		var serviceAccount = corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      fmt.Sprintf("%s-service-account", namingCfg.Prefix),
+				Labels:    map[string]string{managedByLabel: "build-load"},
+			},
+		}
+
+		for _, secretName := range []string{buildCfg.OutputSecretRef, buildCfg.SourceSecretRef} {
+			if secretName != "" {
+				serviceAccount.Secrets = append(serviceAccount.Secrets, corev1.ObjectReference{Name: secretName})
+			}
+		}
+
+		if buildCfg.OutputSecretRef != "" {
+			serviceAccount.ImagePullSecrets = []corev1.LocalObjectReference{{Name: buildCfg.OutputSecretRef}}
+		}
+
+		if _, err := kubeAccess.Client.CoreV1().ServiceAccounts(namespace).Create(kubeAccess.Context, &serviceAccount, metav1.CreateOptions{}); err != nil {
+			cleanup()
+			return buildCfg, cleanup, fmt.Errorf("failed to create service account %s in namespace %s: %w", serviceAccount.Name, namespace, err)
+		}
+
+		debug("Created service account %s", serviceAccount.Name)
+		created.serviceAccounts = append(created.serviceAccounts, namespacedName{namespace, serviceAccount.Name})
+		buildCfg.ServiceAccountName = serviceAccount.Name
+	}
+
+	return buildCfg, cleanup, nil
+}
+
+func (created *provisioned) createSecret(kubeAccess KubeAccess, namespace string, name string, secretType corev1.SecretType, data map[string][]byte) error {
+	_, err := kubeAccess.Client.CoreV1().Secrets(namespace).Create(kubeAccess.Context, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    map[string]string{managedByLabel: "build-load"},
+		},
+		Type: secretType,
+		Data: data,
+	}, metav1.CreateOptions{})
+
+	switch {
+	case errors.IsAlreadyExists(err):
+		return fmt.Errorf("secret %s already exists in namespace %s, use a different secret name or remove the existing secret", name, namespace)
+
+	case err != nil:
+		return fmt.Errorf("failed to create secret %s in namespace %s: %w", name, namespace, err)
+	}
+
+	debug("Created secret %s", name)
+	created.secrets = append(created.secrets, namespacedName{namespace, name})
+	return nil
+}
+
+// dockerConfigJSON creates the content of a docker config JSON secret, either
+// based on the local docker config file, or based on the registry credentials
+func dockerConfigJSON(credentialsCfg CredentialsConfig, outputImageURL string) ([]byte, error) {
+	if credentialsCfg.DockerConfig == "" {
+		var server = credentialsCfg.RegistryServer
+		if server == "" {
+			server = registryServer(outputImageURL)
+		}
+
+		if server == "" {
+			return nil, fmt.Errorf("unable to derive the registry server without an output image, the registry server needs to be configured")
+		}
+
+		return json.Marshal(dockerConfig{Auths: map[string]dockerConfigAuth{
+			server: {
+				Username: credentialsCfg.RegistryUsername,
+				Password: credentialsCfg.RegistryPassword,
+				Auth:     base64.StdEncoding.EncodeToString([]byte(credentialsCfg.RegistryUsername + ":" + credentialsCfg.RegistryPassword)),
+			},
+		}})
+	}
+
+	data, err := os.ReadFile(filepath.Clean(credentialsCfg.DockerConfig))
+	if err != nil {
+		return nil, err
+	}
+
+	var config dockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse docker config %s: %w", credentialsCfg.DockerConfig, err)
+	}
+
+	// Only entries with credentials are used, entries that rely on a
+	// credential helper of the local system cannot be used in the cluster
+	var result = dockerConfig{Auths: map[string]dockerConfigAuth{}}
+	for server, auth := range config.Auths {
+		if credentialsCfg.RegistryServer != "" && registryHost(server) != registryHost(credentialsCfg.RegistryServer) {
+			continue
+		}
+
+		if username, _ := auth.credentials(); username != "" {
+			result.Auths[server] = auth
+		}
+	}
+
+	if len(result.Auths) == 0 {
+		return nil, fmt.Errorf("docker config %s contains no usable credentials, credential stores and helpers are not supported, use the registry username and password instead", credentialsCfg.DockerConfig)
+	}
+
+	return json.Marshal(result)
+}
+
+// registryServer returns the server name that docker uses for the registry
+// of the given image
+func registryServer(imageURL string) string {
+	var host = registryHost(imageURL)
+	if host == "docker.io" {
+		return dockerHubServer
+	}
+
+	return host
+}
+
+// registryHost returns the normalized host name of an image URL or docker
+// config server entry, so that both can be compared
+func registryHost(value string) string {
+	value = strings.TrimPrefix(value, "https://")
+	value = strings.TrimPrefix(value, "http://")
+	host, _, _ := strings.Cut(value, "/")
+
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return "docker.io"
+	}
+
+	return host
+}
+
+// checkCredentials verifies that the secrets and the service account of the
+// build configuration exist in the namespace and are usable
+func checkCredentials(kubeAccess KubeAccess, namespace string, buildCfg BuildConfig) error {
+	if buildCfg.OutputSecretRef != "" {
+		secret, err := kubeAccess.Client.CoreV1().Secrets(namespace).Get(kubeAccess.Context, buildCfg.OutputSecretRef, metav1.GetOptions{})
+		if err != nil {
+			if err := lookUpFailure(err, "output secret", buildCfg.OutputSecretRef, namespace); err != nil {
+				return err
+			}
+		} else {
+			config, found, err := secretDockerConfig(secret)
+			switch {
+			case err != nil:
+				return fmt.Errorf("failed to parse docker config of output secret %s in namespace %s: %w", secret.Name, namespace, err)
+
+			case !found:
+				warn("output secret %s contains no docker config, neither %s nor %s", secret.Name, corev1.DockerConfigJsonKey, corev1.DockerConfigKey)
+
+			default:
+				var host = registryHost(buildCfg.OutputImageURL)
+				if _, found := config.lookUp(host); !found {
+					warn("output secret %s contains no credentials for registry %s", secret.Name, host)
+				}
+			}
+		}
+	}
+
+	if buildCfg.SourceSecretRef != "" {
+		if _, err := kubeAccess.Client.CoreV1().Secrets(namespace).Get(kubeAccess.Context, buildCfg.SourceSecretRef, metav1.GetOptions{}); err != nil {
+			if err := lookUpFailure(err, "source secret", buildCfg.SourceSecretRef, namespace); err != nil {
+				return err
+			}
+		}
+	}
+
+	if buildCfg.ServiceAccountName != "" && buildCfg.ServiceAccountName != "generated" {
+		if _, err := kubeAccess.Client.CoreV1().ServiceAccounts(namespace).Get(kubeAccess.Context, buildCfg.ServiceAccountName, metav1.GetOptions{}); err != nil {
+			if err := lookUpFailure(err, "service account", buildCfg.ServiceAccountName, namespace); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// lookUpFailure returns an error in case an object that the build
+// configuration refers to does not exist, other failures, for example
+// missing permissions, only result in a warning, since the check is optional
+func lookUpFailure(err error, kind string, name string, namespace string) error {
+	switch {
+	case errors.IsNotFound(err):
+		return fmt.Errorf("failed to look up %s %s in namespace %s: %w", kind, name, namespace, err)
+
+	case errors.IsForbidden(err):
+		warn("The current permissions do not allow to check whether %s CadetBlue{*%s*} exists in namespace %s.", kind, name, namespace)
+
+	default:
+		warn("unable to look up %s %s in namespace %s: %v", kind, name, namespace, err)
+	}
+
+	return nil
+}
+
+// secretDockerConfig returns the docker config of a secret, which is
+// either of type dockerconfigjson, or of the legacy type dockercfg that
+// only contains the auths section
+func secretDockerConfig(secret *corev1.Secret) (dockerConfig, bool, error) {
+	var config dockerConfig
+	if data, ok := secret.Data[corev1.DockerConfigJsonKey]; ok {
+		return config, true, json.Unmarshal(data, &config)
+	}
+
+	if data, ok := secret.Data[corev1.DockerConfigKey]; ok {
+		return config, true, json.Unmarshal(data, &config.Auths)
+	}
+
+	return config, false, nil
+}
+
+func (config dockerConfig) lookUp(host string) (dockerConfigAuth, bool) {
+	for server, auth := range config.Auths {
+		if registryHost(server) == host {
+			return auth, true
+		}
+	}
+
+	return dockerConfigAuth{}, false
+}
@@ -0,0 +1,233 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+	buildfake "github.com/shipwright-io/build/pkg/client/clientset/versioned/fake"
+)
+
+var _ = Describe("provisioning credentials", func() {
+	var (
+		kubeAccess KubeAccess
+		namingCfg  = NamingConfig{Namespace: "default", Prefix: "test"}
+		buildCfg   = BuildConfig{
+			ServiceAccountName: "generated",
+			OutputImageURL:     "docker.io/boatyard",
+		}
+	)
+
+	var getSecret = func(name string) (*corev1.Secret, error) {
+		return kubeAccess.Client.CoreV1().Secrets("default").Get(context.Background(), name, metav1.GetOptions{})
+	}
+
+	BeforeEach(func() {
+		kubeAccess = KubeAccess{
+			Context:        context.Background(),
+			CleanupContext: context.Background(),
+			Client: fake.NewSimpleClientset(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "existing"}},
+			),
+		}
+	})
+
+	It("should create the registry secret based on the registry credentials", func() {
+		result, cleanup, err := ProvisionCredentials(kubeAccess, namingCfg, CredentialsConfig{RegistryUsername: "user", RegistryPassword: "pass"}, buildCfg)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.OutputSecretRef).To(Equal("test-registry-credentials"))
+		Expect(result.ServiceAccountName).To(Equal("generated"))
+
+		secret, err := getSecret("test-registry-credentials")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secret.Type).To(Equal(corev1.SecretTypeDockerConfigJson))
+		Expect(secret.Data[corev1.DockerConfigJsonKey]).To(MatchJSON(`{"auths":{"https://index.docker.io/v1/":{"username":"user","password":"pass","auth":"dXNlcjpwYXNz"}}}`))
+
+		cleanup()
+		_, err = getSecret("test-registry-credentials")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should create the registry secret based on the usable entries of a docker config", func() {
+		var dockerConfig = filepath.Join(GinkgoT().TempDir(), "config.json")
+		Expect(os.WriteFile(dockerConfig, []byte(`{
+  "auths": {
+    "https://index.docker.io/v1/": {"auth": "dXNlcjpwYXNz"},
+    "ghcr.io": {}
+  },
+  "credsStore": "desktop"
+}`), 0600)).To(Succeed())
+
+		result, _, err := ProvisionCredentials(kubeAccess, namingCfg, CredentialsConfig{DockerConfig: dockerConfig}, buildCfg)
+		Expect(err).ToNot(HaveOccurred())
+
+		secret, err := getSecret(result.OutputSecretRef)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secret.Data[corev1.DockerConfigJsonKey]).To(MatchJSON(`{"auths":{"https://index.docker.io/v1/":{"auth":"dXNlcjpwYXNz"}}}`))
+	})
+
+	It("should create the source secret and a service account linking both secrets", func() {
+		result, cleanup, err := ProvisionCredentials(kubeAccess, namingCfg, CredentialsConfig{
+			RegistryUsername: "user",
+			RegistryPassword: "pass",
+			SourceUsername:   "git",
+			SourcePassword:   "token",
+			ServiceAccount:   true,
+		}, buildCfg)
+
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.SourceSecretRef).To(Equal("test-source-credentials"))
+		Expect(result.ServiceAccountName).To(Equal("test-service-account"))
+
+		secret, err := getSecret("test-source-credentials")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secret.Type).To(Equal(corev1.SecretTypeBasicAuth))
+
+		serviceAccount, err := kubeAccess.Client.CoreV1().ServiceAccounts("default").Get(context.Background(), "test-service-account", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(serviceAccount.Secrets).To(Equal([]corev1.ObjectReference{{Name: "test-registry-credentials"}, {Name: "test-source-credentials"}}))
+		Expect(serviceAccount.ImagePullSecrets).To(Equal([]corev1.LocalObjectReference{{Name: "test-registry-credentials"}}))
+
+		cleanup()
+		_, err = kubeAccess.Client.CoreV1().ServiceAccounts("default").Get(context.Background(), "test-service-account", metav1.GetOptions{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should not overwrite existing secrets", func() {
+		var cfg = buildCfg
+		cfg.OutputSecretRef = "existing"
+
+		_, _, err := ProvisionCredentials(kubeAccess, namingCfg, CredentialsConfig{RegistryUsername: "user", RegistryPassword: "pass"}, cfg)
+		Expect(err).To(MatchError("secret existing already exists in namespace default, use a different secret name or remove the existing secret"))
+
+		_, err = getSecret("existing")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should reject a registry username without a password", func() {
+		_, _, err := ProvisionCredentials(kubeAccess, namingCfg, CredentialsConfig{RegistryUsername: "user"}, buildCfg)
+		Expect(err).To(MatchError("the registry username user requires a registry password"))
+
+		_, err = getSecret("test-registry-credentials")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should create nothing without configured credentials", func() {
+		result, _, err := ProvisionCredentials(kubeAccess, namingCfg, CredentialsConfig{}, buildCfg)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal(buildCfg))
+	})
+})
+
+var _ = Describe("checking credentials", func() {
+	var kubeAccess = func(secret *corev1.Secret) KubeAccess {
+		var client = fake.NewSimpleClientset(secret)
+		client.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+			review.Status.Allowed = true
+			return true, review, nil
+		})
+
+		// the build strategy cannot be looked up, which skips the resource checks
+		var buildClient = buildfake.NewSimpleClientset()
+		buildClient.PrependReactor("get", "clusterbuildstrategies", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.NewForbidden(shipwrightBuild.Resource("clusterbuildstrategies"), "kaniko", fmt.Errorf("forbidden"))
+		})
+
+		return KubeAccess{Context: context.Background(), Client: client, BuildClient: buildClient}
+	}
+
+	var buildCfg = BuildConfig{
+		ClusterBuildStrategy: "kaniko",
+		OutputImageURL:       "docker.io/boatyard",
+		OutputSecretRef:      "registry-credentials",
+	}
+
+	var secret = func(secretType corev1.SecretType, key string, value string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "registry-credentials"},
+			Type:       secretType,
+			Data:       map[string][]byte{key: []byte(value)},
+		}
+	}
+
+	It("should accept output secrets of the legacy dockercfg type", func() {
+		Expect(CheckSystemAndConfig(
+			kubeAccess(secret(corev1.SecretTypeDockercfg, corev1.DockerConfigKey, `{"https://index.docker.io/v1/":{"auth":"dXNlcjpwYXNz"}}`)),
+			NamingConfig{Namespace: "default"},
+			buildCfg,
+			1,
+		)).To(Succeed())
+	})
+
+	It("should only warn about output secrets without a docker config", func() {
+		Expect(CheckSystemAndConfig(
+			kubeAccess(secret(corev1.SecretTypeOpaque, "token", "secret")),
+			NamingConfig{Namespace: "default"},
+			buildCfg,
+			1,
+		)).To(Succeed())
+	})
+
+	It("should only warn in case the permissions do not allow to look up the output secret", func() {
+		var access = kubeAccess(secret(corev1.SecretTypeDockerConfigJson, corev1.DockerConfigJsonKey, `{`))
+		access.Client.(*fake.Clientset).PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.NewForbidden(corev1.Resource("secrets"), "registry-credentials", fmt.Errorf("forbidden"))
+		})
+
+		Expect(CheckSystemAndConfig(access, NamingConfig{Namespace: "default"}, buildCfg, 1)).To(Succeed())
+	})
+
+	It("should fail in case the output secret does not exist", func() {
+		var cfg = buildCfg
+		cfg.OutputSecretRef = "missing"
+
+		Expect(CheckSystemAndConfig(
+			kubeAccess(secret(corev1.SecretTypeDockerConfigJson, corev1.DockerConfigJsonKey, `{}`)),
+			NamingConfig{Namespace: "default"},
+			cfg,
+			1,
+		)).To(MatchError(ContainSubstring("failed to look up output secret missing in namespace default")))
+	})
+
+	It("should fail for output secrets with an invalid docker config", func() {
+		Expect(CheckSystemAndConfig(
+			kubeAccess(secret(corev1.SecretTypeDockerConfigJson, corev1.DockerConfigJsonKey, `{`)),
+			NamingConfig{Namespace: "default"},
+			buildCfg,
+			1,
+		)).To(MatchError(ContainSubstring("failed to parse docker config of output secret registry-credentials")))
+	})
+})
@@ -0,0 +1,712 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Supported storage types for the results of an in-cluster run
+const (
+	ResultsConfigMap = "configmap"
+	ResultsPVC       = "pvc"
+)
+
+const (
+	resultsMountPath   = "/results"
+	resultsHelperImage = "busybox:stable"
+
+	// maxResultsConfigMapSize is the size limit of objects in etcd, the
+	// data of the results config map has to stay below it, leaving room
+	// for the metadata of the config map
+	maxResultsConfigMapSize = 1024*1024 - 16*1024
+)
+
+// DefaultControllerNamespaces are the namespaces of the Shipwright and
+// Tekton controllers in a default installation
+var DefaultControllerNamespaces = []string{"shipwright-build", "tekton-pipelines"}
+
+// DeployConfig contains all fields required to run build-load as a Job
+// inside of the cluster
+type DeployConfig struct {
+	Namespace string
+	Name      string
+	Image     string
+	Results   string
+	PVCSize   string
+	Args      []string
+
+	// TargetNamespaces are the namespaces in which the Job runs buildruns,
+	// by default they are taken from the namespace flags of the arguments
+	TargetNamespaces []string
+
+	// ControllerNamespaces are the namespaces of the controllers, in which
+	// the Job reads the pods and scrapes their metrics
+	ControllerNamespaces []string
+}
+
+func (deployCfg DeployConfig) resultsName() string {
+	return fmt.Sprintf("%s-results", deployCfg.Name)
+}
+
+// targetNamespaces returns the namespaces to grant access to, either the
+// configured ones, or the ones of the --namespace and --namespaces flags,
+// and whether namespaces are created using --namespace-count
+func (deployCfg DeployConfig) targetNamespaces() ([]string, bool) {
+	var namespaceCount = len(argValues(deployCfg.Args, "namespace-count")) > 0
+
+	if len(deployCfg.TargetNamespaces) > 0 {
+		return deployCfg.TargetNamespaces, namespaceCount
+	}
+
+	// the secrets are copied from the namespace defined by --namespace,
+	// which defaults to the default namespace
+	var namespaces = argValues(deployCfg.Args, "namespace")
+	if len(namespaces) == 0 {
+		namespaces = []string{"default"}
+	}
+
+	for _, value := range argValues(deployCfg.Args, "namespaces") {
+		namespaces = append(namespaces, strings.Split(value, ",")...)
+	}
+
+	var result = []string{}
+	var known = map[string]struct{}{}
+	for _, namespace := range namespaces {
+		if _, ok := known[namespace]; !ok && namespace != "" {
+			known[namespace] = struct{}{}
+			result = append(result, namespace)
+		}
+	}
+
+	return result, namespaceCount
+}
+
+// argValues returns the values of a flag in the arguments, which are
+// either configured using --flag=value, or --flag value
+func argValues(args []string, name string) []string {
+	var values = []string{}
+	for i, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--"+name+"="):
+			values = append(values, strings.TrimPrefix(arg, "--"+name+"="))
+
+		case arg == "--"+name && i+1 < len(args):
+			values = append(values, args[i+1])
+		}
+	}
+
+	return values
+}
+
+func (deployCfg DeployConfig) labels() map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":     "build-load",
+		"app.kubernetes.io/instance": deployCfg.Name,
+	}
+}
+
+// RenderDeployManifests writes the YAML manifests of the service account,
+// the RBAC rules, and the Job that runs build-load inside of the cluster
+func RenderDeployManifests(deployCfg DeployConfig, w io.Writer) error {
+	objects, err := createDeployObjects(deployCfg)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "---\n%s\n", data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func createDeployObjects(deployCfg DeployConfig) ([]runtime.Object, error) {
+	var (
+		objectMeta = func(namespace string, name string) metav1.ObjectMeta {
+			return metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+				Labels:    deployCfg.labels(),
+			}
+		}
+	)
+
+	var args = append([]string{}, deployCfg.Args...)
+	args = append(args, "--in-cluster")
+
+	var volume corev1.Volume
+	switch deployCfg.Results {
+	case ResultsConfigMap:
+		args = append(args, fmt.Sprintf("--results-configmap=%s/%s", deployCfg.Namespace, deployCfg.resultsName()))
+		volume = corev1.Volume{
+			Name:         "results",
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		}
+
+	case ResultsPVC:
+		volume = corev1.Volume{
+			Name: "results",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: deployCfg.resultsName(),
+				},
+			},
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported results storage %q, use one of %s, or %s", deployCfg.Results, ResultsConfigMap, ResultsPVC)
+	}
+
+	var (
+		clusterRoleName    = fmt.Sprintf("%s-%s", deployCfg.Namespace, deployCfg.Name)
+		namespacedRoleName = fmt.Sprintf("%s-%s-namespaced", deployCfg.Namespace, deployCfg.Name)
+
+		targetNamespaces, namespaceCount = deployCfg.targetNamespaces()
+
+		controllerNamespaces = deployCfg.ControllerNamespaces
+	)
+
+	if len(controllerNamespaces) == 0 {
+		controllerNamespaces = DefaultControllerNamespaces
+	}
+
+	var subjects = []rbacv1.Subject{
+		{
+			Kind:      "ServiceAccount",
+			Namespace: deployCfg.Namespace,
+			Name:      deployCfg.Name,
+		},
+	}
+
+	var roleRef = func(kind string, name string) rbacv1.RoleRef {
+		return rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     kind,
+			Name:     name,
+		}
+	}
+
+	// The cluster role only allows to read cluster scoped resources, to list
+	// deployments to find the controllers, and to list the running pods of
+	// all namespaces, which the capacity check subtracts from the nodes
+	var clusterRules = []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"nodes"},
+			Verbs:     []string{"get", "list"},
+		},
+		{
+			APIGroups: []string{""},
+			Resources: []string{"pods"},
+			Verbs:     []string{"list"},
+		},
+		{
+			APIGroups: []string{"metrics.k8s.io"},
+			Resources: []string{"pods", "nodes"},
+			Verbs:     []string{"get", "list"},
+		},
+		{
+			APIGroups: []string{"apps"},
+			Resources: []string{"deployments"},
+			Verbs:     []string{"list"},
+		},
+		{
+			APIGroups: []string{"shipwright.io"},
+			Resources: []string{"clusterbuildstrategies"},
+			Verbs:     []string{"get", "list"},
+		},
+		{
+			APIGroups: []string{"authorization.k8s.io"},
+			Resources: []string{"selfsubjectaccessreviews"},
+			Verbs:     []string{"create"},
+		},
+	}
+
+	if namespaceCount {
+		clusterRules = append(clusterRules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"namespaces"},
+			Verbs:     []string{"create", "delete"},
+		})
+	}
+
+	var objects = []runtime.Object{
+		&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: objectMeta(deployCfg.Namespace, deployCfg.Name),
+		},
+
+		&rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+			ObjectMeta: objectMeta("", clusterRoleName),
+			Rules:      clusterRules,
+		},
+
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+			ObjectMeta: objectMeta("", clusterRoleName),
+			RoleRef:    roleRef("ClusterRole", clusterRoleName),
+			Subjects:   subjects,
+		},
+
+		// The rules to run buildruns are only granted in the target
+		// namespaces using role bindings
+		&rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+			ObjectMeta: objectMeta("", namespacedRoleName),
+			Rules: []rbacv1.PolicyRule{
+				{
+					APIGroups: []string{"shipwright.io"},
+					Resources: []string{"builds", "buildruns"},
+					Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+				},
+				{
+					APIGroups: []string{"shipwright.io"},
+					Resources: []string{"buildstrategies"},
+					Verbs:     []string{"get", "list", "create", "delete"},
+				},
+				{
+					APIGroups: []string{"tekton.dev"},
+					Resources: []string{"taskruns"},
+					Verbs:     []string{"get", "list"},
+				},
+				{
+					APIGroups: []string{""},
+					Resources: []string{"pods", "pods/log", "limitranges", "resourcequotas"},
+					Verbs:     []string{"get", "list"},
+				},
+				{
+					APIGroups: []string{""},
+					Resources: []string{"events"},
+					Verbs:     []string{"get", "list", "watch"},
+				},
+				{
+					APIGroups: []string{""},
+					Resources: []string{"secrets", "serviceaccounts"},
+					Verbs:     []string{"get", "create", "delete"},
+				},
+			},
+		},
+	}
+
+	// Namespaces created with --namespace-count do not exist before the
+	// run, which is why the rules can only be granted cluster-wide
+	if namespaceCount {
+		objects = append(objects, &rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+			ObjectMeta: objectMeta("", namespacedRoleName),
+			RoleRef:    roleRef("ClusterRole", namespacedRoleName),
+			Subjects:   subjects,
+		})
+	}
+
+	for _, namespace := range targetNamespaces {
+		objects = append(objects, &rbacv1.RoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+			ObjectMeta: objectMeta(namespace, deployCfg.Name),
+			RoleRef:    roleRef("ClusterRole", namespacedRoleName),
+			Subjects:   subjects,
+		})
+	}
+
+	// The controller pods are read and their metrics are scraped through
+	// the pod proxy in the namespaces of the controllers
+	for _, namespace := range controllerNamespaces {
+		var name = fmt.Sprintf("%s-controllers", deployCfg.Name)
+		objects = append(objects,
+			&rbacv1.Role{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+				ObjectMeta: objectMeta(namespace, name),
+				Rules: []rbacv1.PolicyRule{
+					{
+						APIGroups: []string{""},
+						Resources: []string{"pods"},
+						Verbs:     []string{"get", "list"},
+					},
+					{
+						APIGroups: []string{""},
+						Resources: []string{"pods/proxy"},
+						Verbs:     []string{"get"},
+					},
+				},
+			},
+			&rbacv1.RoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+				ObjectMeta: objectMeta(namespace, name),
+				RoleRef:    roleRef("Role", name),
+				Subjects:   subjects,
+			},
+		)
+	}
+
+	if deployCfg.Results == ResultsConfigMap {
+		objects = append(objects,
+			&rbacv1.Role{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+				ObjectMeta: objectMeta(deployCfg.Namespace, deployCfg.resultsName()),
+				Rules: []rbacv1.PolicyRule{
+					{
+						APIGroups: []string{""},
+						Resources: []string{"configmaps"},
+						Verbs:     []string{"get", "create", "update"},
+					},
+				},
+			},
+			&rbacv1.RoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+				ObjectMeta: objectMeta(deployCfg.Namespace, deployCfg.resultsName()),
+				RoleRef:    roleRef("Role", deployCfg.resultsName()),
+				Subjects:   subjects,
+			},
+		)
+	}
+
+	if deployCfg.Results == ResultsPVC {
+		size, err := resource.ParseQuantity(deployCfg.PVCSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse volume size %s: %w", deployCfg.PVCSize, err)
+		}
+
+		objects = append(objects, &corev1.PersistentVolumeClaim{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"},
+			ObjectMeta: objectMeta(deployCfg.Namespace, deployCfg.resultsName()),
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: size},
+				},
+			},
+		})
+	}
+
+	objects = append(objects, &batchv1.Job{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+		ObjectMeta: objectMeta(deployCfg.Namespace, deployCfg.Name),
+		Spec: batchv1.JobSpec{
+			BackoffLimit: p(int32(0)),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: deployCfg.labels()},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: deployCfg.Name,
+					RestartPolicy:      corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:       "build-load",
+							Image:      deployCfg.Image,
+							Args:       args,
+							WorkingDir: resultsMountPath,
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: volume.Name, MountPath: resultsMountPath},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{volume},
+				},
+			},
+		},
+	})
+
+	return objects, nil
+}
+
+// PublishResults stores the provided report files in a config map, an
+// existing config map with the same name is updated
+func PublishResults(kubeAccess KubeAccess, namespace string, name string, files map[string][]byte) error {
+	var data = map[string]string{}
+	for filename, content := range files {
+		data[filepath.Base(filename)] = string(content)
+	}
+
+	configMaps := kubeAccess.Client.CoreV1().ConfigMaps(namespace)
+
+	configMap, err := configMaps.Get(kubeAccess.Context, name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		if err := checkResultsSize(data); err != nil {
+			return err
+		}
+
+		debug("Create results config map %s/%s", namespace, name)
+		_, err = configMaps.Create(kubeAccess.Context, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Data:       data,
+		}, metav1.CreateOptions{})
+
+		return err
+
+	case err != nil:
+		return err
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+
+	for key, value := range data {
+		configMap.Data[key] = value
+	}
+
+	if err := checkResultsSize(configMap.Data); err != nil {
+		return err
+	}
+
+	debug("Update results config map %s/%s", namespace, name)
+	_, err = configMaps.Update(kubeAccess.Context, configMap, metav1.UpdateOptions{})
+	return err
+}
+
+// checkResultsSize fails in case the reports do not fit into a config map,
+// which would otherwise only be rejected by the API server
+func checkResultsSize(data map[string]string) error {
+	var size int
+	for key, value := range data {
+		size += len(key) + len(value)
+	}
+
+	if size > maxResultsConfigMapSize {
+		return fmt.Errorf("the reports with a size of %s exceed the size limit of a config map (%s), use --results=pvc to store the results in a volume",
+			humanReadableMemory(resource.NewQuantity(int64(size), resource.BinarySI)),
+			humanReadableMemory(resource.NewQuantity(maxResultsConfigMapSize, resource.BinarySI)),
+		)
+	}
+
+	return nil
+}
+
+// FetchResults waits for the build-load Job to finish and downloads the
+// Job output and the reports into the given directory
+func FetchResults(kubeAccess KubeAccess, deployCfg DeployConfig, timeout time.Duration, dir string) error {
+	if err := os.MkdirAll(dir, os.FileMode(0755)); err != nil {
+		return err
+	}
+
+	job, err := waitForJobCompletion(kubeAccess, deployCfg.Namespace, deployCfg.Name, timeout)
+	if err != nil {
+		return err
+	}
+
+	pods, err := kubeAccess.Client.CoreV1().Pods(job.Namespace).List(kubeAccess.Context, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", job.Name),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, pod := range pods.Items {
+		logs, err := podLogs(kubeAccess, pod.Namespace, pod.Name, "build-load")
+		if err != nil {
+			return err
+		}
+
+		if err := writeResultFile(dir, fmt.Sprintf("%s.log", pod.Name), logs); err != nil {
+			return err
+		}
+	}
+
+	switch deployCfg.Results {
+	case ResultsConfigMap:
+		configMap, err := kubeAccess.Client.CoreV1().ConfigMaps(deployCfg.Namespace).Get(kubeAccess.Context, deployCfg.resultsName(), metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get results config map %s: %w", deployCfg.resultsName(), err)
+		}
+
+		for filename, content := range configMap.Data {
+			if err := writeResultFile(dir, filename, []byte(content)); err != nil {
+				return err
+			}
+		}
+
+	case ResultsPVC:
+		return fetchResultsFromVolume(kubeAccess, deployCfg, dir)
+	}
+
+	return nil
+}
+
+func waitForJobCompletion(kubeAccess KubeAccess, namespace string, name string, timeout time.Duration) (*batchv1.Job, error) {
+	var job *batchv1.Job
+
+	debug("Polling to wait for completion of job %s within %v", name, timeout)
+	err := wait.PollUntilContextTimeout(kubeAccess.Context, 5*time.Second, timeout, true, func(ctx context.Context) (done bool, err error) {
+		job, err = kubeAccess.Client.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		return job.Status.Succeeded > 0 || job.Status.Failed > 0, nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed while waiting for job %s to finish: %w", name, err)
+	}
+
+	if job.Status.Failed > 0 {
+		warn("job %s failed, results might be incomplete, check the logs for details\n", name)
+	}
+
+	return job, nil
+}
+
+// fetchResultsFromVolume uses a short-lived helper pod, which mounts the
+// results volume and prints its content as a base64 encoded tar archive
+func fetchResultsFromVolume(kubeAccess KubeAccess, deployCfg DeployConfig, dir string) error {
+	var name = fmt.Sprintf("%s-fetch", deployCfg.resultsName())
+
+	pod, err := kubeAccess.Client.CoreV1().Pods(deployCfg.Namespace).Create(kubeAccess.Context, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: deployCfg.Namespace,
+			Name:      name,
+			Labels:    deployCfg.labels(),
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{
+				{
+					Name:    "fetch",
+					Image:   resultsHelperImage,
+					Command: []string{"sh", "-c", fmt.Sprintf("tar -C %s -cf - . | base64", resultsMountPath)},
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "results", MountPath: resultsMountPath, ReadOnly: true},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "results",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: deployCfg.resultsName(),
+							ReadOnly:  true,
+						},
+					},
+				},
+			},
+		},
+	}, metav1.CreateOptions{})
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		cleanupAccess := kubeAccess.forCleanup()
+		if err := cleanupAccess.Client.CoreV1().Pods(pod.Namespace).Delete(cleanupAccess.Context, pod.Name, *defaultDeleteOptions); err != nil {
+			warn("failed to delete pod %s, %v\n", pod.Name, err)
+		}
+	}()
+
+	err = wait.PollUntilContextTimeout(kubeAccess.Context, 1*time.Second, defaultBuildRunWaitTimeout, true, func(ctx context.Context) (done bool, err error) {
+		pod, err = kubeAccess.Client.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		switch pod.Status.Phase {
+		case corev1.PodSucceeded:
+			return true, nil
+
+		case corev1.PodFailed:
+			return false, fmt.Errorf("pod %s failed to read the results volume", pod.Name)
+		}
+
+		return false, nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	encoded, err := podLogs(kubeAccess, pod.Namespace, pod.Name, "fetch")
+	if err != nil {
+		return err
+	}
+
+	archive, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(encoded), nil)))
+	if err != nil {
+		return err
+	}
+
+	reader := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+
+		if err := writeResultFile(dir, header.Name, content); err != nil {
+			return err
+		}
+	}
+}
+
+func podLogs(kubeAccess KubeAccess, namespace string, name string, container string) ([]byte, error) {
+	return kubeAccess.Client.
+		CoreV1().
+		Pods(namespace).
+		GetLogs(name, &corev1.PodLogOptions{Container: container}).
+		DoRaw(kubeAccess.Context)
+}
+
+func writeResultFile(dir string, name string, content []byte) error {
+	filename := filepath.Join(dir, filepath.Base(filepath.Clean(name)))
+
+	debug("Write result file %s", filename)
+	return os.WriteFile(filename, content, os.FileMode(0644))
+}
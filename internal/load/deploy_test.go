@@ -0,0 +1,284 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+)
+
+var _ = Describe("in-cluster deployment manifests", func() {
+	var deployCfg = func(results string) DeployConfig {
+		return DeployConfig{
+			Namespace: "test-namespace",
+			Name:      "build-load",
+			Image:     "registry.example.com/build-load:latest",
+			Results:   results,
+			PVCSize:   "100Mi",
+			Args:      []string{"buildruns", "--parallel=10"},
+		}
+	}
+
+	// render returns the rendered manifests by their kind, namespace, and
+	// name, for example ClusterRole//build-load or Job/test-namespace/build-load
+	var render = func(deployCfg DeployConfig) map[string][]byte {
+		var buf bytes.Buffer
+		Expect(RenderDeployManifests(deployCfg, &buf)).To(Succeed())
+
+		var manifests = map[string][]byte{}
+		for _, document := range strings.Split(buf.String(), "---\n") {
+			if strings.TrimSpace(document) == "" {
+				continue
+			}
+
+			var obj struct {
+				metav1.TypeMeta   `json:",inline"`
+				metav1.ObjectMeta `json:"metadata"`
+			}
+
+			Expect(yaml.Unmarshal([]byte(document), &obj)).To(Succeed())
+
+			var key = obj.Kind + "/" + obj.Namespace + "/" + obj.Name
+			Expect(manifests).ToNot(HaveKey(key))
+			manifests[key] = []byte(document)
+		}
+
+		return manifests
+	}
+
+	var decode = func(manifests map[string][]byte, key string, obj interface{}) {
+		Expect(manifests).To(HaveKey(key))
+		Expect(yaml.Unmarshal(manifests[key], obj)).To(Succeed())
+	}
+
+	// resources returns all resources that the rules grant the verb for
+	var resources = func(rules []rbacv1.PolicyRule, verb string) []string {
+		var result = []string{}
+		for _, rule := range rules {
+			for _, candidate := range rule.Verbs {
+				if candidate == verb {
+					result = append(result, rule.Resources...)
+				}
+			}
+		}
+
+		return result
+	}
+
+	Context("storing results in a config map", func() {
+		It("should render a Job that publishes the results in a config map", func() {
+			manifests := render(deployCfg(ResultsConfigMap))
+			Expect(manifests).ToNot(HaveKey("PersistentVolumeClaim/test-namespace/build-load-results"))
+
+			var serviceAccount corev1.ServiceAccount
+			decode(manifests, "ServiceAccount/test-namespace/build-load", &serviceAccount)
+			Expect(serviceAccount.Namespace).To(Equal("test-namespace"))
+			Expect(serviceAccount.Name).To(Equal("build-load"))
+
+			var clusterRoleBinding rbacv1.ClusterRoleBinding
+			decode(manifests, "ClusterRoleBinding//test-namespace-build-load", &clusterRoleBinding)
+			Expect(clusterRoleBinding.RoleRef.Kind).To(Equal("ClusterRole"))
+			Expect(clusterRoleBinding.Subjects).To(ConsistOf(rbacv1.Subject{
+				Kind:      "ServiceAccount",
+				Namespace: "test-namespace",
+				Name:      "build-load",
+			}))
+
+			var job batchv1.Job
+			decode(manifests, "Job/test-namespace/build-load", &job)
+			Expect(job.Namespace).To(Equal("test-namespace"))
+			Expect(job.Spec.Template.Spec.ServiceAccountName).To(Equal("build-load"))
+			Expect(job.Spec.Template.Spec.Containers).To(HaveLen(1))
+
+			container := job.Spec.Template.Spec.Containers[0]
+			Expect(container.Image).To(Equal("registry.example.com/build-load:latest"))
+			Expect(container.Args).To(Equal([]string{
+				"buildruns",
+				"--parallel=10",
+				"--in-cluster",
+				"--results-configmap=test-namespace/build-load-results",
+			}))
+
+			Expect(job.Spec.Template.Spec.Volumes).To(HaveLen(1))
+			Expect(job.Spec.Template.Spec.Volumes[0].EmptyDir).ToNot(BeNil())
+		})
+
+		It("should only grant access to the results config map in the namespace of the Job", func() {
+			manifests := render(deployCfg(ResultsConfigMap))
+
+			var role rbacv1.Role
+			decode(manifests, "Role/test-namespace/build-load-results", &role)
+			Expect(resources(role.Rules, "update")).To(Equal([]string{"configmaps"}))
+
+			var roleBinding rbacv1.RoleBinding
+			decode(manifests, "RoleBinding/test-namespace/build-load-results", &roleBinding)
+			Expect(roleBinding.RoleRef.Kind).To(Equal("Role"))
+			Expect(roleBinding.RoleRef.Name).To(Equal("build-load-results"))
+		})
+
+		It("should publish the reports in the config map", func() {
+			var client = fake.NewSimpleClientset()
+			var kubeAccess = KubeAccess{Context: context.Background(), Client: client}
+
+			Expect(PublishResults(kubeAccess, "test-namespace", "build-load-results", map[string][]byte{"/tmp/results.csv": []byte("a,b")})).To(Succeed())
+			Expect(PublishResults(kubeAccess, "test-namespace", "build-load-results", map[string][]byte{"results.html": []byte("<html/>")})).To(Succeed())
+
+			configMap, err := client.CoreV1().ConfigMaps("test-namespace").Get(context.Background(), "build-load-results", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configMap.Data).To(Equal(map[string]string{
+				"results.csv":  "a,b",
+				"results.html": "<html/>",
+			}))
+		})
+
+		It("should fail to publish reports that exceed the size limit of a config map", func() {
+			var client = fake.NewSimpleClientset()
+			var kubeAccess = KubeAccess{Context: context.Background(), Client: client}
+
+			err := PublishResults(kubeAccess, "test-namespace", "build-load-results", map[string][]byte{"results.html": bytes.Repeat([]byte("x"), 1024*1024)})
+			Expect(err).To(MatchError(ContainSubstring("--results=pvc")))
+
+			_, err = client.CoreV1().ConfigMaps("test-namespace").Get(context.Background(), "build-load-results", metav1.GetOptions{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("storing results in a volume", func() {
+		It("should render a persistent volume claim mounted by the Job", func() {
+			manifests := render(deployCfg(ResultsPVC))
+
+			var pvc corev1.PersistentVolumeClaim
+			decode(manifests, "PersistentVolumeClaim/test-namespace/build-load-results", &pvc)
+			Expect(pvc.Name).To(Equal("build-load-results"))
+			Expect(pvc.Spec.Resources.Requests.Storage().String()).To(Equal("100Mi"))
+
+			var job batchv1.Job
+			decode(manifests, "Job/test-namespace/build-load", &job)
+			Expect(job.Spec.Template.Spec.Volumes).To(HaveLen(1))
+			Expect(job.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim).ToNot(BeNil())
+			Expect(job.Spec.Template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("build-load-results"))
+			Expect(job.Spec.Template.Spec.Containers[0].Args).ToNot(ContainElement(HavePrefix("--results-configmap")))
+		})
+	})
+
+	Context("granting permissions", func() {
+		It("should limit the cluster role to reading cluster scoped resources", func() {
+			manifests := render(deployCfg(ResultsPVC))
+
+			var clusterRole rbacv1.ClusterRole
+			decode(manifests, "ClusterRole//test-namespace-build-load", &clusterRole)
+			Expect(resources(clusterRole.Rules, "list")).To(ConsistOf("nodes", "pods", "pods", "nodes", "deployments", "clusterbuildstrategies"))
+			for _, resource := range []string{"secrets", "serviceaccounts", "configmaps", "pods/proxy"} {
+				Expect(resources(clusterRole.Rules, "get")).ToNot(ContainElement(resource))
+			}
+
+			Expect(resources(clusterRole.Rules, "create")).To(Equal([]string{"selfsubjectaccessreviews"}))
+			Expect(resources(clusterRole.Rules, "delete")).To(BeEmpty())
+
+			Expect(manifests).ToNot(HaveKey("Role/test-namespace/build-load-results"))
+		})
+
+		It("should bind the rules to run buildruns in the namespaces of the command", func() {
+			var cfg = deployCfg(ResultsPVC)
+			cfg.Args = []string{"buildruns", "--namespace", "ns-a", "--namespaces=ns-b,ns-c", "--namespaces", "ns-a"}
+			manifests := render(cfg)
+
+			var clusterRole rbacv1.ClusterRole
+			decode(manifests, "ClusterRole//test-namespace-build-load-namespaced", &clusterRole)
+			Expect(resources(clusterRole.Rules, "create")).To(ContainElements("buildruns", "secrets", "serviceaccounts"))
+
+			for _, namespace := range []string{"ns-a", "ns-b", "ns-c"} {
+				var roleBinding rbacv1.RoleBinding
+				decode(manifests, "RoleBinding/"+namespace+"/build-load", &roleBinding)
+				Expect(roleBinding.RoleRef).To(Equal(rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "test-namespace-build-load-namespaced"}))
+			}
+
+			Expect(manifests).ToNot(HaveKey("RoleBinding/default/build-load"))
+			Expect(manifests).ToNot(HaveKey("ClusterRoleBinding//test-namespace-build-load-namespaced"))
+		})
+
+		It("should bind the rules to run buildruns in the configured target namespaces", func() {
+			var cfg = deployCfg(ResultsPVC)
+			cfg.TargetNamespaces = []string{"ns-x"}
+			manifests := render(cfg)
+
+			Expect(manifests).To(HaveKey("RoleBinding/ns-x/build-load"))
+			Expect(manifests).ToNot(HaveKey("RoleBinding/default/build-load"))
+		})
+
+		It("should grant access to the controller pods in the controller namespaces", func() {
+			var cfg = deployCfg(ResultsPVC)
+			cfg.ControllerNamespaces = []string{"shipwright"}
+			manifests := render(cfg)
+
+			var role rbacv1.Role
+			decode(manifests, "Role/shipwright/build-load-controllers", &role)
+			Expect(resources(role.Rules, "get")).To(ConsistOf("pods", "pods/proxy"))
+			Expect(manifests).To(HaveKey("RoleBinding/shipwright/build-load-controllers"))
+			Expect(manifests).ToNot(HaveKey("Role/tekton-pipelines/build-load-controllers"))
+		})
+
+		It("should only allow to create namespaces when namespaces are created by the command", func() {
+			var cfg = deployCfg(ResultsPVC)
+			cfg.Args = []string{"buildruns", "--namespace-count=3"}
+			manifests := render(cfg)
+
+			var clusterRole rbacv1.ClusterRole
+			decode(manifests, "ClusterRole//test-namespace-build-load", &clusterRole)
+			Expect(resources(clusterRole.Rules, "create")).To(ContainElement("namespaces"))
+			Expect(resources(clusterRole.Rules, "delete")).To(Equal([]string{"namespaces"}))
+
+			var clusterRoleBinding rbacv1.ClusterRoleBinding
+			decode(manifests, "ClusterRoleBinding//test-namespace-build-load-namespaced", &clusterRoleBinding)
+			Expect(clusterRoleBinding.RoleRef.Name).To(Equal("test-namespace-build-load-namespaced"))
+		})
+	})
+
+	Context("checking the cluster capacity", func() {
+		It("should allow to list the running pods of all namespaces", func() {
+			manifests := render(deployCfg(ResultsPVC))
+
+			var clusterRole rbacv1.ClusterRole
+			decode(manifests, "ClusterRole//test-namespace-build-load", &clusterRole)
+			Expect(clusterRole.Rules).To(ContainElement(rbacv1.PolicyRule{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"list"},
+			}))
+		})
+	})
+
+	Context("using an unknown results storage", func() {
+		It("should fail to render the manifests", func() {
+			var buf bytes.Buffer
+			Expect(RenderDeployManifests(deployCfg("s3"), &buf)).ToNot(Succeed())
+		})
+	})
+})
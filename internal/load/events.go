@@ -0,0 +1,492 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gonvenience/bunt"
+	"github.com/gonvenience/neat"
+	"github.com/gonvenience/text"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"knative.dev/pkg/kmeta"
+
+	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+)
+
+const (
+	testPlanPrefix      = "test-plan-step"
+	topEventReasons     = 10
+	eventWatchRetryWait = 5 * time.Second
+)
+
+// RecordedEvent is a Kubernetes event of an object build-load created
+type RecordedEvent struct {
+	Time    time.Time
+	Kind    string
+	Name    string
+	Type    string
+	Reason  string
+	Message string
+	Count   int32
+}
+
+// RunEvents are the events of the build, buildrun, taskrun, and pod of a
+// single buildrun
+type RunEvents struct {
+	Namespace string
+	BuildRun  string
+	Events    []RecordedEvent
+}
+
+// EventReason is the number of events with the same type and reason, and
+// the latest message as an example
+type EventReason struct {
+	Type    string
+	Reason  string
+	Count   int32
+	Objects int
+	Message string
+}
+
+// EventSummary contains the events of each buildrun and the event reasons
+// of all objects build-load created during the run
+type EventSummary struct {
+	Runs    []RunEvents
+	Reasons []EventReason
+}
+
+// EventRecorder watches the events of all objects build-load creates in the
+// namespaces of the run, objects are identified by their name prefix
+type EventRecorder struct {
+	kubeAccess KubeAccess
+	prefix     string
+	start      time.Time
+
+	sync.Mutex
+	events map[types.UID]corev1.Event
+	runs   []eventRun
+	warned bool
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+type eventRun struct {
+	namespace string
+	buildRun  string
+	names     []string
+}
+
+// StartEventRecording watches the events in the namespaces of the naming
+// configuration until the recording is stopped
+func StartEventRecording(kubeAccess KubeAccess, namingCfg NamingConfig) *EventRecorder {
+	var namespaces = namingCfg.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{namingCfg.Namespace}
+	}
+
+	var recorder = &EventRecorder{
+		kubeAccess: kubeAccess,
+		prefix:     namingCfg.Prefix,
+		start:      time.Now().Truncate(time.Second),
+		events:     map[types.UID]corev1.Event{},
+		stop:       make(chan struct{}),
+	}
+
+	for _, namespace := range namespaces {
+		recorder.wg.Add(1)
+		go recorder.watch(namespace)
+	}
+
+	return recorder
+}
+
+// TestPlanNamingConfig returns the naming config that matches the names of
+// the buildruns of the test plan steps
+func TestPlanNamingConfig(testplan TestPlan) NamingConfig {
+	return NamingConfig{Namespace: testplan.Namespace, Prefix: testPlanPrefix}
+}
+
+// Stop ends the recording and returns the events of each buildrun and the
+// event reasons sorted by their number of occurrences
+func (recorder *EventRecorder) Stop() EventSummary {
+	close(recorder.stop)
+	recorder.wg.Wait()
+
+	recorder.Lock()
+	defer recorder.Unlock()
+
+	var summary = EventSummary{}
+	for _, run := range recorder.runs {
+		summary.Runs = append(summary.Runs, RunEvents{
+			Namespace: run.namespace,
+			BuildRun:  run.buildRun,
+			Events:    recorder.eventsOf(run.namespace, run.names...),
+		})
+	}
+
+	var reasons = map[string]*EventReason{}
+	var objects = map[string]map[string]struct{}{}
+	var latest = map[string]time.Time{}
+	for _, event := range recorder.events {
+		var key = event.Type + "/" + event.Reason
+		reason, ok := reasons[key]
+		if !ok {
+			reason = &EventReason{Type: event.Type, Reason: event.Reason}
+			reasons[key] = reason
+			objects[key] = map[string]struct{}{}
+		}
+
+		var recorded = newRecordedEvent(event)
+		reason.Count += recorded.Count
+		objects[key][recorded.Kind+"/"+recorded.Name] = struct{}{}
+
+		if !recorded.Time.Before(latest[key]) {
+			latest[key], reason.Message = recorded.Time, recorded.Message
+		}
+	}
+
+	for key, reason := range reasons {
+		reason.Objects = len(objects[key])
+		summary.Reasons = append(summary.Reasons, *reason)
+	}
+
+	sort.Slice(summary.Reasons, func(i, j int) bool {
+		if summary.Reasons[i].Count != summary.Reasons[j].Count {
+			return summary.Reasons[i].Count > summary.Reasons[j].Count
+		}
+
+		return summary.Reasons[i].Reason < summary.Reasons[j].Reason
+	})
+
+	return summary
+}
+
+// attach associates the events of the build, buildrun, taskrun, and pod with
+// the buildrun, the events are resolved when the recording is stopped, so
+// that events that arrive late are included
+func (recorder *EventRecorder) attach(buildRun *shipwrightBuild.BuildRun) {
+	if recorder == nil || buildRun == nil {
+		return
+	}
+
+	var names = objectNames(*buildRun)
+
+	recorder.Lock()
+	defer recorder.Unlock()
+	recorder.runs = append(recorder.runs, eventRun{namespace: buildRun.Namespace, buildRun: buildRun.Name, names: names})
+}
+
+// eventsOfBuildRun returns the events recorded so far for the objects of
+// the buildrun
+func (recorder *EventRecorder) eventsOfBuildRun(buildRun shipwrightBuild.BuildRun) []RecordedEvent {
+	if recorder == nil {
+		return nil
+	}
+
+	var names = objectNames(buildRun)
+
+	recorder.Lock()
+	defer recorder.Unlock()
+	return recorder.eventsOf(buildRun.Namespace, names...)
+}
+
+// objectNames returns the names of the objects of the buildrun based on its
+// status without looking them up, the pod name is derived from the taskrun
+// name the same way Tekton names the pod of a taskrun
+func objectNames(buildRun shipwrightBuild.BuildRun) []string {
+	var names = []string{buildRun.Name}
+	if buildRun.Spec.BuildRef != nil && buildRun.Spec.BuildRef.Name != buildRun.Name {
+		names = append(names, buildRun.Spec.BuildRef.Name)
+	}
+
+	if buildRun.Status.LatestTaskRunRef != nil {
+		names = append(names,
+			*buildRun.Status.LatestTaskRunRef,
+			kmeta.ChildName(*buildRun.Status.LatestTaskRunRef, "-pod"),
+		)
+	}
+
+	return names
+}
+
+// eventsOf returns the events of the objects with the given names sorted by
+// time, the caller has to hold the lock
+func (recorder *EventRecorder) eventsOf(namespace string, names ...string) []RecordedEvent {
+	var lookup = map[string]struct{}{}
+	for _, name := range names {
+		lookup[name] = struct{}{}
+	}
+
+	var events = []RecordedEvent{}
+	for _, event := range recorder.events {
+		if _, ok := lookup[event.InvolvedObject.Name]; ok && event.Namespace == namespace {
+			events = append(events, newRecordedEvent(event))
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
+
+func (recorder *EventRecorder) watch(namespace string) {
+	defer recorder.wg.Done()
+
+	var resourceVersion string
+	for {
+		watcher, err := recorder.kubeAccess.Client.CoreV1().Events(namespace).Watch(recorder.kubeAccess.Context, metav1.ListOptions{ResourceVersion: resourceVersion})
+		if err != nil {
+			recorder.warnOnce("unable to watch events in namespace %s: %v", namespace, err)
+
+			select {
+			case <-recorder.stop:
+				return
+
+			case <-recorder.kubeAccess.Context.Done():
+				return
+
+			case <-time.After(eventWatchRetryWait):
+				continue
+			}
+		}
+
+		if stopped := recorder.receive(watcher, &resourceVersion); stopped {
+			return
+		}
+	}
+}
+
+// receive records the events of the watch until it is closed, and returns
+// whether the recording is stopped
+func (recorder *EventRecorder) receive(watcher watch.Interface, resourceVersion *string) bool {
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-recorder.stop:
+			recorder.drain(watcher)
+			return true
+
+		case <-recorder.kubeAccess.Context.Done():
+			return true
+
+		case update, ok := <-watcher.ResultChan():
+			if !ok {
+				return false
+			}
+
+			if !recorder.update(update, resourceVersion) {
+				return false
+			}
+		}
+	}
+}
+
+// update records the event of a watch update, and returns whether the watch
+// can be continued
+func (recorder *EventRecorder) update(update watch.Event, resourceVersion *string) bool {
+	switch update.Type {
+	case watch.Added, watch.Modified:
+		if event, ok := update.Object.(*corev1.Event); ok {
+			*resourceVersion = event.ResourceVersion
+			recorder.record(*event)
+		}
+
+	case watch.Error:
+		// the resource version might be too old, the events that are seen
+		// again when watching from the start are deduplicated
+		*resourceVersion = ""
+		return false
+	}
+
+	return true
+}
+
+// drain records the updates that were already received when the recording
+// is stopped
+func (recorder *EventRecorder) drain(watcher watch.Interface) {
+	var resourceVersion string
+	for {
+		select {
+		case update, ok := <-watcher.ResultChan():
+			if !ok || !recorder.update(update, &resourceVersion) {
+				return
+			}
+
+		default:
+			return
+		}
+	}
+}
+
+func (recorder *EventRecorder) record(event corev1.Event) {
+	if !strings.HasPrefix(event.InvolvedObject.Name, recorder.prefix+"-") {
+		return
+	}
+
+	if newRecordedEvent(event).Time.Before(recorder.start) {
+		return
+	}
+
+	recorder.Lock()
+	defer recorder.Unlock()
+	recorder.events[event.UID] = event
+}
+
+func (recorder *EventRecorder) warnOnce(format string, a ...interface{}) {
+	recorder.Lock()
+	defer recorder.Unlock()
+
+	if !recorder.warned {
+		recorder.warned = true
+		warn(format, a...)
+	}
+}
+
+func newRecordedEvent(event corev1.Event) RecordedEvent {
+	var recorded = RecordedEvent{
+		Time:    event.LastTimestamp.Time,
+		Kind:    event.InvolvedObject.Kind,
+		Name:    event.InvolvedObject.Name,
+		Type:    event.Type,
+		Reason:  event.Reason,
+		Message: event.Message,
+		Count:   event.Count,
+	}
+
+	switch {
+	case recorded.Time.IsZero() && !event.EventTime.IsZero():
+		recorded.Time = event.EventTime.Time
+
+	case recorded.Time.IsZero():
+		recorded.Time = event.CreationTimestamp.Time
+	}
+
+	if event.Series != nil && event.Series.Count > recorded.Count {
+		recorded.Count = event.Series.Count
+	}
+
+	if recorded.Count < 1 {
+		recorded.Count = 1
+	}
+
+	return recorded
+}
+
+// String renders the event in a single line
+func (event RecordedEvent) String() string {
+	return fmt.Sprintf("%s %s %s/%s %s: %s",
+		event.Time.Format(time.TimeOnly),
+		event.Type,
+		event.Kind,
+		event.Name,
+		event.Reason,
+		event.Message,
+	)
+}
+
+// ReasonsTable lists the most frequent event reasons
+func (summary EventSummary) ReasonsTable() [][]string {
+	var tableData = [][]string{{"Type", "Reason", "Count", "Objects", "Latest message"}}
+	for i, reason := range summary.Reasons {
+		if i == topEventReasons {
+			break
+		}
+
+		tableData = append(tableData, []string{
+			reason.Type,
+			reason.Reason,
+			strconv.Itoa(int(reason.Count)),
+			strconv.Itoa(reason.Objects),
+			reason.Message,
+		})
+	}
+
+	return tableData
+}
+
+// WarningsTable lists the warning events of each buildrun
+func (summary EventSummary) WarningsTable() [][]string {
+	var tableData = [][]string{{"BuildRun", "Time", "Object", "Reason", "Count", "Message"}}
+	for _, run := range summary.Runs {
+		for _, event := range run.Events {
+			if event.Type != corev1.EventTypeWarning {
+				continue
+			}
+
+			tableData = append(tableData, []string{
+				run.Namespace + "/" + run.BuildRun,
+				event.Time.UTC().Format(time.RFC3339),
+				event.Kind + "/" + event.Name,
+				event.Reason,
+				strconv.Itoa(int(event.Count)),
+				event.Message,
+			})
+		}
+	}
+
+	return tableData
+}
+
+// EventReport renders the most frequent event reasons during the run and the
+// number of buildruns with warning events
+func EventReport(summary EventSummary) string {
+	if len(summary.Reasons) == 0 {
+		return "No events of build-load objects during the run.\n"
+	}
+
+	var tableData = summary.ReasonsTable()
+	for i := range tableData[0] {
+		tableData[0][i] = bunt.Sprintf("*%s*", tableData[0][i])
+	}
+
+	for _, row := range tableData[1:] {
+		if row[0] == corev1.EventTypeWarning {
+			row[0] = bunt.Sprintf("DarkOrange{%s}", row[0])
+		}
+	}
+
+	table, err := neat.Table(tableData, neat.AlignRight(2, 3), neat.CustomSeparator(bunt.Sprintf(" DimGray{│} ")))
+	if err != nil {
+		panic(err)
+	}
+
+	var withWarnings int
+	for _, run := range summary.Runs {
+		for _, event := range run.Events {
+			if event.Type == corev1.EventTypeWarning {
+				withWarnings++
+				break
+			}
+		}
+	}
+
+	return bunt.Sprintf("Top event reasons during the run:\n%s\n%d of %s had warning events.\n",
+		table,
+		withWarnings,
+		text.Plural(len(summary.Runs), "buildrun"),
+	)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("event recording", func() {
+	var client *fake.Clientset
+	var kubeAccess KubeAccess
+
+	var event = func(name string, object string, eventType string, reason string, count int32) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "test", Name: name, UID: types.UID(name)},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "test", Name: object},
+			Type:           eventType,
+			Reason:         reason,
+			Message:        reason + " of " + object,
+			Count:          count,
+			LastTimestamp:  metav1.NewTime(time.Now()),
+		}
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		kubeAccess = KubeAccess{Context: context.Background(), Client: client}
+	})
+
+	It("should summarize the event reasons of objects with the naming prefix created during the run", func() {
+		var old = event("e", "load-kaniko-2-pod", corev1.EventTypeWarning, "FailedMount", 1)
+		old.LastTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+
+		recorder := StartEventRecording(kubeAccess, NamingConfig{Namespace: "test", Prefix: "load"})
+
+		Eventually(func() bool {
+			for _, action := range client.Actions() {
+				if action.GetVerb() == "watch" && action.GetResource().Resource == "events" {
+					return true
+				}
+			}
+
+			return false
+		}).Should(BeTrue())
+
+		for _, e := range []*corev1.Event{
+			event("a", "load-kaniko-0-pod", corev1.EventTypeWarning, "FailedScheduling", 3),
+			event("b", "load-kaniko-1-pod", corev1.EventTypeWarning, "FailedScheduling", 1),
+			event("c", "load-kaniko-1-pod", corev1.EventTypeNormal, "Scheduled", 1),
+			event("d", "unrelated-pod", corev1.EventTypeWarning, "BackOff", 10),
+			event("f", "load2-kaniko-0-pod", corev1.EventTypeWarning, "BackOff", 2),
+			old,
+		} {
+			_, err := client.CoreV1().Events("test").Create(context.Background(), e, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		summary := recorder.Stop()
+		Expect(summary.Reasons).To(Equal([]EventReason{
+			{Type: corev1.EventTypeWarning, Reason: "FailedScheduling", Count: 4, Objects: 2, Message: "FailedScheduling of load-kaniko-1-pod"},
+			{Type: corev1.EventTypeNormal, Reason: "Scheduled", Count: 1, Objects: 1, Message: "Scheduled of load-kaniko-1-pod"},
+		}))
+
+		Expect(EventReport(summary)).To(ContainSubstring("FailedScheduling"))
+
+		var buf bytes.Buffer
+		Expect(CreateBuildrunResultsChartJS([]Result{}, &buf, WithEvents(summary))).To(Succeed())
+		Expect(buf.String()).To(ContainSubstring("Top event reasons"))
+		Expect(buf.String()).To(ContainSubstring("<td>FailedScheduling</td><td>4</td><td>2</td>"))
+	})
+})
@@ -0,0 +1,316 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gonvenience/bunt"
+	"github.com/gonvenience/neat"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+)
+
+const (
+	shipwrightControllerName = "shipwright-build-controller"
+	tektonControllerName     = "tekton-pipelines-controller"
+	unknown                  = "unknown"
+)
+
+// versionLabels are the labels that carry the version of a deployment, in
+// the order of their precedence
+var versionLabels = []string{
+	"app.kubernetes.io/version",
+	"pipeline.tekton.dev/release",
+	"version",
+}
+
+// instanceTypeLabels are the labels that carry the instance type of a node,
+// in the order of their precedence
+var instanceTypeLabels = []string{
+	corev1.LabelInstanceTypeStable,
+	corev1.LabelInstanceType,
+}
+
+// Fingerprint describes the system under test at the start of a run, so that
+// results from different clusters or releases can be told apart
+type Fingerprint struct {
+	CollectedAt        time.Time
+	KubernetesVersion  string
+	ShipwrightVersion  string
+	TektonVersion      string
+	TektonFeatureFlags map[string]string
+	NodeCount          int
+	NodeTypes          map[string]int
+	BuildStrategies    map[string]string
+}
+
+// ReportOption specifies optional content of reports
+type ReportOption func(*reportOptions)
+
+type reportOptions struct {
+	fingerprint       *Fingerprint
+	controllerMetrics [][]string
+	resourceUsage     []UsageSample
+	apiStats          *APIStats
+	events            *EventSummary
+}
+
+// WithFingerprint embeds the cluster fingerprint into the report
+func WithFingerprint(fingerprint *Fingerprint) ReportOption {
+	return func(o *reportOptions) { o.fingerprint = fingerprint }
+}
+
+// WithControllerMetrics embeds the controller histogram deltas into the
+// report, next to the mean of the client-side results
+func WithControllerMetrics(deltas []HistogramDelta, results []Result) ReportOption {
+	return func(o *reportOptions) {
+		if len(deltas) > 0 {
+			o.controllerMetrics = ControllerMetricsTable(deltas, results)
+		}
+	}
+}
+
+// WithResourceUsage embeds the resource usage samples of the controller pods
+// and nodes into the report
+func WithResourceUsage(samples []UsageSample) ReportOption {
+	return func(o *reportOptions) { o.resourceUsage = samples }
+}
+
+// WithAPIStats embeds the statistics of the requests to the Kubernetes API
+// server into the report
+func WithAPIStats(stats APIStats) ReportOption {
+	return func(o *reportOptions) {
+		if len(stats.Requests) > 0 {
+			o.apiStats = &stats
+		}
+	}
+}
+
+// WithEvents embeds the top event reasons and the warning events of each
+// buildrun into the report
+func WithEvents(summary EventSummary) ReportOption {
+	return func(o *reportOptions) {
+		if len(summary.Reasons) > 0 {
+			o.events = &summary
+		}
+	}
+}
+
+func newReportOptions(options []ReportOption) reportOptions {
+	var result reportOptions
+	for _, option := range options {
+		option(&result)
+	}
+
+	return result
+}
+
+// CollectFingerprint collects the fingerprint of the cluster and the build
+// strategies of the build configurations, details that cannot be looked up
+// due to missing permissions are reported as unknown
+func CollectFingerprint(kubeAccess KubeAccess, namespace string, buildCfgs ...BuildConfig) *Fingerprint {
+	var fingerprint = Fingerprint{
+		CollectedAt:        time.Now(),
+		KubernetesVersion:  unknown,
+		ShipwrightVersion:  unknown,
+		TektonVersion:      unknown,
+		TektonFeatureFlags: map[string]string{},
+		NodeTypes:          map[string]int{},
+		BuildStrategies:    map[string]string{},
+	}
+
+	if version, err := kubeAccess.Client.Discovery().ServerVersion(); err == nil {
+		fingerprint.KubernetesVersion = version.GitVersion
+	} else {
+		debug("unable to look up the Kubernetes version: %v", err)
+	}
+
+	if deployments, err := kubeAccess.Client.AppsV1().Deployments("").List(kubeAccess.Context, metav1.ListOptions{}); err == nil {
+		for _, deployment := range deployments.Items {
+			switch deployment.Name {
+			case shipwrightControllerName:
+				fingerprint.ShipwrightVersion = deploymentVersion(deployment)
+
+			case tektonControllerName:
+				fingerprint.TektonVersion = deploymentVersion(deployment)
+			}
+		}
+	} else {
+		debug("unable to look up the controller deployments: %v", err)
+	}
+
+	if featureFlags, err := kubeAccess.Client.CoreV1().ConfigMaps(tektonNamespace).Get(kubeAccess.Context, tektonFeatureFlags, metav1.GetOptions{}); err == nil {
+		for key, value := range featureFlags.Data {
+			fingerprint.TektonFeatureFlags[key] = value
+		}
+	} else {
+		debug("unable to look up the Tekton feature flags: %v", err)
+	}
+
+	if nodes, err := kubeAccess.Client.CoreV1().Nodes().List(kubeAccess.Context, metav1.ListOptions{}); err == nil {
+		fingerprint.NodeCount = len(nodes.Items)
+		for _, node := range nodes.Items {
+			fingerprint.NodeTypes[nodeType(node)]++
+		}
+	} else {
+		debug("unable to look up the nodes: %v", err)
+	}
+
+	for _, buildCfg := range buildCfgs {
+		var strategyName, strategyKind = buildCfg.strategy()
+		var key = fmt.Sprintf("%s/%s", strategyKind, strategyName)
+		if _, ok := fingerprint.BuildStrategies[key]; ok {
+			continue
+		}
+
+		var spec interface{}
+		switch strategyKind {
+		case shipwrightBuild.NamespacedBuildStrategyKind:
+			if buildStrategy, err := getBuildStrategy(kubeAccess, namespace, strategyName); err == nil {
+				spec = buildStrategy.Spec
+			}
+
+		default:
+			if clusterBuildStrategy, err := getClusterBuildStrategy(kubeAccess, strategyName); err == nil {
+				spec = clusterBuildStrategy.Spec
+			}
+		}
+
+		fingerprint.BuildStrategies[key] = specHash(spec)
+	}
+
+	return &fingerprint
+}
+
+// CollectTestPlanFingerprint collects the fingerprint of the cluster and the
+// build strategies of all test plan steps
+func CollectTestPlanFingerprint(kubeAccess KubeAccess, testplan TestPlan) *Fingerprint {
+	var buildCfgs = make([]BuildConfig, 0, len(testplan.Steps))
+	for _, step := range testplan.Steps {
+		buildCfgs = append(buildCfgs, stepBuildConfig(step))
+	}
+
+	return CollectFingerprint(kubeAccess, testplan.Namespace, buildCfgs...)
+}
+
+// deploymentVersion returns the version label of the deployment, or the
+// image of its first container in case there is no version label
+func deploymentVersion(deployment appsv1.Deployment) string {
+	for _, label := range versionLabels {
+		if version, ok := deployment.Labels[label]; ok && version != "" {
+			return version
+		}
+	}
+
+	if containers := deployment.Spec.Template.Spec.Containers; len(containers) > 0 {
+		return containers[0].Image
+	}
+
+	return unknown
+}
+
+// nodeType describes the instance type, architecture, and capacity of a
+// node, so that identical nodes can be counted
+func nodeType(node corev1.Node) string {
+	var instanceType = unknown
+	for _, label := range instanceTypeLabels {
+		if value, ok := node.Labels[label]; ok && value != "" {
+			instanceType = value
+			break
+		}
+	}
+
+	return fmt.Sprintf("%s (%s, %v CPU, %s)",
+		instanceType,
+		node.Status.NodeInfo.Architecture,
+		node.Status.Capacity.Cpu(),
+		humanReadableMemory(node.Status.Capacity.Memory()),
+	)
+}
+
+// specHash returns a short hash of the JSON representation of a spec
+func specHash(spec interface{}) string {
+	if spec == nil {
+		return unknown
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return unknown
+	}
+
+	var sum = sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// Entries lists the fingerprint as sorted name and value pairs
+func (fingerprint Fingerprint) Entries() [][]string {
+	var entries = [][]string{
+		{"collected at", fingerprint.CollectedAt.UTC().Format(time.RFC3339)},
+		{"kubernetes version", fingerprint.KubernetesVersion},
+		{"shipwright version", fingerprint.ShipwrightVersion},
+		{"tekton version", fingerprint.TektonVersion},
+		{"nodes", fmt.Sprintf("%d", fingerprint.NodeCount)},
+	}
+
+	var sorted = func(prefix string, values map[string]string) {
+		var keys = make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+		for _, key := range keys {
+			entries = append(entries, []string{prefix + " " + key, values[key]})
+		}
+	}
+
+	var nodeTypes = map[string]string{}
+	for nodeType, count := range fingerprint.NodeTypes {
+		nodeTypes[nodeType] = fmt.Sprintf("%d", count)
+	}
+
+	sorted("node type", nodeTypes)
+	sorted("tekton feature flag", fingerprint.TektonFeatureFlags)
+	sorted("build strategy", fingerprint.BuildStrategies)
+
+	return entries
+}
+
+// String renders the fingerprint as a table
+func (fingerprint Fingerprint) String() string {
+	var tableData = [][]string{}
+	for _, entry := range fingerprint.Entries() {
+		tableData = append(tableData, []string{bunt.Sprintf("*%s*", entry[0]), entry[1]})
+	}
+
+	table, err := neat.Table(tableData, neat.CustomSeparator(bunt.Sprintf(" DimGray{│} ")))
+	if err != nil {
+		panic(err)
+	}
+
+	return table
+}
@@ -0,0 +1,116 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	"bytes"
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+	buildfake "github.com/shipwright-io/build/pkg/client/clientset/versioned/fake"
+)
+
+var _ = Describe("cluster fingerprint", func() {
+	var kubeAccess KubeAccess
+
+	var node = func(name string, instanceType string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{corev1.LabelInstanceTypeStable: instanceType}},
+			Status: corev1.NodeStatus{
+				NodeInfo: corev1.NodeSystemInfo{Architecture: "amd64"},
+				Capacity: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("4"),
+					corev1.ResourceMemory: resource.MustParse("16Gi"),
+				},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		var client = fake.NewSimpleClientset(
+			node("node-1", "m5.xlarge"),
+			node("node-2", "m5.xlarge"),
+			node("node-3", "m5.2xlarge"),
+			&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "shipwright-build", Name: "shipwright-build-controller"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "controller", Image: "ghcr.io/shipwright-io/build/shipwright-build-controller:v0.12.0"}},
+				}}},
+			},
+			&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "tekton-pipelines", Name: "tekton-pipelines-controller", Labels: map[string]string{"app.kubernetes.io/version": "v0.56.0"}},
+			},
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "tekton-pipelines", Name: "feature-flags"},
+				Data:       map[string]string{"enable-api-fields": "beta"},
+			},
+		)
+
+		client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.29.1"}
+
+		kubeAccess = KubeAccess{
+			Context: context.Background(),
+			Client:  client,
+			BuildClient: buildfake.NewSimpleClientset(&shipwrightBuild.ClusterBuildStrategy{
+				ObjectMeta: metav1.ObjectMeta{Name: "kaniko"},
+				Spec: shipwrightBuild.BuildStrategySpec{
+					BuildSteps: []shipwrightBuild.BuildStep{{Container: corev1.Container{Name: "build", Image: "kaniko"}}},
+				},
+			}),
+		}
+	})
+
+	It("should collect versions, feature flags, nodes, and build strategy hashes", func() {
+		fingerprint := CollectFingerprint(kubeAccess, "test", BuildConfig{ClusterBuildStrategy: "kaniko"}, BuildConfig{ClusterBuildStrategy: "missing"})
+
+		Expect(fingerprint.KubernetesVersion).To(Equal("v1.29.1"))
+		Expect(fingerprint.ShipwrightVersion).To(Equal("ghcr.io/shipwright-io/build/shipwright-build-controller:v0.12.0"))
+		Expect(fingerprint.TektonVersion).To(Equal("v0.56.0"))
+		Expect(fingerprint.TektonFeatureFlags).To(Equal(map[string]string{"enable-api-fields": "beta"}))
+		Expect(fingerprint.NodeCount).To(Equal(3))
+		Expect(fingerprint.NodeTypes).To(Equal(map[string]int{
+			"m5.xlarge (amd64, 4 CPU, 16.0 GiB)":  2,
+			"m5.2xlarge (amd64, 4 CPU, 16.0 GiB)": 1,
+		}))
+
+		Expect(fingerprint.BuildStrategies).To(HaveLen(2))
+		Expect(fingerprint.BuildStrategies["ClusterBuildStrategy/kaniko"]).To(MatchRegexp(`^[0-9a-f]{12}$`))
+		Expect(fingerprint.BuildStrategies["ClusterBuildStrategy/missing"]).To(Equal("unknown"))
+	})
+
+	It("should embed the fingerprint into the HTML report", func() {
+		fingerprint := CollectFingerprint(kubeAccess, "test")
+
+		var buf bytes.Buffer
+		Expect(CreateBuildrunResultsChartJS([]Result{}, &buf, WithFingerprint(fingerprint))).To(Succeed())
+		Expect(buf.String()).To(ContainSubstring("System under test"))
+		Expect(buf.String()).To(ContainSubstring("<td>kubernetes version</td><td>v1.29.1</td>"))
+	})
+})
@@ -19,6 +19,7 @@ package load
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -50,7 +51,7 @@ func deleteContainerImage(kubeAccess KubeAccess, namespace string, secretRef *co
 	case strings.Contains(host, "docker.io"):
 		var token string
 		if secretRef != nil {
-			username, password, err := lookUpDockerCredentialsFromSecret(kubeAccess, namespace, secretRef)
+			username, password, err := lookUpDockerCredentialsFromSecret(kubeAccess, namespace, secretRef, imageURL)
 			if err != nil {
 				return err
 			}
@@ -68,7 +69,7 @@ func deleteContainerImage(kubeAccess KubeAccess, namespace string, secretRef *co
 			return fmt.Errorf("unable to delete image %s, because no secret reference with access credentials is configured", imageURL)
 		}
 
-		username, password, err := lookUpDockerCredentialsFromSecret(kubeAccess, namespace, secretRef)
+		username, password, err := lookUpDockerCredentialsFromSecret(kubeAccess, namespace, secretRef, imageURL)
 		if err != nil {
 			return err
 		}
@@ -163,7 +164,7 @@ func dockerV2Login(host string, username string, password string) (string, error
 		return fmt.Sprintf("JWT %s", loginToken.Token), nil
 
 	default:
-		return "", fmt.Errorf(string(respData))
+		return "", errors.New(string(respData))
 	}
 }
 
@@ -249,7 +250,7 @@ func getIBMCloudIdentityToken(apikey string) (*ibmCloudIdentityToken, error) {
 			)
 		}
 
-		return nil, wrap.Error(fmt.Errorf(string(body)), context)
+		return nil, wrap.Error(errors.New(string(body)), context)
 	}
 }
 
@@ -108,7 +108,7 @@ var _ = Describe("Kubernetes cluster based tests", func() {
 	BeforeEach(func() {
 		var err error
 
-		kubeAccess, err = NewKubeAccess()
+		kubeAccess, err = NewKubeAccess(ClientConfig{})
 		if err != nil {
 			Skip("Skipping Kubernetes cluster based tests, because cluster config could not be obtained: " + err.Error())
 		}
@@ -155,6 +155,10 @@ var _ = Describe("Kubernetes cluster based tests", func() {
 			withTemporaryClusterBuildStrategy(func(cbs shipwrightBuild.ClusterBuildStrategy) {
 				Expect(CheckSystemAndConfig(
 					*kubeAccess,
+					NamingConfig{
+						Namespace: "default",
+						Prefix:    "test",
+					},
 					BuildConfig{
 						ClusterBuildStrategy: cbs.Name,
 						SourceURL:            "https://github.com/shipwright-io/sample-go",
@@ -199,6 +203,35 @@ var _ = Describe("Kubernetes cluster based tests", func() {
 			})
 		})
 
+		It("should execute a standalone buildrun with an embedded build spec using temporary strategy and the Go sample", func() {
+			withTemporaryNamespace(func(namespace string) {
+				withTemporaryClusterBuildStrategy(func(cbs shipwrightBuild.ClusterBuildStrategy) {
+					result, err := ExecuteSingleBuildRun(
+						*kubeAccess,
+						namespace,
+						rand.String(8),
+						shipwrightBuild.BuildSpec{
+							Source: shipwrightBuild.Source{
+								URL: p("https://github.com/shipwright-io/sample-go"),
+							},
+							Strategy: shipwrightBuild.Strategy{
+								Kind: p(shipwrightBuild.ClusterBuildStrategyKind),
+								Name: cbs.Name,
+							},
+							Output: shipwrightBuild.Image{
+								Image: fmt.Sprintf("registry.registry.svc.cluster.local:32222/test/%s", rand.String(8)),
+							},
+						},
+						nil,
+						EmbedBuildSpec(true),
+					)
+
+					Expect(err).ToNot(HaveOccurred())
+					Expect(result).ToNot(BeNil())
+				})
+			})
+		})
+
 		It("should execute parallel buildruns using temporary strategy and the Go sample", func() {
 			withTemporaryNamespace(func(namespace string) {
 				withTemporaryClusterBuildStrategy(func(cbs shipwrightBuild.ClusterBuildStrategy) {
@@ -280,10 +313,53 @@ steps:
 						Expect(err).ToNot(HaveOccurred())
 						Expect(testplan).ToNot(BeNil())
 
-						Expect(ExecuteTestPlan(*kubeAccess, *testplan)).To(Succeed())
+						results, err := ExecuteTestPlan(*kubeAccess, *testplan)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(results).To(HaveLen(2))
 					})
 				})
 			})
 		})
+
+		It("should continue with the next step when the failure policy allows it", func() {
+			const testplanTemplate = `
+---
+namespace: %s
+steps:
+- name: failing
+  onFailure: continue
+  buildSpec:
+    source:
+      url: "https://github.com/shipwright-io/does-not-exist"
+    strategy:
+      kind: ClusterBuildStrategy
+      name: %s
+    output:
+      image: registry.registry.svc.cluster.local:32222/test
+
+- name: succeeding
+  buildSpec:
+    source:
+      url: "https://github.com/shipwright-io/sample-go"
+    strategy:
+      kind: ClusterBuildStrategy
+      name: %s
+    output:
+      image: registry.registry.svc.cluster.local:32222/test
+`
+
+			withTemporaryNamespace(func(namespace string) {
+				withTemporaryClusterBuildStrategy(func(strategy shipwrightBuild.ClusterBuildStrategy) {
+					testplan, err := NewTestPlan(strings.NewReader(fmt.Sprintf(testplanTemplate, namespace, strategy.Name, strategy.Name)))
+					Expect(err).ToNot(HaveOccurred())
+
+					results, err := ExecuteTestPlan(*kubeAccess, *testplan)
+					Expect(err).To(MatchError(ContainSubstring("failing")))
+					Expect(results).To(HaveLen(2))
+					Expect(results[0].Outcome).To(Equal(StepFailed))
+					Expect(results[1].Outcome).To(Equal(StepSucceeded))
+				})
+			})
+		})
 	})
 })
@@ -29,6 +29,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/utils/pointer"
 
@@ -82,35 +83,56 @@ func newBuildRun(name string, build shipwrightBuild.Build, serviceAccountName st
 				Name: build.Name,
 			},
 
-			ServiceAccount: func() *shipwrightBuild.ServiceAccount {
-				if serviceAccountName == "generated" {
-					return &shipwrightBuild.ServiceAccount{
-						Generate: pointer.Bool(true),
-					}
-				}
+			ServiceAccount: newServiceAccount(serviceAccountName),
+		},
+	}
+}
 
-				if serviceAccountName != "" {
-					return &shipwrightBuild.ServiceAccount{
-						Name: &serviceAccountName,
-					}
-				}
+// newEmbeddedBuildRun creates a standalone buildrun, the annotations that
+// would otherwise be set on the build are set on the buildrun instead
+func newEmbeddedBuildRun(namespace string, name string, buildSpec shipwrightBuild.BuildSpec, annotations map[string]string, serviceAccountName string) shipwrightBuild.BuildRun {
+	return shipwrightBuild.BuildRun{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "BuildRun",
+			APIVersion: "build.dev/v1alpha1",
+		},
 
-				return nil
-			}(),
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: annotations,
+			Name:        name,
+			Namespace:   namespace,
+		},
+
+		Spec: shipwrightBuild.BuildRunSpec{
+			BuildSpec:      &buildSpec,
+			ServiceAccount: newServiceAccount(serviceAccountName),
 		},
 	}
 }
 
+func newServiceAccount(serviceAccountName string) *shipwrightBuild.ServiceAccount {
+	if serviceAccountName == "generated" {
+		return &shipwrightBuild.ServiceAccount{
+			Generate: pointer.Bool(true),
+		}
+	}
+
+	if serviceAccountName != "" {
+		return &shipwrightBuild.ServiceAccount{
+			Name: &serviceAccountName,
+		}
+	}
+
+	return nil
+}
+
 func applyBuild(kubeAccess KubeAccess, build shipwrightBuild.Build) (*shipwrightBuild.Build, error) {
 	if err := deleteBuild(kubeAccess, build.Namespace, build.Name, defaultDeleteOptions); err != nil {
 		return nil, err
 	}
 
 	debug("Create build %s", build.Name)
-	return kubeAccess.BuildClient.
-		ShipwrightV1alpha1().
-		Builds(build.Namespace).
-		Create(kubeAccess.Context, &build, metav1.CreateOptions{})
+	return createBuild(kubeAccess, build)
 }
 
 func applyBuildRun(kubeAccess KubeAccess, buildRun shipwrightBuild.BuildRun) (*shipwrightBuild.BuildRun, error) {
@@ -119,44 +141,45 @@ func applyBuildRun(kubeAccess KubeAccess, buildRun shipwrightBuild.BuildRun) (*s
 	}
 
 	debug("Create buildrun %s", buildRun.Name)
-	return kubeAccess.BuildClient.
-		ShipwrightV1alpha1().
-		BuildRuns(buildRun.Namespace).
-		Create(kubeAccess.Context, &buildRun, metav1.CreateOptions{})
+	return createBuildRun(kubeAccess, buildRun)
 }
 
 func deleteBuild(kubeAccess KubeAccess, namespace string, name string, deleteOptions *metav1.DeleteOptions) error {
-	_, err := kubeAccess.BuildClient.ShipwrightV1alpha1().Builds(namespace).Get(kubeAccess.Context, name, metav1.GetOptions{})
+	_, err := getBuild(kubeAccess, namespace, name)
 	if errors.IsNotFound(err) {
 		return nil
 	}
 
 	debug("Delete build %s", name)
-	if err := kubeAccess.BuildClient.ShipwrightV1alpha1().Builds(namespace).Delete(kubeAccess.Context, name, *deleteOptions); err != nil {
+	if err := deleteBuildObject(kubeAccess, namespace, name, *deleteOptions); err != nil {
 		return fmt.Errorf("failed to delete build %s: %w", name, err)
 	}
 
-	return wait.PollImmediate(1*time.Second, 10*time.Second, func() (done bool, err error) {
-		_, err = kubeAccess.BuildClient.ShipwrightV1alpha1().Builds(namespace).Get(kubeAccess.Context, name, metav1.GetOptions{})
+	return wait.PollUntilContextTimeout(kubeAccess.Context, 1*time.Second, 10*time.Second, true, func(_ context.Context) (done bool, err error) {
+		_, err = getBuild(kubeAccess, namespace, name)
 		return errors.IsNotFound(err), nil
 	})
 }
 
 func deleteBuildRun(kubeAccess KubeAccess, namespace string, name string, deleteOptions *metav1.DeleteOptions) error {
-	buildRun, err := kubeAccess.BuildClient.ShipwrightV1alpha1().BuildRuns(namespace).Get(kubeAccess.Context, name, metav1.GetOptions{})
-	if errors.IsNotFound(err) {
-		return nil
+	buildRun, err := getBuildRun(kubeAccess, namespace, name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to look up buildrun %s: %w", name, err)
 	}
 
 	_, pod := lookUpTaskRunAndPod(kubeAccess, *buildRun)
 
 	debug("Delete buildrun %s", name)
-	if err := kubeAccess.BuildClient.ShipwrightV1alpha1().BuildRuns(namespace).Delete(kubeAccess.Context, name, *deleteOptions); err != nil {
+	if err := deleteBuildRunObject(kubeAccess, namespace, name, *deleteOptions); err != nil {
 		return fmt.Errorf("failed to delete buildrun %s: %w", name, err)
 	}
 
-	err = wait.PollImmediate(1*time.Second, 10*time.Second, func() (done bool, err error) {
-		_, err = kubeAccess.BuildClient.ShipwrightV1alpha1().BuildRuns(namespace).Get(kubeAccess.Context, name, metav1.GetOptions{})
+	err = wait.PollUntilContextTimeout(kubeAccess.Context, 1*time.Second, 10*time.Second, true, func(_ context.Context) (done bool, err error) {
+		_, err = getBuildRun(kubeAccess, namespace, name)
 		return errors.IsNotFound(err), nil
 	})
 
@@ -165,8 +188,8 @@ func deleteBuildRun(kubeAccess KubeAccess, namespace string, name string, delete
 	}
 
 	if pod != nil {
-		err = wait.PollImmediate(1*time.Second, 10*time.Second, func() (done bool, err error) {
-			_, err = kubeAccess.Client.CoreV1().Pods(namespace).Get(kubeAccess.Context, pod.Name, metav1.GetOptions{})
+		err = wait.PollUntilContextTimeout(kubeAccess.Context, 1*time.Second, 10*time.Second, true, func(ctx context.Context) (done bool, err error) {
+			_, err = kubeAccess.Client.CoreV1().Pods(namespace).Get(ctx, pod.Name, metav1.GetOptions{})
 			return errors.IsNotFound(err), nil
 		})
 	}
@@ -174,14 +197,38 @@ func deleteBuildRun(kubeAccess KubeAccess, namespace string, name string, delete
 	return err
 }
 
+func cancelBuildRun(kubeAccess KubeAccess, namespace string, name string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"state": shipwrightBuild.BuildRunStateCancel,
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	debug("Cancel buildrun %s", name)
+	if err := patchBuildRun(kubeAccess, namespace, name, types.MergePatchType, patch); err != nil {
+		return fmt.Errorf("failed to cancel buildrun %s: %w", name, err)
+	}
+
+	return nil
+}
+
 func lookUpTimeout(kubeAccess KubeAccess, buildRun *shipwrightBuild.BuildRun) time.Duration {
 	if buildRun.Spec.Timeout != nil {
 		debug("Using BuildRun specified timeout of %v", buildRun.Spec.Timeout.Duration)
 		return buildRun.Spec.Timeout.Duration
 	}
 
+	if buildRun.Spec.BuildSpec != nil && buildRun.Spec.BuildSpec.Timeout != nil {
+		debug("Using embedded build specification timeout of %v", buildRun.Spec.BuildSpec.Timeout.Duration)
+		return buildRun.Spec.BuildSpec.Timeout.Duration
+	}
+
 	if buildRun.Spec.BuildRef != nil {
-		build, err := kubeAccess.BuildClient.ShipwrightV1alpha1().Builds(buildRun.Namespace).Get(kubeAccess.Context, buildRun.Spec.BuildRef.Name, metav1.GetOptions{})
+		build, err := getBuild(kubeAccess, buildRun.Namespace, buildRun.Spec.BuildRef.Name)
 		if err == nil {
 			if build.Spec.Timeout != nil {
 				debug("Using Build specified timeout of %v", build.Spec.Timeout.Duration)
@@ -202,12 +249,16 @@ func waitForBuildRunCompletion(kubeAccess KubeAccess, buildRun *shipwrightBuild.
 		name      = buildRun.Name
 	)
 
-	var conditionFunc = func() (done bool, err error) {
-		buildRun, err = kubeAccess.BuildClient.ShipwrightV1alpha1().BuildRuns(namespace).Get(kubeAccess.Context, name, metav1.GetOptions{})
+	var conditionFunc = func(_ context.Context) (done bool, err error) {
+		// the last buildrun that could be looked up is kept in case of an
+		// error, the v1beta1 API returns no buildrun at all on errors
+		current, err := getBuildRun(kubeAccess, namespace, name)
 		if err != nil {
 			return false, err
 		}
 
+		buildRun = current
+
 		var condition = buildRun.Status.GetCondition(shipwrightBuild.Succeeded)
 		if condition == nil {
 			return false, nil
@@ -220,15 +271,27 @@ func waitForBuildRunCompletion(kubeAccess KubeAccess, buildRun *shipwrightBuild.
 			}
 
 		case corev1.ConditionFalse:
-			return false, fmt.Errorf(condition.Message)
+			return false, fmt.Errorf("%s", condition.Message)
 		}
 
 		return false, nil
 	}
 
 	debug("Polling every %v to wait for completion of buildrun %s within %v", interval, buildRun.Name, timeout)
-	if err := wait.PollImmediate(interval, timeout, conditionFunc); err != nil {
-		return buildRun, fmt.Errorf("%s\n\n%w", err.Error(), buildRunError(kubeAccess, *buildRun))
+	if err := wait.PollUntilContextTimeout(kubeAccess.Context, interval, timeout, true, conditionFunc); err != nil {
+		if kubeAccess.Interrupted() {
+			if err := cancelBuildRun(kubeAccess.forCleanup(), namespace, name); err != nil {
+				warn("%v\n", err)
+			}
+
+			return buildRun, fmt.Errorf("buildrun %s was interrupted: %w", name, kubeAccess.Context.Err())
+		}
+
+		if details := buildRunError(kubeAccess, *buildRun); details != nil {
+			return buildRun, fmt.Errorf("%s\n\n%w", err.Error(), details)
+		}
+
+		return buildRun, err
 	}
 
 	return buildRun, nil
@@ -239,7 +302,7 @@ func lookUpTaskRunAndPod(kubeAccess KubeAccess, buildRun shipwrightBuild.BuildRu
 		tmp, err := kubeAccess.TektonClient.
 			TektonV1beta1().
 			TaskRuns(buildRun.Namespace).
-			Get(context.TODO(), *buildRun.Status.LatestTaskRunRef, metav1.GetOptions{})
+			Get(kubeAccess.Context, *buildRun.Status.LatestTaskRunRef, metav1.GetOptions{})
 
 		if err == nil {
 			taskRun = tmp
@@ -277,34 +340,31 @@ func lookUpTaskRunAndPod(kubeAccess KubeAccess, buildRun shipwrightBuild.BuildRu
 	return taskRun, taskRunPod
 }
 
-func lookUpDockerCredentialsFromSecret(kubeAccess KubeAccess, namespace string, secretRef *corev1.LocalObjectReference) (string, string, error) {
+// lookUpDockerCredentialsFromSecret returns the credentials of the registry
+// of the image from the docker config of the secret
+func lookUpDockerCredentialsFromSecret(kubeAccess KubeAccess, namespace string, secretRef *corev1.LocalObjectReference, imageURL string) (string, string, error) {
 	secret, err := kubeAccess.Client.CoreV1().Secrets(namespace).Get(kubeAccess.Context, secretRef.Name, metav1.GetOptions{})
 	if err != nil {
 		return "", "", err
 	}
 
-	jsonData, ok := secret.Data[".dockerconfigjson"]
-	if !ok {
-		return "", "", fmt.Errorf("failed to find docker configuration in secret %s", secret.Name)
-	}
+	config, found, err := secretDockerConfig(secret)
+	switch {
+	case err != nil:
+		return "", "", fmt.Errorf("failed to parse docker config of secret %s: %w", secret.Name, err)
 
-	var dockerconfig struct {
-		Auths map[string]struct {
-			Username string `json:"username"`
-			Password string `json:"password"`
-			Auth     string `json:"auth"`
-		} `json:"auths"`
-	}
-
-	if err := json.Unmarshal(jsonData, &dockerconfig); err != nil {
-		return "", "", err
+	case !found:
+		return "", "", fmt.Errorf("failed to find docker configuration in secret %s", secret.Name)
 	}
 
-	for _, entry := range dockerconfig.Auths {
-		return entry.Username, entry.Password, nil
+	var host = registryHost(imageURL)
+	entry, found := config.lookUp(host)
+	if !found {
+		return "", "", fmt.Errorf("failed to find authentication credentials for registry %s in secret %s", host, secret.Name)
 	}
 
-	return "", "", fmt.Errorf("failed to find authentication credentials in secret data")
+	username, password := entry.credentials()
+	return username, password, nil
 }
 
 func buildRunError(kubeAccess KubeAccess, buildRun shipwrightBuild.BuildRun) error {
@@ -347,13 +407,8 @@ func buildRunError(kubeAccess KubeAccess, buildRun shipwrightBuild.BuildRun) err
 
 				reader, err := kubeAccess.Client.
 					CoreV1().
-					RESTClient().
-					Get().
-					Namespace(taskRunPod.Namespace).
-					Name(taskRunPod.Name).
-					Resource("pods").
-					SubResource("log").
-					Param("container", container.Name).
+					Pods(taskRunPod.Namespace).
+					GetLogs(taskRunPod.Name, &corev1.PodLogOptions{Container: container.Name}).
 					Stream(kubeAccess.Context)
 
 				if err == nil {
@@ -378,12 +433,21 @@ func buildRunError(kubeAccess KubeAccess, buildRun shipwrightBuild.BuildRun) err
 			bunt.Fprintf(&buf, "*Pod container logs*\n%s\n\n", logOutput)
 		}
 
-		return fmt.Errorf(buf.String())
+		if events := kubeAccess.Events.eventsOfBuildRun(buildRun); len(events) > 0 {
+			bunt.Fprintf(&buf, "*Events*\n")
+			for _, event := range events {
+				fmt.Fprintf(&buf, "%s\n", event)
+			}
+
+			fmt.Fprintf(&buf, "\n")
+		}
+
+		return fmt.Errorf("%s", buf.String())
 	}
 
 	// default error with not much more details other than the status reason
 	return wrap.Errorf(
-		fmt.Errorf(condition.Reason),
+		fmt.Errorf("%s", condition.Reason),
 		"buildRun %s failed",
 		buildRun.Name,
 	)
@@ -0,0 +1,399 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gonvenience/bunt"
+	"github.com/gonvenience/neat"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MetricsEndpoint is a controller deployment that exposes Prometheus
+// metrics on the given port of its pods
+type MetricsEndpoint struct {
+	Name       string
+	Deployment string
+	Port       int
+}
+
+// DefaultMetricsEndpoints are the metrics endpoints of the Shipwright and
+// Tekton controllers in a default installation
+var DefaultMetricsEndpoints = []MetricsEndpoint{
+	{Name: "Shipwright", Deployment: shipwrightControllerName, Port: 8383},
+	{Name: "Tekton", Deployment: tektonControllerName, Port: 9090},
+}
+
+// clientSideCounterparts maps controller histograms to the client-side
+// result values that measure roughly the same duration
+var clientSideCounterparts = map[string]string{
+	"build_buildrun_completion_duration_seconds":           BuildrunCompletionTime,
+	"build_buildrun_taskrun_rampup_duration_seconds":       BuildrunControlTime,
+	"build_buildrun_taskrun_pod_rampup_duration_seconds":   TaskrunControlTime,
+	"tekton_pipelines_controller_taskrun_duration_seconds": TaskrunCompletionTime,
+}
+
+// MetricsSnapshot contains the scraped metric families per controller
+type MetricsSnapshot map[string]map[string]*dto.MetricFamily
+
+// HistogramDelta is the change of a controller histogram during a run, the
+// buckets are cumulative like in Prometheus
+type HistogramDelta struct {
+	Controller string
+	Metric     string
+	Label      string
+	Count      uint64
+	Sum        time.Duration
+	Buckets    []Bucket
+}
+
+// Bucket is a cumulative histogram bucket with its upper bound
+type Bucket struct {
+	UpperBound time.Duration
+	Count      uint64
+}
+
+// ScrapeControllerMetrics scrapes the metrics of all pods of the controller
+// deployments through the pod proxy of the API server, controllers that
+// cannot be scraped are skipped with a warning
+func ScrapeControllerMetrics(kubeAccess KubeAccess, endpoints []MetricsEndpoint) MetricsSnapshot {
+	var snapshot = MetricsSnapshot{}
+
+	controllers, err := lookUpControllers(kubeAccess, endpoints)
+	if err != nil {
+		warn("unable to look up the controller deployments for scraping metrics: %v", err)
+		return snapshot
+	}
+
+	for _, endpoint := range endpoints {
+		for _, controller := range controllers[endpoint.Name] {
+			pods, err := kubeAccess.Client.CoreV1().Pods(controller.namespace).List(kubeAccess.Context, metav1.ListOptions{LabelSelector: controller.selector})
+			if err != nil {
+				warn("unable to scrape metrics of %s: %v", endpoint.Name, err)
+				continue
+			}
+
+			var families = map[string]*dto.MetricFamily{}
+			for _, pod := range pods.Items {
+				if pod.Status.Phase != corev1.PodRunning {
+					continue
+				}
+
+				data, err := kubeAccess.Client.CoreV1().Pods(pod.Namespace).ProxyGet("http", pod.Name, strconv.Itoa(endpoint.Port), "metrics", nil).DoRaw(kubeAccess.Context)
+				if err != nil {
+					warn("unable to scrape metrics of %s pod %s: %v", endpoint.Name, pod.Name, err)
+					continue
+				}
+
+				podFamilies, err := ParseMetrics(data)
+				if err != nil {
+					warn("unable to parse metrics of %s pod %s: %v", endpoint.Name, pod.Name, err)
+					continue
+				}
+
+				// Only the leader reconciles, but all replicas expose
+				// metrics, therefore the series of all pods are combined
+				// using the pod name to keep them apart
+				for name, family := range podFamilies {
+					for _, metric := range family.Metric {
+						var podLabel, podName = "pod", pod.Name
+						metric.Label = append(metric.Label, &dto.LabelPair{Name: &podLabel, Value: &podName})
+					}
+
+					if existing, ok := families[name]; ok {
+						existing.Metric = append(existing.Metric, family.Metric...)
+					} else {
+						families[name] = family
+					}
+				}
+			}
+
+			snapshot[endpoint.Name] = families
+		}
+	}
+
+	return snapshot
+}
+
+// controllerPods selects the pods of a controller deployment
+type controllerPods struct {
+	namespace string
+	selector  string
+}
+
+// lookUpControllers finds the deployments of the endpoints in all
+// namespaces, and returns the pod selectors per endpoint name
+func lookUpControllers(kubeAccess KubeAccess, endpoints []MetricsEndpoint) (map[string][]controllerPods, error) {
+	deployments, err := kubeAccess.Client.AppsV1().Deployments("").List(kubeAccess.Context, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var result = map[string][]controllerPods{}
+	for _, endpoint := range endpoints {
+		for _, deployment := range deployments.Items {
+			if deployment.Name != endpoint.Deployment {
+				continue
+			}
+
+			selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse pod selector of deployment %s: %w", deployment.Name, err)
+			}
+
+			result[endpoint.Name] = append(result[endpoint.Name], controllerPods{namespace: deployment.Namespace, selector: selector.String()})
+		}
+	}
+
+	return result, nil
+}
+
+// ParseMetrics parses metrics in the Prometheus text format
+func ParseMetrics(data []byte) (map[string]*dto.MetricFamily, error) {
+	var parser = expfmt.NewTextParser(model.UTF8Validation)
+	return parser.TextToMetricFamilies(bytes.NewReader(data))
+}
+
+// HistogramDeltas returns the change of all duration histograms between
+// the two snapshots, histograms without new observations are omitted
+func HistogramDeltas(before MetricsSnapshot, after MetricsSnapshot) []HistogramDelta {
+	var result = []HistogramDelta{}
+	for controller, families := range after {
+		for name, family := range families {
+			var unit, ok = durationUnit(name)
+			if !ok || family.GetType() != dto.MetricType_HISTOGRAM {
+				continue
+			}
+
+			var previous = map[string]*dto.Histogram{}
+			if beforeFamily, ok := before[controller][name]; ok {
+				for _, metric := range beforeFamily.Metric {
+					previous[labelSignature(metric)] = metric.GetHistogram()
+				}
+			}
+
+			var deltas = map[string]*HistogramDelta{}
+			for _, metric := range family.Metric {
+				var current = metric.GetHistogram()
+				var prior = previous[labelSignature(metric)]
+
+				// A counter reset, like a controller restart, means that
+				// the current values are all new observations
+				if prior != nil && prior.GetSampleCount() > current.GetSampleCount() {
+					prior = nil
+				}
+
+				var label = controllerLabel(metric)
+				delta, ok := deltas[label]
+				if !ok {
+					delta = &HistogramDelta{Controller: controller, Metric: name, Label: label}
+					deltas[label] = delta
+				}
+
+				delta.Count += current.GetSampleCount() - prior.GetSampleCount()
+				delta.Sum += seconds((current.GetSampleSum() - prior.GetSampleSum()) * unit)
+
+				for i, bucket := range current.GetBucket() {
+					var count = bucket.GetCumulativeCount()
+					if prior != nil && i < len(prior.GetBucket()) {
+						count -= prior.GetBucket()[i].GetCumulativeCount()
+					}
+
+					if i < len(delta.Buckets) {
+						delta.Buckets[i].Count += count
+					} else {
+						delta.Buckets = append(delta.Buckets, Bucket{UpperBound: seconds(bucket.GetUpperBound() * unit), Count: count})
+					}
+				}
+			}
+
+			for _, delta := range deltas {
+				if delta.Count > 0 {
+					result = append(result, *delta)
+				}
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Controller != result[j].Controller {
+			return result[i].Controller < result[j].Controller
+		}
+
+		if result[i].Metric != result[j].Metric {
+			return result[i].Metric < result[j].Metric
+		}
+
+		return result[i].Label < result[j].Label
+	})
+
+	return result
+}
+
+// durationUnit returns the factor to convert the values of the histogram
+// to seconds, Knative based controllers like Tekton report latencies in
+// milliseconds without a unit suffix
+func durationUnit(name string) (float64, bool) {
+	switch {
+	case strings.HasSuffix(name, "_seconds"):
+		return 1, true
+
+	case strings.HasSuffix(name, "_milliseconds"), strings.HasSuffix(name, "_ms"), strings.HasSuffix(name, "_latency"):
+		return 0.001, true
+
+	default:
+		return 0, false
+	}
+}
+
+func seconds(value float64) time.Duration {
+	if math.IsInf(value, 0) {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(value * float64(time.Second))
+}
+
+func labelSignature(metric *dto.Metric) string {
+	var labels = []string{}
+	for _, pair := range metric.GetLabel() {
+		labels = append(labels, pair.GetName()+"="+pair.GetValue())
+	}
+
+	sort.Strings(labels)
+	return strings.Join(labels, ",")
+}
+
+// controllerLabel returns the controller or reconciler label of the series,
+// which separates the reconcile metrics of the different controllers
+func controllerLabel(metric *dto.Metric) string {
+	for _, pair := range metric.GetLabel() {
+		switch pair.GetName() {
+		case "controller", "reconciler":
+			return pair.GetValue()
+		}
+	}
+
+	return ""
+}
+
+// Mean returns the average duration of the observations
+func (delta HistogramDelta) Mean() time.Duration {
+	if delta.Count == 0 {
+		return 0
+	}
+
+	return delta.Sum / time.Duration(delta.Count)
+}
+
+// Quantile estimates the quantile of the observations by linear
+// interpolation within the bucket, like Prometheus histogram_quantile does
+func (delta HistogramDelta) Quantile(q float64) time.Duration {
+	if delta.Count == 0 || len(delta.Buckets) == 0 {
+		return 0
+	}
+
+	var rank = q * float64(delta.Count)
+	var lowerBound time.Duration
+	var lowerCount uint64
+	for _, bucket := range delta.Buckets {
+		if float64(bucket.Count) >= rank {
+			if bucket.UpperBound == time.Duration(math.MaxInt64) {
+				return lowerBound
+			}
+
+			var fraction = (rank - float64(lowerCount)) / float64(bucket.Count-lowerCount)
+			return lowerBound + time.Duration(fraction*float64(bucket.UpperBound-lowerBound))
+		}
+
+		lowerBound, lowerCount = bucket.UpperBound, bucket.Count
+	}
+
+	return lowerBound
+}
+
+func (delta HistogramDelta) name() string {
+	if delta.Label != "" {
+		return fmt.Sprintf("%s{%s}", delta.Metric, delta.Label)
+	}
+
+	return delta.Metric
+}
+
+// ControllerMetricsTable lists the histogram deltas of the controllers,
+// together with the mean of the client-side results that measure roughly
+// the same duration, the difference is spent outside of the controllers
+func ControllerMetricsTable(deltas []HistogramDelta, results []Result) [][]string {
+	var tableData = [][]string{{"Controller", "Metric", "Count", "Mean", "p50", "p95", "Client-side mean"}}
+
+	var clientSide = map[string]string{}
+	if completed := completedResults(results); len(completed) > 0 {
+		for _, value := range mean(completed) {
+			clientSide[value.Description] = value.Value.String()
+		}
+	}
+
+	for _, delta := range deltas {
+		var counterpart = ""
+		if description, ok := clientSideCounterparts[delta.Metric]; ok {
+			counterpart = clientSide[description]
+		}
+
+		tableData = append(tableData, []string{
+			delta.Controller,
+			delta.name(),
+			strconv.FormatUint(delta.Count, 10),
+			delta.Mean().Round(time.Millisecond).String(),
+			delta.Quantile(0.5).Round(time.Millisecond).String(),
+			delta.Quantile(0.95).Round(time.Millisecond).String(),
+			counterpart,
+		})
+	}
+
+	return tableData
+}
+
+// ControllerMetricsReport renders the histogram deltas of the controllers
+// next to the client-side results
+func ControllerMetricsReport(deltas []HistogramDelta, results []Result) string {
+	if len(deltas) == 0 {
+		return "No controller metrics with observations during the run.\n"
+	}
+
+	var tableData = ControllerMetricsTable(deltas, results)
+	for i := range tableData[0] {
+		tableData[0][i] = bunt.Sprintf("*%s*", tableData[0][i])
+	}
+
+	table, err := neat.Table(tableData, neat.AlignRight(2, 3, 4, 5, 6), neat.CustomSeparator(bunt.Sprintf(" DimGray{│} ")))
+	if err != nil {
+		panic(err)
+	}
+
+	return bunt.Sprintf("Controller metrics during the run:\n%s\n", table)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+)
+
+var _ = Describe("controller metrics", func() {
+	var snapshot = func(controller string, text string) MetricsSnapshot {
+		families, err := ParseMetrics([]byte(text))
+		Expect(err).ToNot(HaveOccurred())
+		return MetricsSnapshot{controller: families}
+	}
+
+	var before = snapshot("Shipwright", `# TYPE build_buildrun_completion_duration_seconds histogram
+build_buildrun_completion_duration_seconds_bucket{buildstrategy="kaniko",le="10"} 1
+build_buildrun_completion_duration_seconds_bucket{buildstrategy="kaniko",le="20"} 2
+build_buildrun_completion_duration_seconds_bucket{buildstrategy="kaniko",le="+Inf"} 2
+build_buildrun_completion_duration_seconds_sum{buildstrategy="kaniko"} 20
+build_buildrun_completion_duration_seconds_count{buildstrategy="kaniko"} 2
+# TYPE controller_runtime_reconcile_time_seconds histogram
+controller_runtime_reconcile_time_seconds_bucket{controller="buildrun",le="0.1"} 5
+controller_runtime_reconcile_time_seconds_bucket{controller="buildrun",le="+Inf"} 5
+controller_runtime_reconcile_time_seconds_sum{controller="buildrun"} 0.25
+controller_runtime_reconcile_time_seconds_count{controller="buildrun"} 5
+# TYPE build_buildruns_completed_total counter
+build_buildruns_completed_total 2
+`)
+
+	var after = snapshot("Shipwright", `# TYPE build_buildrun_completion_duration_seconds histogram
+build_buildrun_completion_duration_seconds_bucket{buildstrategy="kaniko",le="10"} 1
+build_buildrun_completion_duration_seconds_bucket{buildstrategy="kaniko",le="20"} 6
+build_buildrun_completion_duration_seconds_bucket{buildstrategy="kaniko",le="+Inf"} 6
+build_buildrun_completion_duration_seconds_sum{buildstrategy="kaniko"} 80
+build_buildrun_completion_duration_seconds_count{buildstrategy="kaniko"} 6
+# TYPE controller_runtime_reconcile_time_seconds histogram
+controller_runtime_reconcile_time_seconds_bucket{controller="buildrun",le="0.1"} 5
+controller_runtime_reconcile_time_seconds_bucket{controller="buildrun",le="+Inf"} 5
+controller_runtime_reconcile_time_seconds_sum{controller="buildrun"} 0.25
+controller_runtime_reconcile_time_seconds_count{controller="buildrun"} 5
+controller_runtime_reconcile_time_seconds_bucket{controller="build",le="0.1"} 2
+controller_runtime_reconcile_time_seconds_bucket{controller="build",le="+Inf"} 2
+controller_runtime_reconcile_time_seconds_sum{controller="build"} 0.1
+controller_runtime_reconcile_time_seconds_count{controller="build"} 2
+# TYPE build_buildruns_completed_total counter
+build_buildruns_completed_total 6
+`)
+
+	It("should compute the changes of duration histograms with new observations", func() {
+		deltas := HistogramDeltas(before, after)
+		Expect(deltas).To(HaveLen(2))
+
+		Expect(deltas[0].Metric).To(Equal("build_buildrun_completion_duration_seconds"))
+		Expect(deltas[0].Count).To(BeEquivalentTo(4))
+		Expect(deltas[0].Mean()).To(Equal(15 * time.Second))
+		Expect(deltas[0].Quantile(0.5)).To(Equal(15 * time.Second))
+
+		Expect(deltas[1].Metric).To(Equal("controller_runtime_reconcile_time_seconds"))
+		Expect(deltas[1].Label).To(Equal("build"))
+		Expect(deltas[1].Count).To(BeEquivalentTo(2))
+		Expect(deltas[1].Mean()).To(Equal(50 * time.Millisecond))
+	})
+
+	It("should treat all observations as new after a counter reset", func() {
+		deltas := HistogramDeltas(after, before)
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Metric).To(Equal("build_buildrun_completion_duration_seconds"))
+		Expect(deltas[0].Count).To(BeEquivalentTo(2))
+		Expect(deltas[0].Mean()).To(Equal(10 * time.Second))
+	})
+
+	It("should convert latencies in milliseconds into durations", func() {
+		deltas := HistogramDeltas(MetricsSnapshot{}, snapshot("Tekton", `# TYPE tekton_pipelines_controller_reconcile_latency histogram
+tekton_pipelines_controller_reconcile_latency_bucket{reconciler="taskrun",le="100"} 3
+tekton_pipelines_controller_reconcile_latency_bucket{reconciler="taskrun",le="+Inf"} 4
+tekton_pipelines_controller_reconcile_latency_sum{reconciler="taskrun"} 400
+tekton_pipelines_controller_reconcile_latency_count{reconciler="taskrun"} 4
+`))
+
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Label).To(Equal("taskrun"))
+		Expect(deltas[0].Mean()).To(Equal(100 * time.Millisecond))
+	})
+
+	It("should show the client-side mean next to the matching controller histogram", func() {
+		var results = []Result{
+			{Value{BuildrunCompletionTime, 20 * time.Second}},
+			{Value{BuildrunCompletionTime, 30 * time.Second}},
+		}
+
+		table := ControllerMetricsTable(HistogramDeltas(before, after), results)
+		Expect(table).To(HaveLen(3))
+		Expect(table[1]).To(Equal([]string{"Shipwright", "build_buildrun_completion_duration_seconds", "4", "15s", "15s", "19.5s", "25s"}))
+		Expect(table[2]).To(Equal([]string{"Shipwright", "controller_runtime_reconcile_time_seconds{build}", "2", "50ms", "50ms", "95ms", ""}))
+	})
+})
@@ -19,8 +19,11 @@ package load
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,6 +35,7 @@ import (
 	"k8s.io/utils/pointer"
 
 	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+	shipwrightBuildBeta "github.com/shipwright-io/build/pkg/apis/build/v1beta1"
 
 	buildclient "github.com/shipwright-io/build/pkg/client/clientset/versioned"
 	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
@@ -40,6 +44,8 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+var onFailureRetry = regexp.MustCompile(`^retry\((\d+)\)$`)
+
 // Naming constants for the results
 const (
 	BuildrunCompletionTime = "BuildRun completion time"
@@ -53,33 +59,62 @@ const (
 
 // KubeAccess contains Kubernetes cluster access objects in a single place
 type KubeAccess struct {
-	Context      context.Context
-	RestConfig   *rest.Config
-	Client       kubernetes.Interface
-	BuildClient  buildclient.Interface
-	TektonClient tektonclient.Interface
+	Context              context.Context
+	CleanupContext       context.Context
+	RestConfig           *rest.Config
+	Client               kubernetes.Interface
+	BuildClient          buildclient.Interface
+	TektonClient         tektonclient.Interface
+	ShipwrightAPIVersion string
+	APIMetrics           *APIMetrics
+	Events               *EventRecorder
+	Artifacts            *ArtifactCollector
+}
+
+// ClientConfig contains all fields required to configure the Kubernetes
+// cluster access
+type ClientConfig struct {
+	KubeConfig        string
+	Context           string
+	InCluster         bool
+	Impersonate       string
+	ImpersonateGroups []string
+	QPS               float32
+	Burst             int
+
+	ShipwrightAPIVersion string
 }
 
 // NamingConfig contains all fields required for proper naming of buildRuns
 type NamingConfig struct {
 	Namespace string
 	Prefix    string
+
+	// Namespaces to spread the buildruns across (round-robin), in case it is
+	// empty, all buildruns are created in the namespace defined in Namespace
+	Namespaces []string
+
+	// NamespaceCount defines the number of namespaces to be created for the
+	// test, which are used instead of a list of namespaces
+	NamespaceCount int
 }
 
 // BuildConfig contains all fields required to setup a buildRun
 type BuildConfig struct {
-	ClusterBuildStrategy       string
-	SourceURL                  string
-	SourceRevision             string
-	SourceContextDir           string
-	SourceSecretRef            string
-	SourceDockerfile           string
-	ServiceAccountName         string
-	OutputImageURL             string
-	OutputSecretRef            string
-	Timeout                    time.Duration
-	SkipDelete                 bool
-	SkipVerifySourceRepository bool
+	ClusterBuildStrategy       string        `yaml:"clusterBuildStrategy"`
+	BuildStrategy              string        `yaml:"buildStrategy"`
+	SourceURL                  string        `yaml:"sourceURL"`
+	SourceRevision             string        `yaml:"sourceRevision"`
+	SourceContextDir           string        `yaml:"sourceContextDir"`
+	SourceSecretRef            string        `yaml:"sourceSecretRef"`
+	SourceDockerfile           string        `yaml:"sourceDockerfile"`
+	ServiceAccountName         string        `yaml:"serviceAccountName"`
+	OutputImageURL             string        `yaml:"outputImageURL"`
+	OutputSecretRef            string        `yaml:"outputSecretRef"`
+	Timeout                    time.Duration `yaml:"timeout"`
+	SkipDelete                 bool          `yaml:"skipDelete"`
+	SkipVerifySourceRepository bool          `yaml:"skipVerifySourceRepository"`
+	EmbedBuildSpec             bool          `yaml:"embedBuildSpec"`
 }
 
 // ResultSet is an aggregated result set based on multiple
@@ -104,17 +139,81 @@ type Value struct {
 // Result contains the raw time results
 type Result []Value
 
+// BuildResults contains the results of all buildruns that were
+// created for the same build, the buildrun numbers are in the same order as
+// the results, since buildruns that did not complete have no result
+type BuildResults struct {
+	BuildName       string
+	BuildRunNumbers []int
+	Results         []Result
+}
+
 // TestPlan is a plan with steps that define tests
 type TestPlan struct {
-	Namespace          string `yaml:"namespace" json:"namespace"`
-	ServiceAccountName string `yaml:"serviceAccountName" json:"serviceAccountName"`
-	Steps              []struct {
-		Name             string                    `yaml:"name" json:"name"`
-		BuildAnnotations map[string]string         `yaml:"buildAnnotations" json:"buildAnnotations"`
-		BuildSpec        shipwrightBuild.BuildSpec `yaml:"buildSpec" json:"buildSpec"`
-	} `yaml:"steps" json:"steps"`
+	APIVersion         string               `yaml:"apiVersion" json:"apiVersion"`
+	Namespace          string               `yaml:"namespace" json:"namespace"`
+	ServiceAccountName string               `yaml:"serviceAccountName" json:"serviceAccountName"`
+	Defaults           TestPlanStepSettings `yaml:"defaults" json:"defaults"`
+	Steps              []TestPlanStep       `yaml:"steps" json:"steps"`
+}
+
+// TestPlanStepSettings are settings that apply to all steps when they are
+// defined in the test plan defaults, and that can be overridden per step
+type TestPlanStepSettings struct {
+	ServiceAccountName string            `yaml:"serviceAccountName,omitempty" json:"serviceAccountName,omitempty"`
+	Timeout            *metav1.Duration  `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	SkipDelete         *bool             `yaml:"skipDelete,omitempty" json:"skipDelete,omitempty"`
+	BuildAnnotations   map[string]string `yaml:"buildAnnotations,omitempty" json:"buildAnnotations,omitempty"`
+	OnFailure          string            `yaml:"onFailure,omitempty" json:"onFailure,omitempty"`
 }
 
+// TestPlanStep is a single step of a test plan, each repetition of a step
+// runs the configured number of parallel buildruns, warm-up repetitions
+// run before and their results are discarded
+type TestPlanStep struct {
+	TestPlanStepSettings `yaml:",inline" json:",inline"`
+
+	Name           string                    `yaml:"name" json:"name"`
+	Parallel       int                       `yaml:"parallel" json:"parallel"`
+	Repeat         int                       `yaml:"repeat" json:"repeat"`
+	Warmup         int                       `yaml:"warmup" json:"warmup"`
+	ConcurrentWith string                    `yaml:"concurrentWith" json:"concurrentWith"`
+	BuildSpec      shipwrightBuild.BuildSpec `yaml:"buildSpec" json:"buildSpec"`
+}
+
+// Policies for the handling of failed test plan steps, retry is used with
+// the number of retries, for example retry(3)
+const (
+	OnFailureAbort    = "abort"
+	OnFailureContinue = "continue"
+	OnFailureRetry    = "retry"
+)
+
+// Outcomes of a test plan step
+const (
+	StepSucceeded   = "succeeded"
+	StepFailed      = "failed"
+	StepSkipped     = "skipped"
+	StepInterrupted = "interrupted"
+)
+
+// TestPlanStepResult contains the outcome of a test plan step and the
+// aggregated results of all of its measured buildruns
+type TestPlanStepResult struct {
+	Name      string
+	Outcome   string
+	Retries   int
+	Error     error
+	ResultSet ResultSet
+}
+
+// Supported API versions of the build specs in a test plan, in case no
+// version is specified, v1alpha1 is used
+const (
+	TestPlanAPIVersionV1Alpha1 = "shipwright.io/v1alpha1"
+	TestPlanAPIVersionV1Beta1  = "shipwright.io/v1beta1"
+)
+
 func (brr Result) String() string {
 	var tmp = []string{}
 	for _, value := range brr {
@@ -139,7 +238,12 @@ func (brr Result) ValueOf(description string) time.Duration {
 }
 
 // NewTestPlan creates a test plan based on the provided input
-func NewTestPlan(in io.Reader) (*TestPlan, error) {
+func NewTestPlan(in io.Reader, options ...TestPlanOption) (*TestPlan, error) {
+	var testPlanOptions = testPlanOptions{baseDir: "."}
+	for _, option := range options {
+		option(&testPlanOptions)
+	}
+
 	data, err := io.ReadAll(in)
 	if err != nil {
 		return nil, err
@@ -156,6 +260,52 @@ func NewTestPlan(in io.Reader) (*TestPlan, error) {
 		return nil, err
 	}
 
+	// Line numbers are only known for the content of the test plan file
+	// itself, not for included or generated steps
+	var lines = documentLines(data)
+
+	// Included step fragments and variables are resolved first, so that the
+	// matrix can make use of them, too
+	restructured, err := resolveTestPlanIncludes(tmp, testPlanOptions.baseDir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if restructured {
+		for path := range lines {
+			if strings.HasPrefix(path, ".steps[") {
+				delete(lines, path)
+			}
+		}
+	}
+
+	if err := renderTestPlanVariables(tmp, testPlanOptions.variables); err != nil {
+		return nil, err
+	}
+
+	// Steps generated by the matrix are added to the list of steps, before
+	// any of the steps is processed further
+	if err := expandTestPlanMatrix(tmp); err != nil {
+		var issues ValidationErrors
+		if errors.As(err, &issues) {
+			return nil, withLines(issues, lines)
+		}
+
+		return nil, err
+	}
+
+	// The JSON package ignores unknown fields, so that typos would go
+	// unnoticed without an explicit check
+	if issues := checkTestPlanFields(tmp); len(issues) > 0 {
+		return nil, withLines(issues, lines)
+	}
+
+	// Internally, build specs are handled in their v1alpha1 form, so that
+	// v1beta1 build specs need to be converted first
+	if err := convertTestPlanBuildSpecs(tmp); err != nil {
+		return nil, err
+	}
+
 	jsonBytes, err := json.Marshal(tmp)
 	if err != nil {
 		return nil, err
@@ -163,14 +313,206 @@ func NewTestPlan(in io.Reader) (*TestPlan, error) {
 
 	var testplan TestPlan
 	if err := json.Unmarshal(jsonBytes, &testplan); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, withLines(ValidationErrors{{
+				Path:    jsonFieldIndex.ReplaceAllString("."+typeErr.Field, "[$1]"),
+				Message: fmt.Sprintf("cannot use %s value as %s", typeErr.Value, typeErr.Type),
+			}}, lines)
+		}
+
 		return nil, err
 	}
 
+	if issues := testplan.validate(); len(issues) > 0 {
+		return nil, withLines(issues, lines)
+	}
+
 	return &testplan, nil
 }
 
+// stepGroups returns the indices of the test plan steps grouped by the
+// steps that run concurrently, a step can only run concurrently with a
+// step that is defined before it
+func (testplan TestPlan) stepGroups() ([][]int, error) {
+	var groups = [][]int{}
+	var groupOf = map[string]int{}
+
+	for i, step := range testplan.Steps {
+		switch {
+		case len(step.ConcurrentWith) == 0:
+			groupOf[step.Name] = len(groups)
+			groups = append(groups, []int{i})
+
+		default:
+			group, ok := groupOf[step.ConcurrentWith]
+			if !ok {
+				return nil, fmt.Errorf("test plan step %s is configured to run concurrently with step %s, which is not defined before it", step.Name, step.ConcurrentWith)
+			}
+
+			groupOf[step.Name] = group
+			groups[group] = append(groups[group], i)
+		}
+	}
+
+	return groups, nil
+}
+
+// parallel returns the number of parallel buildruns per repetition of the step
+func (step TestPlanStep) parallel() int {
+	if step.Parallel > 0 {
+		return step.Parallel
+	}
+
+	return 1
+}
+
+// repeat returns the number of measured repetitions of the step
+func (step TestPlanStep) repeat() int {
+	if step.Repeat > 0 {
+		return step.Repeat
+	}
+
+	return 1
+}
+
+// settingsOf returns the effective settings of a step, where the settings of
+// the step take precedence over the test plan defaults
+func (testplan TestPlan) settingsOf(step TestPlanStep) TestPlanStepSettings {
+	var settings = TestPlanStepSettings{
+		ServiceAccountName: testplan.ServiceAccountName,
+		BuildAnnotations:   map[string]string{},
+	}
+
+	for _, source := range []TestPlanStepSettings{testplan.Defaults, step.TestPlanStepSettings} {
+		if len(source.ServiceAccountName) > 0 {
+			settings.ServiceAccountName = source.ServiceAccountName
+		}
+
+		if source.Timeout != nil {
+			settings.Timeout = source.Timeout
+		}
+
+		if source.SkipDelete != nil {
+			settings.SkipDelete = source.SkipDelete
+		}
+
+		if len(source.OnFailure) > 0 {
+			settings.OnFailure = source.OnFailure
+		}
+
+		for key, value := range source.BuildAnnotations {
+			settings.BuildAnnotations[key] = value
+		}
+	}
+
+	return settings
+}
+
+// onFailure returns the failure policy and the number of retries, a step
+// that still fails after its retries aborts the test plan
+func (settings TestPlanStepSettings) onFailure() (string, int, error) {
+	switch settings.OnFailure {
+	case "", OnFailureAbort:
+		return OnFailureAbort, 0, nil
+
+	case OnFailureContinue:
+		return OnFailureContinue, 0, nil
+	}
+
+	if matches := onFailureRetry.FindStringSubmatch(settings.OnFailure); matches != nil {
+		retries, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return "", 0, err
+		}
+
+		return OnFailureRetry, retries, nil
+	}
+
+	return "", 0, fmt.Errorf("unsupported failure policy %s, use one of %s, %s, or %s(n)", settings.OnFailure, OnFailureAbort, OnFailureContinue, OnFailureRetry)
+}
+
+func (settings TestPlanStepSettings) skipDelete() bool {
+	return settings.SkipDelete != nil && *settings.SkipDelete
+}
+
+// strategy returns the name and kind of the configured build strategy, a
+// namespaced build strategy takes precedence over a cluster build strategy
+func (buildCfg BuildConfig) strategy() (string, shipwrightBuild.BuildStrategyKind) {
+	if len(buildCfg.BuildStrategy) > 0 {
+		return buildCfg.BuildStrategy, shipwrightBuild.NamespacedBuildStrategyKind
+	}
+
+	return buildCfg.ClusterBuildStrategy, shipwrightBuild.ClusterBuildStrategyKind
+}
+
+func convertTestPlanBuildSpecs(testplan interface{}) error {
+	plan, ok := testplan.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	switch apiVersion := plan["apiVersion"]; apiVersion {
+	case nil, "", TestPlanAPIVersionV1Alpha1:
+		return nil
+
+	case TestPlanAPIVersionV1Beta1:
+		steps, _ := plan["steps"].([]interface{})
+		for _, step := range steps {
+			step, ok := step.(map[string]interface{})
+			if !ok || step["buildSpec"] == nil {
+				continue
+			}
+
+			buildSpec, err := convertBuildSpecToV1Alpha1(step["buildSpec"])
+			if err != nil {
+				return fmt.Errorf("failed to convert build spec of step %v: %w", step["name"], err)
+			}
+
+			step["buildSpec"] = buildSpec
+		}
+
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported test plan API version %v, use one of %s, or %s", apiVersion, TestPlanAPIVersionV1Alpha1, TestPlanAPIVersionV1Beta1)
+	}
+}
+
+func convertBuildSpecToV1Alpha1(input interface{}) (interface{}, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var betaBuildSpec shipwrightBuildBeta.BuildSpec
+	if err := json.Unmarshal(data, &betaBuildSpec); err != nil {
+		return nil, err
+	}
+
+	var alphaBuildSpec shipwrightBuild.BuildSpec
+	if err := betaBuildSpec.ConvertTo(&alphaBuildSpec); err != nil {
+		return nil, err
+	}
+
+	data, err = json.Marshal(alphaBuildSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+	return result, json.Unmarshal(data, &result)
+}
+
 func createNamespaceAndName(namingCfg NamingConfig, buildCfg BuildConfig, idx int) (string, string) {
-	return namingCfg.Namespace, fmt.Sprintf("%s-%s-%d", namingCfg.Prefix, buildCfg.ClusterBuildStrategy, idx)
+	strategyName, _ := buildCfg.strategy()
+
+	var namespace = namingCfg.Namespace
+	if len(namingCfg.Namespaces) > 0 {
+		namespace = namingCfg.Namespaces[idx%len(namingCfg.Namespaces)]
+	}
+
+	return namespace, fmt.Sprintf("%s-%s-%d", namingCfg.Prefix, strategyName, idx)
 }
 
 func createBuildAnnotations(buildCfg BuildConfig) map[string]string {
@@ -184,9 +526,11 @@ func createBuildAnnotations(buildCfg BuildConfig) map[string]string {
 }
 
 func createBuildSpec(name string, buildCfg BuildConfig) (*shipwrightBuild.BuildSpec, error) {
+	var strategyName, strategyKind = buildCfg.strategy()
+
 	var (
 		dockerfile = func() *string {
-			if strings.Contains(buildCfg.ClusterBuildStrategy, "kaniko") || strings.Contains(buildCfg.ClusterBuildStrategy, "buildkit") || strings.Contains(buildCfg.ClusterBuildStrategy, "dockerfile") {
+			if strings.Contains(strategyName, "kaniko") || strings.Contains(strategyName, "buildkit") || strings.Contains(strategyName, "dockerfile") {
 				return &buildCfg.SourceDockerfile
 			}
 
@@ -215,8 +559,8 @@ func createBuildSpec(name string, buildCfg BuildConfig) (*shipwrightBuild.BuildS
 
 	return &shipwrightBuild.BuildSpec{
 		Strategy: shipwrightBuild.Strategy{
-			Name: buildCfg.ClusterBuildStrategy,
-			Kind: strategyRefKind(shipwrightBuild.ClusterBuildStrategyKind),
+			Name: strategyName,
+			Kind: strategyRefKind(strategyKind),
 		},
 
 		Source: shipwrightBuild.Source{
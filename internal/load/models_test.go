@@ -0,0 +1,169 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+	buildfake "github.com/shipwright-io/build/pkg/client/clientset/versioned/fake"
+	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+)
+
+var _ = Describe("test plans", func() {
+	Context("using v1alpha1 build specs", func() {
+		It("should load a test plan without an API version", func() {
+			testplan, err := NewTestPlan(strings.NewReader(`---
+namespace: test-namespace
+steps:
+- name: kaniko
+  buildSpec:
+    source:
+      url: https://github.com/shipwright-io/sample-go
+      contextDir: docker-build
+    strategy:
+      name: kaniko
+      kind: ClusterBuildStrategy
+    output:
+      image: registry.example.com/org
+      credentials:
+        name: reg-cred
+`))
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(testplan.Steps).To(HaveLen(1))
+			Expect(*testplan.Steps[0].BuildSpec.Source.URL).To(Equal("https://github.com/shipwright-io/sample-go"))
+			Expect(testplan.Steps[0].BuildSpec.Output.Credentials.Name).To(Equal("reg-cred"))
+		})
+	})
+
+	Context("using v1beta1 build specs", func() {
+		It("should convert the build specs of the steps", func() {
+			testplan, err := NewTestPlan(strings.NewReader(`---
+apiVersion: shipwright.io/v1beta1
+namespace: test-namespace
+steps:
+- name: kaniko
+  buildSpec:
+    source:
+      type: Git
+      git:
+        url: https://github.com/shipwright-io/sample-go
+      contextDir: docker-build
+    strategy:
+      name: kaniko
+      kind: ClusterBuildStrategy
+    output:
+      image: registry.example.com/org
+      pushSecret: reg-cred
+`))
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(testplan.Steps).To(HaveLen(1))
+
+			buildSpec := testplan.Steps[0].BuildSpec
+			Expect(*buildSpec.Source.URL).To(Equal("https://github.com/shipwright-io/sample-go"))
+			Expect(*buildSpec.Source.ContextDir).To(Equal("docker-build"))
+			Expect(*buildSpec.Strategy.Kind).To(Equal(shipwrightBuild.ClusterBuildStrategyKind))
+			Expect(buildSpec.Output.Image).To(Equal("registry.example.com/org"))
+			Expect(buildSpec.Output.Credentials.Name).To(Equal("reg-cred"))
+		})
+	})
+
+	Context("using parallel, repeated, and concurrent steps", func() {
+		const testplanTemplate = `---
+namespace: test-namespace
+steps:
+- name: kaniko
+  parallel: 3
+  repeat: 5
+  warmup: 1
+  buildSpec:
+    source:
+      url: https://github.com/shipwright-io/sample-go
+    strategy:
+      name: kaniko
+    output:
+      image: registry.example.com/org
+- name: buildpacks
+  concurrentWith: %s
+  buildSpec:
+    source:
+      url: https://github.com/shipwright-io/sample-go
+    strategy:
+      name: buildpacks-v3
+    output:
+      image: registry.example.com/org
+`
+
+		It("should load the step settings", func() {
+			testplan, err := NewTestPlan(strings.NewReader(fmt.Sprintf(testplanTemplate, "kaniko")))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(testplan.Steps).To(HaveLen(2))
+			Expect(testplan.Steps[0].Parallel).To(Equal(3))
+			Expect(testplan.Steps[0].Repeat).To(Equal(5))
+			Expect(testplan.Steps[0].Warmup).To(Equal(1))
+			Expect(testplan.Steps[1].ConcurrentWith).To(Equal("kaniko"))
+		})
+
+		It("should fail to load a step that runs concurrently with an unknown step", func() {
+			_, err := NewTestPlan(strings.NewReader(fmt.Sprintf(testplanTemplate, "unknown")))
+			Expect(err).To(MatchError(ContainSubstring("line 16: steps[1].concurrentWith: step unknown is not defined before this step")))
+		})
+
+		It("should fail to execute a step that runs concurrently with an unknown step", func() {
+			testplan, err := NewTestPlan(strings.NewReader(fmt.Sprintf(testplanTemplate, "kaniko")))
+			Expect(err).ToNot(HaveOccurred())
+
+			var client, buildClient = fake.NewSimpleClientset(), buildfake.NewSimpleClientset()
+			var kubeAccess = KubeAccess{
+				Context:      context.Background(),
+				Client:       client,
+				BuildClient:  buildClient,
+				TektonClient: tektonfake.NewSimpleClientset(),
+			}
+
+			testplan.Steps[1].ConcurrentWith = "unknown"
+			_, err = ExecuteTestPlan(kubeAccess, *testplan)
+			Expect(err).To(MatchError(ContainSubstring("step unknown is not defined before this step")))
+
+			// the test plan is rejected before any of its steps is started
+			Expect(client.Actions()).To(BeEmpty())
+			Expect(buildClient.Actions()).To(BeEmpty())
+		})
+	})
+
+	Context("using an unknown API version", func() {
+		It("should fail to load the test plan", func() {
+			_, err := NewTestPlan(strings.NewReader(`---
+apiVersion: shipwright.io/v2
+steps: []
+`))
+
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,303 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+)
+
+const managedByLabel = "app.kubernetes.io/managed-by"
+
+// provisioned keeps track of the namespaces and objects that were created
+// when preparing the namespaces, so that they can be removed again
+type provisioned struct {
+	namespaces      []string
+	secrets         []namespacedName
+	serviceAccounts []namespacedName
+	buildStrategies []namespacedName
+}
+
+type namespacedName struct{ namespace, name string }
+
+// PrepareNamespaces sets up the namespaces to spread the buildruns across.
+// In case a namespace count is configured, the namespaces are created. All
+// namespaces of the list are provisioned with the secrets, service account,
+// and namespaced build strategy of the build configurations, which are
+// copied from the namespace defined in Namespace. The returned naming config
+// contains the list of namespaces, the returned function removes everything
+// that was created, unless skip delete is configured.
+func PrepareNamespaces(kubeAccess KubeAccess, namingCfg NamingConfig, buildCfgs ...BuildConfig) (NamingConfig, func(), error) {
+	var created provisioned
+
+	var skipDelete bool
+	for _, buildCfg := range buildCfgs {
+		skipDelete = skipDelete || buildCfg.SkipDelete
+	}
+
+	var cleanup = func() {
+		if skipDelete {
+			return
+		}
+
+		created.remove(kubeAccess.forCleanup())
+	}
+
+	if namingCfg.NamespaceCount > 0 {
+		if len(namingCfg.Namespaces) > 0 {
+			return namingCfg, cleanup, fmt.Errorf("a list of namespaces and a namespace count cannot be used at the same time")
+		}
+
+		for i := 0; i < namingCfg.NamespaceCount; i++ {
+			namespace, err := kubeAccess.Client.CoreV1().Namespaces().Create(kubeAccess.Context, &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   fmt.Sprintf("%s-ns-%d", namingCfg.Prefix, i),
+					Labels: map[string]string{managedByLabel: "build-load"},
+				},
+			}, metav1.CreateOptions{})
+
+			if err != nil {
+				cleanup()
+				return namingCfg, cleanup, fmt.Errorf("failed to create namespace: %w", err)
+			}
+
+			debug("Created namespace %s", namespace.Name)
+			created.namespaces = append(created.namespaces, namespace.Name)
+		}
+
+		namingCfg.Namespaces = created.namespaces
+	}
+
+	for _, namespace := range namingCfg.Namespaces {
+		if namespace == namingCfg.Namespace {
+			continue
+		}
+
+		for _, buildCfg := range buildCfgs {
+			if err := created.provision(kubeAccess, namingCfg.Namespace, namespace, buildCfg); err != nil {
+				cleanup()
+				return namingCfg, cleanup, fmt.Errorf("failed to provision namespace %s: %w", namespace, err)
+			}
+		}
+	}
+
+	return namingCfg, cleanup, nil
+}
+
+func (created *provisioned) provision(kubeAccess KubeAccess, source string, target string, buildCfg BuildConfig) error {
+	for _, secretName := range []string{buildCfg.OutputSecretRef, buildCfg.SourceSecretRef} {
+		if err := created.copySecret(kubeAccess, source, target, secretName); err != nil {
+			return err
+		}
+	}
+
+	if buildCfg.ServiceAccountName != "" && buildCfg.ServiceAccountName != "generated" {
+		if err := created.copyServiceAccount(kubeAccess, source, target, buildCfg.ServiceAccountName); err != nil {
+			return err
+		}
+	}
+
+	if buildCfg.BuildStrategy != "" {
+		if err := created.copyBuildStrategy(kubeAccess, source, target, buildCfg.BuildStrategy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exists checks whether an object is already available in the target
+// namespace, in which case it is not copied and remains untouched
+func exists(err error) (bool, error) {
+	switch {
+	case err == nil:
+		return true, nil
+
+	case errors.IsNotFound(err):
+		return false, nil
+
+	default:
+		return false, err
+	}
+}
+
+func (created *provisioned) copySecret(kubeAccess KubeAccess, source string, target string, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	_, err := kubeAccess.Client.CoreV1().Secrets(target).Get(kubeAccess.Context, name, metav1.GetOptions{})
+	if found, err := exists(err); found || err != nil {
+		return err
+	}
+
+	secret, err := kubeAccess.Client.CoreV1().Secrets(source).Get(kubeAccess.Context, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to look up secret %s in namespace %s: %w", name, source, err)
+	}
+
+	if _, err = kubeAccess.Client.CoreV1().Secrets(target).Create(kubeAccess.Context, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: target,
+			Name:      name,
+			Labels:    map[string]string{managedByLabel: "build-load"},
+		},
+		Type: secret.Type,
+		Data: secret.Data,
+	}, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+
+	debug("Copied secret %s to namespace %s", name, target)
+	created.secrets = append(created.secrets, namespacedName{target, name})
+	return nil
+}
+
+func (created *provisioned) copyServiceAccount(kubeAccess KubeAccess, source string, target string, name string) error {
+	_, err := kubeAccess.Client.CoreV1().ServiceAccounts(target).Get(kubeAccess.Context, name, metav1.GetOptions{})
+	if found, err := exists(err); found || err != nil {
+		return err
+	}
+
+	serviceAccount, err := kubeAccess.Client.CoreV1().ServiceAccounts(source).Get(kubeAccess.Context, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to look up service account %s in namespace %s: %w", name, source, err)
+	}
+
+	// the secrets referenced by the service account are required, too,
+	// references to secrets that do not exist are not copied
+	var secrets = []corev1.ObjectReference{}
+	for _, secret := range serviceAccount.Secrets {
+		if err := created.copySecret(kubeAccess, source, target, secret.Name); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+
+			return err
+		}
+
+		secrets = append(secrets, corev1.ObjectReference{Name: secret.Name})
+	}
+
+	var imagePullSecrets = []corev1.LocalObjectReference{}
+	for _, secret := range serviceAccount.ImagePullSecrets {
+		if err := created.copySecret(kubeAccess, source, target, secret.Name); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+
+			return err
+		}
+
+		imagePullSecrets = append(imagePullSecrets, corev1.LocalObjectReference{Name: secret.Name})
+	}
+
+	if _, err = kubeAccess.Client.CoreV1().ServiceAccounts(target).Create(kubeAccess.Context, &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: target,
+			Name:      name,
+			Labels:    map[string]string{managedByLabel: "build-load"},
+		},
+		Secrets:          secrets,
+		ImagePullSecrets: imagePullSecrets,
+	}, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+
+	debug("Copied service account %s to namespace %s", name, target)
+	created.serviceAccounts = append(created.serviceAccounts, namespacedName{target, name})
+	return nil
+}
+
+func (created *provisioned) copyBuildStrategy(kubeAccess KubeAccess, source string, target string, name string) error {
+	_, err := getBuildStrategy(kubeAccess, target, name)
+	if found, err := exists(err); found || err != nil {
+		return err
+	}
+
+	buildStrategy, err := getBuildStrategy(kubeAccess, source, name)
+	if err != nil {
+		return fmt.Errorf("failed to look up build strategy %s in namespace %s: %w", name, source, err)
+	}
+
+	if _, err = createBuildStrategy(kubeAccess, shipwrightBuild.BuildStrategy{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: target,
+			Name:      name,
+			Labels:    map[string]string{managedByLabel: "build-load"},
+		},
+		Spec: buildStrategy.Spec,
+	}); err != nil {
+		return err
+	}
+
+	debug("Copied build strategy %s to namespace %s", name, target)
+	created.buildStrategies = append(created.buildStrategies, namespacedName{target, name})
+	return nil
+}
+
+// remove deletes the created objects, created namespaces are deleted as a
+// whole, which includes all objects in these namespaces
+func (created *provisioned) remove(kubeAccess KubeAccess) {
+	var isCreatedNamespace = func(namespace string) bool {
+		for _, name := range created.namespaces {
+			if name == namespace {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, obj := range created.buildStrategies {
+		if !isCreatedNamespace(obj.namespace) {
+			if err := deleteBuildStrategyObject(kubeAccess, obj.namespace, obj.name, *defaultDeleteOptions); err != nil {
+				warn("failed to delete build strategy %s in namespace %s: %v", obj.name, obj.namespace, err)
+			}
+		}
+	}
+
+	for _, obj := range created.serviceAccounts {
+		if !isCreatedNamespace(obj.namespace) {
+			if err := kubeAccess.Client.CoreV1().ServiceAccounts(obj.namespace).Delete(kubeAccess.Context, obj.name, *defaultDeleteOptions); err != nil {
+				warn("failed to delete service account %s in namespace %s: %v", obj.name, obj.namespace, err)
+			}
+		}
+	}
+
+	for _, obj := range created.secrets {
+		if !isCreatedNamespace(obj.namespace) {
+			if err := kubeAccess.Client.CoreV1().Secrets(obj.namespace).Delete(kubeAccess.Context, obj.name, *defaultDeleteOptions); err != nil {
+				warn("failed to delete secret %s in namespace %s: %v", obj.name, obj.namespace, err)
+			}
+		}
+	}
+
+	for _, namespace := range created.namespaces {
+		debug("Delete namespace %s", namespace)
+		if err := kubeAccess.Client.CoreV1().Namespaces().Delete(kubeAccess.Context, namespace, *defaultDeleteOptions); err != nil {
+			warn("failed to delete namespace %s: %v", namespace, err)
+		}
+	}
+
+	*created = provisioned{}
+}
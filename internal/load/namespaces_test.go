@@ -0,0 +1,119 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("spreading buildruns across namespaces", func() {
+	var kubeAccess KubeAccess
+
+	var buildCfg = BuildConfig{
+		ServiceAccountName: "pipeline",
+		OutputSecretRef:    "registry-credentials",
+	}
+
+	var namespaceNames = func() []string {
+		list, err := kubeAccess.Client.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		var names = []string{}
+		for _, namespace := range list.Items {
+			names = append(names, namespace.Name)
+		}
+
+		return names
+	}
+
+	var secretExists = func(namespace string, name string) bool {
+		_, err := kubeAccess.Client.CoreV1().Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{})
+		return err == nil
+	}
+
+	BeforeEach(func() {
+		kubeAccess = KubeAccess{
+			Context:        context.Background(),
+			CleanupContext: context.Background(),
+			Client: fake.NewSimpleClientset(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "registry-credentials"},
+					Type:       corev1.SecretTypeDockerConfigJson,
+					Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("{}")},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "git-credentials"},
+				},
+				&corev1.ServiceAccount{
+					ObjectMeta:       metav1.ObjectMeta{Namespace: "default", Name: "pipeline"},
+					Secrets:          []corev1.ObjectReference{{Name: "git-credentials"}, {Name: "removed-token"}},
+					ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry-credentials"}, {Name: "removed-pull-secret"}},
+				},
+			),
+		}
+	})
+
+	It("should create, provision, and delete the configured number of namespaces", func() {
+		namingCfg, cleanup, err := PrepareNamespaces(kubeAccess, NamingConfig{Namespace: "default", Prefix: "test", NamespaceCount: 2}, buildCfg)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(namingCfg.Namespaces).To(Equal([]string{"test-ns-0", "test-ns-1"}))
+		Expect(namespaceNames()).To(ConsistOf("default", "team-a", "test-ns-0", "test-ns-1"))
+
+		for _, namespace := range namingCfg.Namespaces {
+			Expect(secretExists(namespace, "registry-credentials")).To(BeTrue())
+			Expect(secretExists(namespace, "git-credentials")).To(BeTrue())
+
+			serviceAccount, err := kubeAccess.Client.CoreV1().ServiceAccounts(namespace).Get(context.Background(), "pipeline", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serviceAccount.Secrets).To(Equal([]corev1.ObjectReference{{Name: "git-credentials"}}))
+			Expect(serviceAccount.ImagePullSecrets).To(Equal([]corev1.LocalObjectReference{{Name: "registry-credentials"}}))
+		}
+
+		cleanup()
+		Expect(namespaceNames()).To(ConsistOf("default", "team-a"))
+	})
+
+	It("should provision existing namespaces and only remove what was copied", func() {
+		namingCfg, cleanup, err := PrepareNamespaces(kubeAccess, NamingConfig{Namespace: "default", Prefix: "test", Namespaces: []string{"default", "team-a"}}, buildCfg)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(namingCfg.Namespaces).To(Equal([]string{"default", "team-a"}))
+		Expect(secretExists("team-a", "registry-credentials")).To(BeTrue())
+
+		cleanup()
+		Expect(namespaceNames()).To(ConsistOf("default", "team-a"))
+		Expect(secretExists("team-a", "registry-credentials")).To(BeFalse())
+		Expect(secretExists("default", "registry-credentials")).To(BeTrue())
+	})
+
+	It("should fail when a secret to be copied does not exist", func() {
+		_, _, err := PrepareNamespaces(kubeAccess, NamingConfig{Namespace: "default", Prefix: "test", NamespaceCount: 1}, BuildConfig{OutputSecretRef: "missing"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("failed to look up secret missing in namespace default"))
+		Expect(namespaceNames()).To(ConsistOf("default", "team-a"))
+	})
+})
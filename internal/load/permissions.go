@@ -0,0 +1,199 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gonvenience/bunt"
+	"github.com/gonvenience/neat"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Permission is a set of verbs on a resource that build-load uses, and what
+// does not work in case the verbs are not allowed
+type Permission struct {
+	Group         string
+	Resource      string
+	Subresource   string
+	Verbs         []string
+	ClusterScoped bool
+	Required      bool
+	WithoutIt     string
+}
+
+// PermissionCheck is the result of the access review of a permission, it
+// lists the verbs that are denied in at least one of the namespaces
+type PermissionCheck struct {
+	Permission
+	Denied []string
+}
+
+// Allowed returns whether all verbs of the permission are allowed
+func (check PermissionCheck) Allowed() bool {
+	return len(check.Denied) == 0
+}
+
+// Permissions lists everything build-load needs to run buildruns
+var Permissions = []Permission{
+	{Group: "shipwright.io", Resource: "builds", Verbs: []string{"get", "create", "delete"}, Required: true, WithoutIt: "builds cannot be created"},
+	{Group: "shipwright.io", Resource: "buildruns", Verbs: []string{"get", "create", "patch", "delete"}, Required: true, WithoutIt: "buildruns cannot be created and canceled"},
+	{Group: "shipwright.io", Resource: "buildruns", Verbs: []string{"list"}, WithoutIt: "existing buildruns are not reported"},
+	{Group: "shipwright.io", Resource: "buildstrategies", Verbs: []string{"get", "list"}, WithoutIt: "namespaced build strategies are not verified and their resources are not estimated"},
+	{Group: "shipwright.io", Resource: "clusterbuildstrategies", Verbs: []string{"get", "list"}, ClusterScoped: true, WithoutIt: "cluster build strategies are not verified and their resources are not estimated"},
+	{Group: "tekton.dev", Resource: "taskruns", Verbs: []string{"get"}, WithoutIt: "failed buildruns are reported without taskrun details"},
+	{Resource: "pods", Verbs: []string{"get"}, WithoutIt: "failed buildruns are reported without pod details"},
+	{Resource: "pods", Verbs: []string{"list"}, ClusterScoped: true, WithoutIt: "the capacity check ignores running pods"},
+	{Resource: "pods", Subresource: "log", Verbs: []string{"get"}, WithoutIt: "failed buildruns are reported without container logs"},
+	{Resource: "secrets", Verbs: []string{"get"}, WithoutIt: "registry and source credentials are not verified"},
+	{Resource: "secrets", Verbs: []string{"create", "delete"}, WithoutIt: "credentials cannot be provisioned or copied into other namespaces"},
+	{Resource: "serviceaccounts", Verbs: []string{"get"}, WithoutIt: "the configured service account is not verified"},
+	{Resource: "serviceaccounts", Verbs: []string{"create", "delete"}, WithoutIt: "service accounts cannot be provisioned or copied into other namespaces"},
+	{Resource: "limitranges", Verbs: []string{"list"}, WithoutIt: "limit ranges are not checked against the buildrun pods"},
+	{Resource: "resourcequotas", Verbs: []string{"list"}, WithoutIt: "resource quotas are not checked against the concurrent buildruns"},
+	{Resource: "nodes", Verbs: []string{"list"}, ClusterScoped: true, WithoutIt: "the cluster capacity check is skipped"},
+	{Group: "apps", Resource: "deployments", Verbs: []string{"list"}, ClusterScoped: true, WithoutIt: "the cluster fingerprint lacks the Shipwright and Tekton versions"},
+	{Resource: "pods", Subresource: "proxy", Verbs: []string{"get"}, ClusterScoped: true, WithoutIt: "controller metrics cannot be scraped with --controller-metrics"},
+	{Group: "metrics.k8s.io", Resource: "pods", Verbs: []string{"list"}, ClusterScoped: true, WithoutIt: "controller resource usage cannot be sampled with --usage-interval"},
+	{Group: "metrics.k8s.io", Resource: "nodes", Verbs: []string{"list"}, ClusterScoped: true, WithoutIt: "node resource usage cannot be sampled with --usage-interval"},
+	{Resource: "events", Verbs: []string{"list", "watch"}, WithoutIt: "events of the buildruns are not recorded"},
+	{Resource: "namespaces", Verbs: []string{"create", "delete"}, ClusterScoped: true, WithoutIt: "namespaces cannot be created with --namespace-count"},
+}
+
+// ReviewPermissions checks all permissions using self subject access reviews
+// in the given namespaces, cluster scoped permissions are checked once
+func ReviewPermissions(kubeAccess KubeAccess, namespaces []string) ([]PermissionCheck, error) {
+	var result = make([]PermissionCheck, 0, len(Permissions))
+	for _, permission := range Permissions {
+		var scopes = namespaces
+		if permission.ClusterScoped {
+			scopes = []string{""}
+		}
+
+		var check = PermissionCheck{Permission: permission}
+		for _, verb := range permission.Verbs {
+			for _, namespace := range scopes {
+				review, err := kubeAccess.Client.AuthorizationV1().SelfSubjectAccessReviews().Create(kubeAccess.Context, &authorizationv1.SelfSubjectAccessReview{
+					Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+						ResourceAttributes: &authorizationv1.ResourceAttributes{
+							Namespace:   namespace,
+							Verb:        verb,
+							Group:       permission.Group,
+							Resource:    permission.Resource,
+							Subresource: permission.Subresource,
+						},
+					},
+				}, metav1.CreateOptions{})
+
+				if err != nil {
+					return nil, fmt.Errorf("failed to review permission to %s %s: %w", verb, permission.name(), err)
+				}
+
+				if !review.Status.Allowed {
+					check.Denied = append(check.Denied, verb)
+					break
+				}
+			}
+		}
+
+		result = append(result, check)
+	}
+
+	return result, nil
+}
+
+func (permission Permission) name() string {
+	var name = permission.Resource
+	if permission.Subresource != "" {
+		name = name + "/" + permission.Subresource
+	}
+
+	if permission.Group != "" {
+		name = name + "." + permission.Group
+	}
+
+	return name
+}
+
+// checkPermissions prints which permissions are allowed and what does not
+// work without them, and fails in case a required permission is denied
+func checkPermissions(kubeAccess KubeAccess, namingCfg NamingConfig) error {
+	var namespaces = namingCfg.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{namingCfg.Namespace}
+	}
+
+	checks, err := ReviewPermissions(kubeAccess, namespaces)
+	if err != nil {
+		warn("unable to check permissions: %v", err)
+		return nil
+	}
+
+	var tableData = [][]string{
+		{
+			bunt.Sprintf("*Resource*"),
+			bunt.Sprintf("*Verbs*"),
+			bunt.Sprintf("*Allowed*"),
+			bunt.Sprintf("*Without it*"),
+		},
+	}
+
+	var missing = []string{}
+	for _, check := range checks {
+		var allowed = bunt.Sprintf("LimeGreen{yes}")
+		var withoutIt = bunt.Sprintf("DimGray{%s}", check.WithoutIt)
+		switch {
+		case check.Allowed():
+
+		case check.Required:
+			allowed = bunt.Sprintf("Red{no (%s)}", strings.Join(check.Denied, ", "))
+			withoutIt = bunt.Sprintf("Red{%s}", check.WithoutIt)
+			missing = append(missing, fmt.Sprintf("%s %s", strings.Join(check.Denied, ", "), check.name()))
+
+		default:
+			allowed = bunt.Sprintf("DarkOrange{no (%s)}", strings.Join(check.Denied, ", "))
+			withoutIt = check.WithoutIt
+		}
+
+		tableData = append(tableData, []string{
+			check.name(),
+			strings.Join(check.Verbs, ", "),
+			allowed,
+			withoutIt,
+		})
+	}
+
+	table, err := neat.Table(tableData, neat.CustomSeparator(bunt.Sprintf(" DimGray{│} ")))
+	if err != nil {
+		return err
+	}
+
+	var scope = "namespace"
+	if len(namespaces) > 1 {
+		scope = "namespaces"
+	}
+
+	bunt.Printf("Permissions in %s *%s*:\n%s\n\n", scope, strings.Join(namespaces, ", "), table)
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing permissions required to run buildruns: %s", strings.Join(missing, "; "))
+	}
+
+	return nil
+}
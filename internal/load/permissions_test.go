@@ -0,0 +1,154 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("permission preflight", func() {
+	var kubeAccess KubeAccess
+	var reviewed []authorizationv1.ResourceAttributes
+
+	// allowExcept creates a client that allows everything, except for the given
+	// verb and resource in the given namespace
+	var allowExcept = func(namespace string, verb string, resource string) {
+		var client = fake.NewSimpleClientset()
+		client.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+
+			var attributes = *review.Spec.ResourceAttributes
+			reviewed = append(reviewed, attributes)
+
+			review.Status.Allowed = !(attributes.Namespace == namespace && attributes.Verb == verb && attributes.Resource == resource)
+			return true, review, nil
+		})
+
+		kubeAccess = KubeAccess{Context: context.Background(), Client: client}
+	}
+
+	var checkOf = func(checks []PermissionCheck, resource string, verb string) PermissionCheck {
+		for _, check := range checks {
+			if check.Resource == resource && check.Subresource == "" {
+				for _, candidate := range check.Verbs {
+					if candidate == verb {
+						return check
+					}
+				}
+			}
+		}
+
+		Fail("no permission check for " + verb + " " + resource)
+		return PermissionCheck{}
+	}
+
+	BeforeEach(func() {
+		reviewed = nil
+	})
+
+	It("should allow everything in case all reviews are allowed", func() {
+		allowExcept("", "", "")
+
+		checks, err := ReviewPermissions(kubeAccess, []string{"test"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(checks).To(HaveLen(len(Permissions)))
+		for _, check := range checks {
+			Expect(check.Allowed()).To(BeTrue())
+		}
+	})
+
+	It("should review namespaced permissions in every namespace and cluster scoped ones once", func() {
+		allowExcept("", "", "")
+
+		_, err := ReviewPermissions(kubeAccess, []string{"ns-a", "ns-b"})
+		Expect(err).ToNot(HaveOccurred())
+
+		var namespaces = map[string]int{}
+		for _, attributes := range reviewed {
+			if attributes.Group == "" && attributes.Resource == "nodes" {
+				namespaces[attributes.Namespace]++
+			}
+
+			if attributes.Resource == "builds" && attributes.Verb == "create" {
+				namespaces[attributes.Namespace]++
+			}
+		}
+
+		Expect(namespaces).To(Equal(map[string]int{"": 1, "ns-a": 1, "ns-b": 1}))
+	})
+
+	It("should report denied verbs in any of the namespaces", func() {
+		allowExcept("ns-b", "create", "buildruns")
+
+		checks, err := ReviewPermissions(kubeAccess, []string{"ns-a", "ns-b"})
+		Expect(err).ToNot(HaveOccurred())
+
+		var check = checkOf(checks, "buildruns", "create")
+		Expect(check.Allowed()).To(BeFalse())
+		Expect(check.Required).To(BeTrue())
+		Expect(check.Denied).To(Equal([]string{"create"}))
+
+		Expect(checkOf(checks, "buildruns", "list").Allowed()).To(BeTrue())
+	})
+
+	It("should review listing pods cluster-wide for the capacity check", func() {
+		allowExcept("", "list", "pods")
+
+		checks, err := ReviewPermissions(kubeAccess, []string{"test"})
+		Expect(err).ToNot(HaveOccurred())
+
+		var check = checkOf(checks, "pods", "list")
+		Expect(check.ClusterScoped).To(BeTrue())
+		Expect(check.Allowed()).To(BeFalse())
+		Expect(check.WithoutIt).To(Equal("the capacity check ignores running pods"))
+
+		Expect(checkOf(checks, "pods", "get").Allowed()).To(BeTrue())
+	})
+
+	It("should review the permissions of the namespace policy checks", func() {
+		allowExcept("test", "list", "resourcequotas")
+
+		checks, err := ReviewPermissions(kubeAccess, []string{"test"})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(checkOf(checks, "limitranges", "list").Allowed()).To(BeTrue())
+		Expect(checkOf(checks, "resourcequotas", "list").Allowed()).To(BeFalse())
+		Expect(checkOf(checks, "resourcequotas", "list").Required).To(BeFalse())
+	})
+
+	It("should mark permissions without which features degrade as optional", func() {
+		allowExcept("", "list", "nodes")
+
+		checks, err := ReviewPermissions(kubeAccess, []string{"test"})
+		Expect(err).ToNot(HaveOccurred())
+
+		var check = checkOf(checks, "nodes", "list")
+		Expect(check.Allowed()).To(BeFalse())
+		Expect(check.Required).To(BeFalse())
+		Expect(check.WithoutIt).To(ContainSubstring("capacity check"))
+	})
+})
@@ -0,0 +1,409 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gonvenience/bunt"
+	"github.com/gonvenience/neat"
+	"github.com/gonvenience/text"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrQuotaExceeded is returned by the preflight checks, in case the resource
+// quotas of a namespace do not allow the requested concurrent buildruns
+var ErrQuotaExceeded = fmt.Errorf("resource quota exceeded")
+
+// Object count quota resources of the objects created for a buildrun
+const (
+	quotaCountBuilds          corev1.ResourceName = "count/builds.shipwright.io"
+	quotaCountBuildRuns       corev1.ResourceName = "count/buildruns.shipwright.io"
+	quotaCountTaskRuns        corev1.ResourceName = "count/taskruns.tekton.dev"
+	quotaCountPods            corev1.ResourceName = "count/pods"
+	quotaCountServiceAccounts corev1.ResourceName = "count/serviceaccounts"
+)
+
+// quotaLimits maps the quota resources that require limits to the limited
+// pod resource
+var quotaLimits = map[corev1.ResourceName]corev1.ResourceName{
+	corev1.ResourceLimitsCPU:    corev1.ResourceCPU,
+	corev1.ResourceLimitsMemory: corev1.ResourceMemory,
+}
+
+// newPodDemand creates the demand of concurrent buildruns of the given build
+// configuration and build strategy
+func newPodDemand(estimate ResourceEstimate, count int, strategy string, buildCfg BuildConfig) podDemand {
+	return podDemand{
+		estimate:                estimate,
+		count:                   count,
+		strategy:                strategy,
+		separateBuild:           !buildCfg.EmbedBuildSpec,
+		generatedServiceAccount: buildCfg.ServiceAccountName == "generated",
+	}
+}
+
+// quotaUsage returns the quota resources that a single buildrun of the
+// demand uses, a limit quota resource is missing in case the pod is not
+// limited in the respective resource
+func (demand podDemand) quotaUsage() corev1.ResourceList {
+	var one = resource.MustParse("1")
+	var usage = corev1.ResourceList{
+		corev1.ResourcePods: one,
+		quotaCountPods:      one,
+		quotaCountBuildRuns: one,
+		quotaCountTaskRuns:  one,
+	}
+
+	if demand.separateBuild {
+		usage[quotaCountBuilds] = one
+	}
+
+	if demand.generatedServiceAccount {
+		usage[quotaCountServiceAccounts] = one
+	}
+
+	if cpu, ok := demand.estimate.Requests[corev1.ResourceCPU]; ok {
+		usage[corev1.ResourceCPU] = cpu
+		usage[corev1.ResourceRequestsCPU] = cpu
+	}
+
+	if memory, ok := demand.estimate.Requests[corev1.ResourceMemory]; ok {
+		usage[corev1.ResourceMemory] = memory
+		usage[corev1.ResourceRequestsMemory] = memory
+	}
+
+	for quotaName, name := range quotaLimits {
+		if limit, ok := demand.estimate.Limits[name]; ok {
+			usage[quotaName] = limit
+		}
+	}
+
+	return usage
+}
+
+// checkNamespacePolicies checks the limit ranges and resource quotas of the
+// namespaces that the buildruns are spread across
+func checkNamespacePolicies(kubeAccess KubeAccess, namingCfg NamingConfig, demands []podDemand) error {
+	var namespaces = namingCfg.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{namingCfg.Namespace}
+	}
+
+	for i, namespace := range namespaces {
+		// buildruns are assigned to the namespaces round-robin
+		var shares = []podDemand{}
+		for _, demand := range demands {
+			var total = demand.count
+			demand.count = total / len(namespaces)
+			if i < total%len(namespaces) {
+				demand.count++
+			}
+
+			if demand.count > 0 {
+				shares = append(shares, demand)
+			}
+		}
+
+		if len(shares) == 0 {
+			continue
+		}
+
+		if err := checkLimitRanges(kubeAccess, namespace, shares); err != nil {
+			return err
+		}
+
+		if err := checkResourceQuotas(kubeAccess, namespace, shares); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkLimitRanges verifies that the buildrun pods stay within the minimum
+// and maximum values of the limit ranges, Kubernetes would reject the pods
+// otherwise
+func checkLimitRanges(kubeAccess KubeAccess, namespace string, demands []podDemand) error {
+	list, err := kubeAccess.Client.CoreV1().LimitRanges(namespace).List(kubeAccess.Context, metav1.ListOptions{})
+	if err != nil {
+		debug("unable to look up limit ranges in namespace %s: %v", namespace, err)
+		return nil
+	}
+
+	var violations = []string{}
+	for _, limitRange := range list.Items {
+		for _, demand := range demands {
+			for _, violation := range LimitRangeViolations(limitRange, demand.estimate) {
+				violations = append(violations, fmt.Sprintf("build strategy %s: %s", demand.strategy, violation))
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("buildrun pods would be rejected by the limit ranges in namespace %s:\n%s",
+			namespace,
+			strings.Join(violations, "\n"),
+		)
+	}
+
+	return nil
+}
+
+// LimitRangeViolations lists the minimum and maximum values of the limit
+// range that the containers or the pod of the estimate do not comply with
+func LimitRangeViolations(limitRange corev1.LimitRange, estimate ResourceEstimate) []string {
+	var violations = []string{}
+
+	var check = func(subject string, item corev1.LimitRangeItem, requests corev1.ResourceList, limits corev1.ResourceList) {
+		for _, name := range estimatedResources {
+			if min, ok := item.Min[name]; ok {
+				request, ok := requests[name]
+				switch {
+				case !ok:
+					violations = append(violations, fmt.Sprintf("%s has no %s request, but limit range %s requires a minimum of %s", subject, name, limitRange.Name, quantityString(name, min)))
+
+				case request.Cmp(min) < 0:
+					violations = append(violations, fmt.Sprintf("%s requests %s %s, which is less than the minimum %s of limit range %s", subject, quantityString(name, request), name, quantityString(name, min), limitRange.Name))
+				}
+			}
+
+			if max, ok := item.Max[name]; ok {
+				limit, ok := limits[name]
+				switch {
+				case !ok:
+					violations = append(violations, fmt.Sprintf("%s has no %s limit, but limit range %s requires a maximum of %s", subject, name, limitRange.Name, quantityString(name, max)))
+
+				case limit.Cmp(max) > 0:
+					violations = append(violations, fmt.Sprintf("%s limits %s to %s, which is more than the maximum %s of limit range %s", subject, name, quantityString(name, limit), quantityString(name, max), limitRange.Name))
+				}
+			}
+		}
+	}
+
+	for _, item := range limitRange.Spec.Limits {
+		switch item.Type {
+		case corev1.LimitTypeContainer:
+			for _, container := range estimate.Containers {
+				check(fmt.Sprintf("container %s", container.Name), item, container.Requests, container.Limits)
+			}
+
+		case corev1.LimitTypePod:
+			check("pod", item, estimate.Requests, estimate.Limits)
+		}
+	}
+
+	return violations
+}
+
+// checkResourceQuotas prints how many concurrent buildruns the resource
+// quotas of the namespace allow and fails in case the requested buildruns
+// exceed them
+func checkResourceQuotas(kubeAccess KubeAccess, namespace string, demands []podDemand) error {
+	list, err := kubeAccess.Client.CoreV1().ResourceQuotas(namespace).List(kubeAccess.Context, metav1.ListOptions{})
+	if err != nil {
+		debug("unable to look up resource quotas in namespace %s: %v", namespace, err)
+		return nil
+	}
+
+	var quotas = []corev1.ResourceQuota{}
+	for _, quota := range list.Items {
+		if len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil {
+			debug("skipping resource quota %s in namespace %s, scoped quotas are not supported", quota.Name, namespace)
+			continue
+		}
+
+		quotas = append(quotas, quota)
+	}
+
+	if len(quotas) == 0 {
+		return nil
+	}
+
+	var concurrent int
+	for _, demand := range demands {
+		concurrent += demand.count
+	}
+
+	for _, quota := range quotas {
+		for quotaName, name := range quotaLimits {
+			if _, ok := quota.Spec.Hard[quotaName]; !ok {
+				continue
+			}
+
+			for _, demand := range demands {
+				if _, ok := demand.estimate.Limits[name]; !ok {
+					return fmt.Errorf("%w: resource quota %s in namespace %s requires a %s limit, but the buildrun pods of build strategy %s are not limited",
+						ErrQuotaExceeded,
+						quota.Name,
+						namespace,
+						name,
+						demand.strategy,
+					)
+				}
+			}
+		}
+	}
+
+	var tableData = [][]string{
+		{
+			bunt.Sprintf("*Quota*"),
+			bunt.Sprintf("*Resource*"),
+			bunt.Sprintf("*Used*"),
+			bunt.Sprintf("*Hard*"),
+			bunt.Sprintf("*Per buildrun*"),
+			bunt.Sprintf("*Max concurrent*"),
+		},
+	}
+
+	var maxConcurrent = maxQuotaConcurrent(quotas, demands)
+	for _, quota := range quotas {
+		var names = make([]string, 0, len(quota.Spec.Hard))
+		for name := range quota.Spec.Hard {
+			names = append(names, string(name))
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			var resourceName = corev1.ResourceName(name)
+
+			var perBuildRun = []string{}
+			for _, demand := range demands {
+				if usage, ok := demand.quotaUsage()[resourceName]; ok {
+					perBuildRun = append(perBuildRun, quantityString(resourceName, usage))
+				}
+			}
+
+			if len(perBuildRun) == 0 {
+				continue
+			}
+
+			var fitting = "-"
+			if count := quotaFit(quota, resourceName, demands); count < maxFittingBuildRuns {
+				fitting = fmt.Sprintf("%d", count)
+			}
+
+			hard := quota.Spec.Hard[resourceName]
+			used := quota.Status.Used[resourceName]
+			tableData = append(tableData, []string{
+				quota.Name,
+				name,
+				quantityString(resourceName, used),
+				quantityString(resourceName, hard),
+				strings.Join(perBuildRun, ", "),
+				fitting,
+			})
+		}
+	}
+
+	if len(tableData) > 1 {
+		table, err := neat.Table(tableData, neat.AlignRight(2, 3, 4, 5), neat.CustomSeparator(bunt.Sprintf(" DimGray{│} ")))
+		if err != nil {
+			return err
+		}
+
+		bunt.Printf("Resource quotas in namespace *%s*:\n%s\n\n", namespace, table)
+	}
+
+	if maxConcurrent < maxFittingBuildRuns {
+		bunt.Printf("The resource quotas in namespace *%s* allow at most Moccasin{_%s_}.\n\n", namespace, text.Plural(maxConcurrent, "concurrent buildrun"))
+	}
+
+	if maxConcurrent < concurrent {
+		return fmt.Errorf("%w: the resource quotas in namespace %s allow only %d of %s",
+			ErrQuotaExceeded,
+			namespace,
+			maxConcurrent,
+			text.Plural(concurrent, "concurrent buildrun"),
+		)
+	}
+
+	return nil
+}
+
+// MaxConcurrentBuildRuns returns how many concurrent buildruns of the build
+// configuration with the estimated resources fit into the remaining quota of
+// the resource quotas
+func MaxConcurrentBuildRuns(quotas []corev1.ResourceQuota, estimate ResourceEstimate, buildCfg BuildConfig) int {
+	strategy, _ := buildCfg.strategy()
+	return maxQuotaConcurrent(quotas, []podDemand{newPodDemand(estimate, 1, strategy, buildCfg)})
+}
+
+// maxQuotaConcurrent returns how many concurrent buildruns with the mix of
+// the demands fit into the remaining quota of all resource quotas
+func maxQuotaConcurrent(quotas []corev1.ResourceQuota, demands []podDemand) int {
+	var result = maxFittingBuildRuns
+	for _, quota := range quotas {
+		for name := range quota.Spec.Hard {
+			if count := quotaFit(quota, name, demands); count < result {
+				result = count
+			}
+		}
+	}
+
+	return result
+}
+
+// quotaFit returns how many buildruns with the mix of the demands fit into
+// the remaining quota of the given resource, which is the hard limit minus
+// what is already used in the namespace
+func quotaFit(quota corev1.ResourceQuota, name corev1.ResourceName, demands []podDemand) int {
+	var pattern = interleave(demands)
+	if len(pattern) == 0 {
+		return maxFittingBuildRuns
+	}
+
+	var remaining = quota.Spec.Hard[name]
+	if used, ok := quota.Status.Used[name]; ok {
+		remaining.Sub(used)
+	}
+
+	var usages = make([]corev1.ResourceList, len(demands))
+	for i, demand := range demands {
+		usages[i] = demand.quotaUsage()
+	}
+
+	var count int
+	for ; count < maxFittingBuildRuns; count++ {
+		usage, ok := usages[pattern[count%len(pattern)]][name]
+		if !ok {
+			continue
+		}
+
+		remaining.Sub(usage)
+		if remaining.Sign() < 0 {
+			break
+		}
+	}
+
+	return count
+}
+
+func quantityString(name corev1.ResourceName, quantity resource.Quantity) string {
+	switch name {
+	case corev1.ResourceMemory, corev1.ResourceRequestsMemory, corev1.ResourceLimitsMemory:
+		return humanReadableMemory(&quantity)
+
+	default:
+		return quantity.String()
+	}
+}
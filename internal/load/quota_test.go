@@ -0,0 +1,124 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("resource quotas and limit ranges", func() {
+	var resources = func(cpu string, memory string) corev1.ResourceList {
+		return corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		}
+	}
+
+	var quota = func(name string, hard map[string]string, used map[string]string) corev1.ResourceQuota {
+		var result = corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{}},
+			Status:     corev1.ResourceQuotaStatus{Used: corev1.ResourceList{}},
+		}
+
+		for key, value := range hard {
+			result.Spec.Hard[corev1.ResourceName(key)] = resource.MustParse(value)
+		}
+
+		for key, value := range used {
+			result.Status.Used[corev1.ResourceName(key)] = resource.MustParse(value)
+		}
+
+		return result
+	}
+
+	var estimate = ResourceEstimate{
+		Containers: []ContainerEstimate{
+			{Name: "prepare", Type: ContainerTypeInit, Requests: resources("100m", "64Mi"), Limits: resources("100m", "64Mi")},
+			{Name: "step-build", Type: ContainerTypeStep, Requests: resources("500m", "1Gi"), Limits: resources("1", "2Gi")},
+		},
+		Requests: resources("500m", "1Gi"),
+		Limits:   resources("1", "2Gi"),
+	}
+
+	Context("maximum concurrent buildruns", func() {
+		It("should use the remaining quota of the most limiting resource", func() {
+			var quotas = []corev1.ResourceQuota{
+				quota("compute", map[string]string{"requests.cpu": "4", "requests.memory": "16Gi"}, map[string]string{"requests.cpu": "1", "requests.memory": "2Gi"}),
+				quota("objects", map[string]string{"pods": "20"}, map[string]string{"pods": "10"}),
+			}
+
+			Expect(MaxConcurrentBuildRuns(quotas, estimate, BuildConfig{})).To(Equal(6))
+		})
+
+		It("should consider the object counts of builds and generated service accounts", func() {
+			var quotas = []corev1.ResourceQuota{
+				quota("objects", map[string]string{"count/builds.shipwright.io": "10", "count/serviceaccounts": "5"}, map[string]string{"count/serviceaccounts": "2"}),
+			}
+
+			Expect(MaxConcurrentBuildRuns(quotas, estimate, BuildConfig{})).To(Equal(10))
+			Expect(MaxConcurrentBuildRuns(quotas, estimate, BuildConfig{EmbedBuildSpec: true})).To(BeNumerically(">", 10))
+			Expect(MaxConcurrentBuildRuns(quotas, estimate, BuildConfig{ServiceAccountName: "generated"})).To(Equal(3))
+		})
+
+		It("should not allow any buildrun in case the quota is used up", func() {
+			var quotas = []corev1.ResourceQuota{
+				quota("compute", map[string]string{"limits.memory": "8Gi"}, map[string]string{"limits.memory": "7Gi"}),
+			}
+
+			Expect(MaxConcurrentBuildRuns(quotas, estimate, BuildConfig{})).To(Equal(0))
+		})
+	})
+
+	Context("limit range violations", func() {
+		It("should report containers and pods outside of the minimum and maximum", func() {
+			var limitRange = corev1.LimitRange{
+				ObjectMeta: metav1.ObjectMeta{Name: "limits"},
+				Spec: corev1.LimitRangeSpec{
+					Limits: []corev1.LimitRangeItem{
+						{Type: corev1.LimitTypeContainer, Min: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")}},
+						{Type: corev1.LimitTypePod, Max: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}},
+					},
+				},
+			}
+
+			Expect(LimitRangeViolations(limitRange, estimate)).To(ConsistOf(
+				ContainSubstring("container prepare requests 100m cpu"),
+				ContainSubstring("pod limits memory to 2.0 GiB"),
+			))
+		})
+
+		It("should report nothing in case the estimate is within the limit range", func() {
+			var limitRange = corev1.LimitRange{
+				Spec: corev1.LimitRangeSpec{
+					Limits: []corev1.LimitRangeItem{
+						{Type: corev1.LimitTypeContainer, Min: resources("50m", "32Mi"), Max: resources("2", "4Gi")},
+					},
+				},
+			}
+
+			Expect(LimitRangeViolations(limitRange, estimate)).To(BeEmpty())
+		})
+	})
+})
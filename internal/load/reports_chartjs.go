@@ -17,10 +17,14 @@ limitations under the License.
 package load
 
 import (
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
+	"math"
 	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
 )
 
 const reportTemplate = `<!DOCTYPE html>
@@ -35,6 +39,19 @@ const reportTemplate = `<!DOCTYPE html>
   <div class="chart-container" style="position: relative; width:90vw;">
     <canvas id="myChart"></canvas>
   </div>
+{{ range .Tables }}
+  <table style="font-family: sans-serif; font-size: small; margin-top: 2em;">
+    <caption style="text-align: left; font-weight: bold;">{{ .Caption }}</caption>
+{{- range .Rows }}
+    <tr>{{ range . }}<td>{{ . }}</td>{{ end }}</tr>
+{{- end }}
+  </table>
+{{ end }}
+{{ range .Charts }}
+  <div class="chart-container" style="position: relative; width:90vw; margin-top: 2em;">
+    <canvas id="{{ .ID }}"></canvas>
+  </div>
+{{ end }}
 
 <script>
   var ctx = document.getElementById('myChart').getContext('2d');
@@ -81,6 +98,56 @@ const reportTemplate = `<!DOCTYPE html>
       legend: { position: 'bottom' },
     }
   });
+{{ range .Charts }}
+  new Chart(document.getElementById({{ .ID }}).getContext('2d'), {
+    type: 'line',
+    data: {
+      labels: {{ .Labels }},
+      datasets: {{ .Datasets }},
+    },
+    options: {
+      title: {
+        display: true,
+        text: {{ .Text }}
+      },
+      scales: {
+        xAxes: [{
+          scaleLabel: {
+            display: true,
+            labelString: 'time in seconds'
+          },
+        }],
+        yAxes: [{
+          id: 'usage',
+          position: 'left',
+          scaleLabel: {
+            display: true,
+            labelString: {{ .LabelY }}
+          },
+          ticks: {
+            beginAtZero: true,
+          },
+        }, {
+          id: 'load',
+          position: 'right',
+          scaleLabel: {
+            display: true,
+            labelString: 'active buildruns'
+          },
+          ticks: {
+            beginAtZero: true,
+          },
+          gridLines: {
+            display: false,
+          },
+        }]
+      },
+      responsive: true,
+      maintainAspectRatio: true,
+      legend: { position: 'bottom' },
+    }
+  });
+{{ end }}
 </script>
 </body>
 </html>
@@ -98,6 +165,145 @@ type inputs struct {
 	LabelY   string
 	Labels   []string
 	Datasets []dataset
+	Tables   []table
+	Charts   []chart
+}
+
+type table struct {
+	Caption string
+	Rows    [][]string
+}
+
+type lineDataset struct {
+	Label       string      `json:"label"`
+	BorderColor string      `json:"borderColor"`
+	Fill        bool        `json:"fill"`
+	YAxisID     string      `json:"yAxisID"`
+	Data        chartValues `json:"data"`
+}
+
+// chartValues are the values of a line, unknown values are NaN and are
+// rendered as null, which leaves a gap in the line
+type chartValues []float64
+
+func (values chartValues) MarshalJSON() ([]byte, error) {
+	var result = make([]*float64, len(values))
+	for i := range values {
+		if !math.IsNaN(values[i]) {
+			result[i] = &values[i]
+		}
+	}
+
+	return json.Marshal(result)
+}
+
+type chart struct {
+	ID       string
+	Text     string
+	LabelY   string
+	Labels   []string
+	Datasets []lineDataset
+}
+
+var lineColors = []string{"#34a887", "#fdc10a", "#ad36a6", "#6cf9a6", "#a064a6", "#ada469", "#3d7dd8", "#e0603c"}
+
+// reportCharts returns the optional resource usage charts that are rendered
+// below the tables, each with the number of active buildruns overlaid
+func reportCharts(options []ReportOption) []chart {
+	var o = newReportOptions(options)
+	if len(o.resourceUsage) == 0 {
+		return []chart{}
+	}
+
+	var start = o.resourceUsage[0].Time
+	var labels = make([]string, len(o.resourceUsage))
+	var load = lineDataset{Label: "active buildruns", BorderColor: "#808080", YAxisID: "load", Data: make([]float64, len(o.resourceUsage))}
+	for i, sample := range o.resourceUsage {
+		labels[i] = strconv.Itoa(int(sample.Time.Sub(start).Seconds()))
+		load.Data[i] = math.NaN()
+		if sample.ActiveBuildRuns != nil {
+			load.Data[i] = float64(*sample.ActiveBuildRuns)
+		}
+	}
+
+	var cpu = func(usage corev1.ResourceList) float64 { return usage.Cpu().AsApproximateFloat64() }
+	var memory = func(usage corev1.ResourceList) float64 { return float64(usage.Memory().Value()) / (1024 * 1024) }
+	var controllers = func(sample UsageSample) map[string]corev1.ResourceList { return sample.Controllers }
+	var nodes = func(sample UsageSample) map[string]corev1.ResourceList { return sample.Nodes }
+
+	var charts = []chart{}
+	for _, spec := range []struct {
+		text        string
+		labelY      string
+		selectUsage func(UsageSample) map[string]corev1.ResourceList
+		value       func(corev1.ResourceList) float64
+	}{
+		{"Controller CPU usage", "CPU cores", controllers, cpu},
+		{"Controller memory usage", "memory in MiB", controllers, memory},
+		{"Node CPU usage", "CPU cores", nodes, cpu},
+		{"Node memory usage", "memory in MiB", nodes, memory},
+	} {
+		var names = []string{}
+		for _, peak := range usagePeaks(o.resourceUsage, spec.selectUsage) {
+			names = append(names, peak.name)
+		}
+
+		if len(names) == 0 {
+			continue
+		}
+
+		var datasets = make([]lineDataset, 0, len(names)+1)
+		for i, name := range names {
+			var dataset = lineDataset{Label: name, BorderColor: lineColors[i%len(lineColors)], YAxisID: "usage", Data: make([]float64, len(o.resourceUsage))}
+			for j, sample := range o.resourceUsage {
+				if usage, ok := spec.selectUsage(sample)[name]; ok {
+					dataset.Data[j] = spec.value(usage)
+				}
+			}
+
+			datasets = append(datasets, dataset)
+		}
+
+		charts = append(charts, chart{
+			ID:       fmt.Sprintf("usageChart%d", len(charts)),
+			Text:     spec.text,
+			LabelY:   spec.labelY,
+			Labels:   labels,
+			Datasets: append(datasets, load),
+		})
+	}
+
+	return charts
+}
+
+// reportTables returns the optional tables that are rendered below the chart
+func reportTables(options []ReportOption) []table {
+	var o = newReportOptions(options)
+
+	var tables = []table{}
+	if o.fingerprint != nil {
+		tables = append(tables, table{Caption: "System under test", Rows: o.fingerprint.Entries()})
+	}
+
+	if o.controllerMetrics != nil {
+		tables = append(tables, table{Caption: "Controller metrics", Rows: o.controllerMetrics})
+	}
+
+	if o.apiStats != nil {
+		tables = append(tables,
+			table{Caption: "Kubernetes API requests", Rows: o.apiStats.Table()},
+			table{Caption: "Kubernetes API throttling", Rows: o.apiStats.Entries()},
+		)
+	}
+
+	if o.events != nil {
+		tables = append(tables,
+			table{Caption: "Top event reasons", Rows: o.events.ReasonsTable()},
+			table{Caption: "Warning events per buildrun", Rows: o.events.WarningsTable()},
+		)
+	}
+
+	return tables
 }
 
 func prepareDatasets() []dataset {
@@ -136,7 +342,7 @@ func prepareDatasets() []dataset {
 }
 
 // CreateBuildrunResultsChartJS creates a page with ChartJS to display the results of buildruns
-func CreateBuildrunResultsChartJS(data []Result, w io.Writer) error {
+func CreateBuildrunResultsChartJS(data []Result, w io.Writer, options ...ReportOption) error {
 	tmpl, err := template.New("report").Parse(reportTemplate)
 	if err != nil {
 		return err
@@ -159,11 +365,65 @@ func CreateBuildrunResultsChartJS(data []Result, w io.Writer) error {
 		LabelY:   "time in seconds",
 		Labels:   labels,
 		Datasets: datasets,
+		Tables:   reportTables(options),
+		Charts:   reportCharts(options),
+	})
+}
+
+// CreateBuildResultsChartJS creates a page with ChartJS to display the
+// results of buildruns, grouped by the build they were created for
+func CreateBuildResultsChartJS(data []BuildResults, w io.Writer, options ...ReportOption) error {
+	var names, numbers, results = make([]string, len(data)), make([][]int, len(data)), make([][]Result, len(data))
+	for i, buildResults := range data {
+		names[i], numbers[i], results[i] = buildResults.BuildName, buildResults.BuildRunNumbers, buildResults.Results
+	}
+
+	return createGroupedResultsChartJS("BuildRun times per build", names, numbers, results, w, options)
+}
+
+// CreateWorkloadResultsChartJS creates a page with ChartJS to display the
+// results of buildruns, grouped by the workload they belong to
+func CreateWorkloadResultsChartJS(data []WorkloadResults, w io.Writer, options ...ReportOption) error {
+	var names, results = make([]string, len(data)), make([][]Result, len(data))
+	for i, workloadResults := range data {
+		names[i], results[i] = workloadResults.Name, workloadResults.Results
+	}
+
+	return createGroupedResultsChartJS("BuildRun times per workload", names, nil, results, w, options)
+}
+
+func createGroupedResultsChartJS(text string, names []string, numbers [][]int, results [][]Result, w io.Writer, options []ReportOption) error {
+	tmpl, err := template.New("report").Parse(reportTemplate)
+	if err != nil {
+		return err
+	}
+
+	var labels = []string{}
+	var datasets = prepareDatasets()
+
+	for i, name := range names {
+		for j, buildRunResult := range results[i] {
+			labels = append(labels, fmt.Sprintf("%s #%d", name, buildRunNumber(numbers, i, j)))
+
+			for k, value := range buildRunResult {
+				datasets[k].Data = append(datasets[k].Data, value.Value.Seconds())
+			}
+		}
+	}
+
+	return tmpl.Execute(w, inputs{
+		Text:     text,
+		LabelX:   "buildrun",
+		LabelY:   "time in seconds",
+		Labels:   labels,
+		Datasets: datasets,
+		Tables:   reportTables(options),
+		Charts:   reportCharts(options),
 	})
 }
 
 // CreateChartJS creates a page with ChartsJS to render the provided results
-func CreateChartJS(data []ResultSet, w io.Writer) error {
+func CreateChartJS(data []ResultSet, w io.Writer, options ...ReportOption) error {
 	tmpl, err := template.New("report").Parse(reportTemplate)
 	if err != nil {
 		return err
@@ -189,5 +449,7 @@ func CreateChartJS(data []ResultSet, w io.Writer) error {
 		LabelY:   "time in seconds",
 		Labels:   labels,
 		Datasets: datasets,
+		Tables:   reportTables(options),
+		Charts:   reportCharts(options),
 	})
 }
@@ -20,12 +20,13 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 
 	"github.com/gonvenience/neat"
 )
 
 // CreateResultsCSV creates a comma separated values (CSV) content based on the buildruns
-func CreateResultsCSV(data []Result, w io.Writer) error {
+func CreateResultsCSV(data []Result, w io.Writer, options ...ReportOption) error {
 	var table = [][]string{}
 	for i, buildRunResult := range data {
 		// add header based on first entry
@@ -46,17 +47,59 @@ func CreateResultsCSV(data []Result, w io.Writer) error {
 		table = append(table, row)
 	}
 
-	out, err := neat.Table(table, neat.CustomSeparator(", "))
-	if err != nil {
-		return err
+	return writeCSV(table, w, options)
+}
+
+// CreateBuildResultsCSV creates a comma separated values (CSV) content based
+// on the buildruns, grouped by the build they were created for
+func CreateBuildResultsCSV(data []BuildResults, w io.Writer, options ...ReportOption) error {
+	var names, numbers, results = make([]string, len(data)), make([][]int, len(data)), make([][]Result, len(data))
+	for i, buildResults := range data {
+		names[i], numbers[i], results[i] = buildResults.BuildName, buildResults.BuildRunNumbers, buildResults.Results
 	}
 
-	_, err = fmt.Fprint(w, out)
-	return err
+	return createGroupedResultsCSV("build", names, numbers, results, w, options)
+}
+
+// CreateWorkloadResultsCSV creates a comma separated values (CSV) content
+// based on the buildruns, grouped by the workload they belong to
+func CreateWorkloadResultsCSV(data []WorkloadResults, w io.Writer, options ...ReportOption) error {
+	var names, results = make([]string, len(data)), make([][]Result, len(data))
+	for i, workloadResults := range data {
+		names[i], results[i] = workloadResults.Name, workloadResults.Results
+	}
+
+	return createGroupedResultsCSV("workload", names, nil, results, w, options)
+}
+
+func createGroupedResultsCSV(groupHeader string, names []string, numbers [][]int, results [][]Result, w io.Writer, options []ReportOption) error {
+	var table = [][]string{}
+	for i, name := range names {
+		for j, buildRunResult := range results[i] {
+			// add header based on first entry
+			if len(table) == 0 {
+				var row = []string{groupHeader, "buildrun"}
+				for _, value := range buildRunResult {
+					row = append(row, value.Description)
+				}
+
+				table = append(table, row)
+			}
+
+			var row = []string{name, strconv.Itoa(buildRunNumber(numbers, i, j))}
+			for _, value := range buildRunResult {
+				row = append(row, strconv.Itoa(int(value.Value.Milliseconds())))
+			}
+
+			table = append(table, row)
+		}
+	}
+
+	return writeCSV(table, w, options)
 }
 
 // CreateResultSetCSV creates a comma separated values (CSV) content based on the result sets
-func CreateResultSetCSV(data []ResultSet, w io.Writer) error {
+func CreateResultSetCSV(data []ResultSet, w io.Writer, options ...ReportOption) error {
 	var table = [][]string{}
 	for i, buildRunResultSet := range data {
 		// add header based on first set entry
@@ -77,6 +120,75 @@ func CreateResultSetCSV(data []ResultSet, w io.Writer) error {
 		table = append(table, row)
 	}
 
+	return writeCSV(table, w, options)
+}
+
+// writeCSV writes the table as comma separated values, preceded by the
+// cluster fingerprint, controller metrics, API request statistics, and event
+// reasons as comment lines in case they are configured
+// buildRunNumber returns the number of the j-th result of the i-th group,
+// which is its position in case no numbers are known for the group
+func buildRunNumber(numbers [][]int, i int, j int) int {
+	if i < len(numbers) && j < len(numbers[i]) {
+		return numbers[i][j]
+	}
+
+	return j + 1
+}
+
+func writeCSV(table [][]string, w io.Writer, options []ReportOption) error {
+	var o = newReportOptions(options)
+	if o.fingerprint != nil {
+		for _, entry := range o.fingerprint.Entries() {
+			if _, err := fmt.Fprintf(w, "# %s: %s\n", entry[0], entry[1]); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the first row of the controller metrics is the header
+	for i := 1; i < len(o.controllerMetrics); i++ {
+		var fields = []string{}
+		for j, value := range o.controllerMetrics[i][2:] {
+			if value != "" {
+				fields = append(fields, fmt.Sprintf("%s=%s", strings.ToLower(o.controllerMetrics[0][j+2]), value))
+			}
+		}
+
+		if _, err := fmt.Fprintf(w, "# controller metric %s %s: %s\n", o.controllerMetrics[i][0], o.controllerMetrics[i][1], strings.Join(fields, " ")); err != nil {
+			return err
+		}
+	}
+
+	if o.apiStats != nil {
+		// the first row of the API request table is the header
+		var requests = o.apiStats.Table()
+		for i := 1; i < len(requests); i++ {
+			var fields = []string{}
+			for j, value := range requests[i][2:] {
+				fields = append(fields, fmt.Sprintf("%s=%s", strings.ToLower(requests[0][j+2]), value))
+			}
+
+			if _, err := fmt.Fprintf(w, "# api requests %s %s: %s\n", requests[i][0], requests[i][1], strings.Join(fields, " ")); err != nil {
+				return err
+			}
+		}
+
+		for _, entry := range o.apiStats.Entries() {
+			if _, err := fmt.Fprintf(w, "# api %s: %s\n", entry[0], entry[1]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if o.events != nil {
+		for _, reason := range o.events.Reasons {
+			if _, err := fmt.Fprintf(w, "# event reason %s %s: count=%d objects=%d\n", reason.Type, reason.Reason, reason.Count, reason.Objects); err != nil {
+				return err
+			}
+		}
+	}
+
 	out, err := neat.Table(table, neat.CustomSeparator(", "))
 	if err != nil {
 		return err
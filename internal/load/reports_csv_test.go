@@ -60,6 +60,71 @@ var _ = Describe("create CSV reports", func() {
 		})
 	})
 
+	Context("having a cluster fingerprint", func() {
+		It("should add the fingerprint as comment lines before the values", func() {
+			var fingerprint = &Fingerprint{
+				CollectedAt:       time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+				KubernetesVersion: "v1.29.1",
+				ShipwrightVersion: "v0.12.0",
+				TektonVersion:     "v0.56.0",
+				NodeCount:         3,
+				NodeTypes:         map[string]int{"m5.xlarge (amd64, 4 CPU, 16.0 GiB)": 3},
+				BuildStrategies:   map[string]string{"ClusterBuildStrategy/kaniko": "0123456789ab"},
+			}
+
+			var buf bytes.Buffer
+			err := CreateResultsCSV(mockResults(1), &buf, WithFingerprint(fingerprint))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(buf.String()).To(Equal(`# collected at: 2024-05-01T12:00:00Z
+# kubernetes version: v1.29.1
+# shipwright version: v0.12.0
+# tekton version: v0.56.0
+# nodes: 3
+# node type m5.xlarge (amd64, 4 CPU, 16.0 GiB): 3
+# build strategy ClusterBuildStrategy/kaniko: 0123456789ab
+buildrun, mock #1, mock #2, mock #3, mock #4, mock #5
+1       , 1000   , 10000  , 100000 , 1000000, 10000000
+`))
+		})
+	})
+
+	Context("having results grouped by build", func() {
+		It("should create a CSV file with one row per buildrun of each build", func() {
+			var buildResults = []BuildResults{
+				{BuildName: "test-build-0", Results: mockResults(2)},
+				{BuildName: "test-build-1", Results: mockResults(3)},
+			}
+
+			var buf bytes.Buffer
+			err := CreateBuildResultsCSV(buildResults, &buf)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(buf.String()).To(Equal(`build       , buildrun, mock #1, mock #2, mock #3, mock #4, mock #5
+test-build-0, 1       , 1000   , 10000  , 100000 , 1000000, 10000000
+test-build-0, 2       , 2000   , 20000  , 200000 , 2000000, 20000000
+test-build-1, 1       , 1000   , 10000  , 100000 , 1000000, 10000000
+test-build-1, 2       , 2000   , 20000  , 200000 , 2000000, 20000000
+test-build-1, 3       , 3000   , 30000  , 300000 , 3000000, 30000000
+`))
+		})
+
+		It("should use the numbers of the buildruns that completed", func() {
+			var buildResults = []BuildResults{
+				{BuildName: "test-build-0", BuildRunNumbers: []int{1, 3}, Results: mockResults(2)},
+			}
+
+			var buf bytes.Buffer
+			err := CreateBuildResultsCSV(buildResults, &buf)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(buf.String()).To(Equal(`build       , buildrun, mock #1, mock #2, mock #3, mock #4, mock #5
+test-build-0, 1       , 1000   , 10000  , 100000 , 1000000, 10000000
+test-build-0, 3       , 2000   , 20000  , 200000 , 2000000, 20000000
+`))
+		})
+	})
+
 	Context("having a result set", func() {
 		It("should create a CSV file based on the content in the result set", func() {
 			var buildRunResultSets = []ResultSet{
@@ -18,6 +18,7 @@ package load
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/gonvenience/bunt"
 	"github.com/gonvenience/neat"
@@ -62,3 +63,61 @@ func (rs ResultSet) String() string {
 		neat.NoLineWrap(),
 	)
 }
+
+// TestPlanSummary creates an overview of the outcomes of all test plan steps
+func TestPlanSummary(results []TestPlanStepResult) string {
+	var tableData = [][]string{
+		{
+			bunt.Sprintf("*Step*"),
+			bunt.Sprintf("*Outcome*"),
+			bunt.Sprintf("*Retries*"),
+			bunt.Sprintf("*Buildruns*"),
+			bunt.Sprintf("*Median buildrun time*"),
+		},
+	}
+
+	for _, result := range results {
+		var outcome = result.Outcome
+		switch result.Outcome {
+		case StepSucceeded:
+			outcome = bunt.Sprintf("MintCream{%s}", outcome)
+
+		case StepFailed:
+			outcome = bunt.Sprintf("Red{%s}", outcome)
+
+		default:
+			outcome = bunt.Sprintf("DimGray{%s}", outcome)
+		}
+
+		var median = "-"
+		if result.ResultSet.NumberOfResults > 0 {
+			median = result.ResultSet.Median.ValueOf(BuildrunCompletionTime).String()
+		}
+
+		tableData = append(tableData, []string{
+			result.Name,
+			outcome,
+			strconv.Itoa(result.Retries),
+			strconv.Itoa(result.ResultSet.NumberOfResults),
+			median,
+		})
+	}
+
+	table, err := neat.Table(tableData, neat.AlignCenter(2, 3, 4), neat.CustomSeparator(bunt.Sprintf(" DimGray{│} ")))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, result := range results {
+		if result.Error != nil {
+			table += bunt.Sprintf("\n*%s:* %v", result.Name, result.Error)
+		}
+	}
+
+	return neat.ContentBox(
+		"Test plan summary",
+		table,
+		neat.HeadlineColor(bunt.Beige),
+		neat.NoLineWrap(),
+	)
+}
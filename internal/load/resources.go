@@ -0,0 +1,446 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gonvenience/bunt"
+	"github.com/gonvenience/neat"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+)
+
+// Types of containers in a buildrun pod
+const (
+	ContainerTypeInit    = "init"
+	ContainerTypeSource  = "source"
+	ContainerTypeStep    = "step"
+	ContainerTypeSidecar = "sidecar"
+)
+
+const (
+	tektonNamespace          = "tekton-pipelines"
+	tektonFeatureFlags       = "feature-flags"
+	tektonResultsSidecarName = "sidecar-tekton-log-results"
+)
+
+// estimatedResources are the resources that are part of the estimate
+var estimatedResources = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+
+// ContainerEstimate is the estimated resource requirements of one
+// container of a buildrun pod
+type ContainerEstimate struct {
+	Name     string
+	Type     string
+	Requests corev1.ResourceList
+	Limits   corev1.ResourceList
+}
+
+// ResourceEstimate is the estimated resource requirements of buildrun pods,
+// a resource that is missing in the limits is not limited
+type ResourceEstimate struct {
+	Containers []ContainerEstimate
+	Requests   corev1.ResourceList
+	Limits     corev1.ResourceList
+}
+
+// noResources returns an estimate without any requests or limits, which can
+// be used as a starting point to sum up estimates
+func noResources() ResourceEstimate {
+	var estimate = ResourceEstimate{Requests: corev1.ResourceList{}, Limits: corev1.ResourceList{}}
+	for _, name := range estimatedResources {
+		estimate.Requests[name] = resource.Quantity{}
+		estimate.Limits[name] = resource.Quantity{}
+	}
+
+	return estimate
+}
+
+// EstimateBuildRunResources estimates the resources of the pod that Tekton
+// creates for a buildrun of the given build strategy. The pod consists of
+// the init containers injected by Tekton, the source step added by
+// Shipwright, the steps of the build strategy, an optional image processing
+// step, and an optional results sidecar. Containers without requests or
+// limits get the defaults of the limit ranges, where Tekton splits the
+// default request across all containers of the pod, since steps run one
+// after another. Like the Kubernetes scheduler, the pod requests are the
+// maximum of the sum of all containers and the largest init container.
+func EstimateBuildRunResources(buildStrategy shipwrightBuild.BuilderStrategy, limitRanges []corev1.LimitRange, resultsSidecar bool) ResourceEstimate {
+	var steps = buildStrategy.GetBuildSteps()
+
+	var containers = []ContainerEstimate{
+		{Name: "prepare", Type: ContainerTypeInit},
+	}
+
+	for _, step := range steps {
+		if usesWorkspace(step.WorkingDir) {
+			containers = append(containers, ContainerEstimate{Name: "working-dir-initializer", Type: ContainerTypeInit})
+			break
+		}
+	}
+
+	containers = append(containers, ContainerEstimate{Name: "source-default", Type: ContainerTypeSource})
+
+	var imageProcessing bool
+	for _, step := range steps {
+		containers = append(containers, ContainerEstimate{
+			Name:     step.Name,
+			Type:     ContainerTypeStep,
+			Requests: step.Resources.Requests,
+			Limits:   step.Resources.Limits,
+		})
+
+		imageProcessing = imageProcessing || usesOutputDirectory(step)
+	}
+
+	if imageProcessing {
+		containers = append(containers, ContainerEstimate{Name: "image-processing", Type: ContainerTypeStep})
+	}
+
+	if resultsSidecar {
+		containers = append(containers, ContainerEstimate{Name: tektonResultsSidecarName, Type: ContainerTypeSidecar})
+	}
+
+	var appContainers int64
+	for _, container := range containers {
+		if container.Type != ContainerTypeInit {
+			appContainers++
+		}
+	}
+
+	var defaults = limitRangeDefaults(limitRanges)
+
+	var estimate = noResources()
+	var maxInit = noResources()
+	for i := range containers {
+		var container = &containers[i]
+		var requests, limits = corev1.ResourceList{}, corev1.ResourceList{}
+
+		for _, name := range estimatedResources {
+			request, hasRequest := container.Requests[name]
+			limit, hasLimit := container.Limits[name]
+
+			// Kubernetes uses the limit as the request, in case only the
+			// limit is configured
+			if !hasRequest && hasLimit {
+				request, hasRequest = limit, true
+			}
+
+			if !hasRequest {
+				if defaultRequest, ok := defaults.defaultRequest[name]; ok {
+					request, hasRequest = defaultRequest, true
+
+					if container.Type != ContainerTypeInit {
+						request = divide(defaultRequest, appContainers)
+						if min, ok := defaults.min[name]; ok && request.Cmp(min) < 0 {
+							request = min
+						}
+					}
+				}
+			}
+
+			if !hasLimit {
+				limit, hasLimit = defaults.defaultLimit[name]
+			}
+
+			if hasRequest {
+				requests[name] = request
+			}
+
+			if hasLimit {
+				limits[name] = limit
+			}
+
+			switch container.Type {
+			case ContainerTypeInit:
+				maxInit.Requests[name] = maxQuantity(maxInit.Requests[name], request)
+				if !hasLimit {
+					delete(maxInit.Limits, name)
+				} else if current, ok := maxInit.Limits[name]; ok {
+					maxInit.Limits[name] = maxQuantity(current, limit)
+				}
+
+			default:
+				var sum = estimate.Requests[name]
+				sum.Add(request)
+				estimate.Requests[name] = sum
+
+				if !hasLimit {
+					delete(estimate.Limits, name)
+				} else if current, ok := estimate.Limits[name]; ok {
+					current.Add(limit)
+					estimate.Limits[name] = current
+				}
+			}
+		}
+
+		container.Requests, container.Limits = requests, limits
+	}
+
+	for _, name := range estimatedResources {
+		estimate.Requests[name] = maxQuantity(estimate.Requests[name], maxInit.Requests[name])
+
+		appLimit, appLimited := estimate.Limits[name]
+		initLimit, initLimited := maxInit.Limits[name]
+		if appLimited && initLimited {
+			estimate.Limits[name] = maxQuantity(appLimit, initLimit)
+		} else {
+			delete(estimate.Limits, name)
+		}
+	}
+
+	estimate.Containers = containers
+	return estimate
+}
+
+// scaled returns the total requests and limits of the given number of
+// concurrent buildrun pods, without the container breakdown
+func (estimate ResourceEstimate) scaled(concurrent int64) ResourceEstimate {
+	var result = ResourceEstimate{Requests: corev1.ResourceList{}, Limits: corev1.ResourceList{}}
+	for name, quantity := range estimate.Requests {
+		result.Requests[name] = multiply(quantity, concurrent)
+	}
+
+	for name, quantity := range estimate.Limits {
+		result.Limits[name] = multiply(quantity, concurrent)
+	}
+
+	return result
+}
+
+// plus returns the sum of both estimates, without the container breakdown
+func (estimate ResourceEstimate) plus(other ResourceEstimate) ResourceEstimate {
+	var result = ResourceEstimate{Requests: corev1.ResourceList{}, Limits: corev1.ResourceList{}}
+	for _, name := range estimatedResources {
+		var request = estimate.Requests[name]
+		request.Add(other.Requests[name])
+		result.Requests[name] = request
+
+		limit, ok := estimate.Limits[name]
+		otherLimit, otherOk := other.Limits[name]
+		if ok && otherOk {
+			limit.Add(otherLimit)
+			result.Limits[name] = limit
+		}
+	}
+
+	return result
+}
+
+// String renders the per container breakdown of the estimate
+func (estimate ResourceEstimate) String() string {
+	var format = func(list corev1.ResourceList, name corev1.ResourceName) string {
+		quantity, ok := list[name]
+		switch {
+		case !ok:
+			return "-"
+
+		case name == corev1.ResourceMemory:
+			return humanReadableMemory(&quantity)
+
+		default:
+			return quantity.String()
+		}
+	}
+
+	var tableData = [][]string{
+		{
+			bunt.Sprintf("*Container*"),
+			bunt.Sprintf("*Type*"),
+			bunt.Sprintf("*CPU request*"),
+			bunt.Sprintf("*CPU limit*"),
+			bunt.Sprintf("*Memory request*"),
+			bunt.Sprintf("*Memory limit*"),
+		},
+	}
+
+	for _, container := range estimate.Containers {
+		tableData = append(tableData, []string{
+			container.Name,
+			container.Type,
+			format(container.Requests, corev1.ResourceCPU),
+			format(container.Limits, corev1.ResourceCPU),
+			format(container.Requests, corev1.ResourceMemory),
+			format(container.Limits, corev1.ResourceMemory),
+		})
+	}
+
+	tableData = append(tableData, []string{
+		bunt.Sprintf("*Pod*"),
+		"",
+		bunt.Sprintf("*%s*", format(estimate.Requests, corev1.ResourceCPU)),
+		bunt.Sprintf("*%s*", format(estimate.Limits, corev1.ResourceCPU)),
+		bunt.Sprintf("*%s*", format(estimate.Requests, corev1.ResourceMemory)),
+		bunt.Sprintf("*%s*", format(estimate.Limits, corev1.ResourceMemory)),
+	})
+
+	table, err := neat.Table(tableData, neat.AlignRight(2, 3, 4, 5), neat.CustomSeparator(bunt.Sprintf(" DimGray{│} ")))
+	if err != nil {
+		panic(err)
+	}
+
+	return table
+}
+
+// lookUpResourceEstimate estimates the resources of a buildrun pod of the
+// build strategy in the namespace, settings that cannot be looked up due to
+// missing permissions are ignored
+func lookUpResourceEstimate(kubeAccess KubeAccess, namespace string, buildStrategy shipwrightBuild.BuilderStrategy) ResourceEstimate {
+	var limitRanges []corev1.LimitRange
+	if list, err := kubeAccess.Client.CoreV1().LimitRanges(namespace).List(kubeAccess.Context, metav1.ListOptions{}); err == nil {
+		limitRanges = list.Items
+	}
+
+	var resultsSidecar bool
+	if featureFlags, err := kubeAccess.Client.CoreV1().ConfigMaps(tektonNamespace).Get(kubeAccess.Context, tektonFeatureFlags, metav1.GetOptions{}); err == nil {
+		resultsSidecar = featureFlags.Data["results-from"] == "sidecar-logs"
+	}
+
+	var estimate = EstimateBuildRunResources(buildStrategy, limitRanges, resultsSidecar)
+
+	bunt.Printf("Estimated resources of a buildrun pod using build strategy *%s*:\n", buildStrategy.GetName())
+	bunt.Printf("%s\n\n", estimate)
+
+	return estimate
+}
+
+type limitDefaults struct {
+	defaultRequest corev1.ResourceList
+	defaultLimit   corev1.ResourceList
+	min            corev1.ResourceList
+}
+
+// limitRangeDefaults returns the container defaults of the limit ranges, in
+// case multiple limit ranges define the same value, the first one is used
+func limitRangeDefaults(limitRanges []corev1.LimitRange) limitDefaults {
+	var result = limitDefaults{
+		defaultRequest: corev1.ResourceList{},
+		defaultLimit:   corev1.ResourceList{},
+		min:            corev1.ResourceList{},
+	}
+
+	var setIfMissing = func(target corev1.ResourceList, source corev1.ResourceList) {
+		for _, name := range estimatedResources {
+			if _, ok := target[name]; ok {
+				continue
+			}
+
+			if quantity, ok := source[name]; ok {
+				target[name] = quantity
+			}
+		}
+	}
+
+	for _, limitRange := range limitRanges {
+		for _, item := range limitRange.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+
+			// Kubernetes uses the maximum as the default limit, and the
+			// default limit as the default request, in case they are not
+			// configured
+			setIfMissing(result.defaultRequest, item.DefaultRequest)
+			setIfMissing(result.defaultRequest, item.Default)
+			setIfMissing(result.defaultRequest, item.Max)
+			setIfMissing(result.defaultLimit, item.Default)
+			setIfMissing(result.defaultLimit, item.Max)
+			setIfMissing(result.min, item.Min)
+		}
+	}
+
+	return result
+}
+
+// usesWorkspace checks whether Tekton needs to create the working directory
+// of a step, which it does for relative paths and paths in the workspace
+func usesWorkspace(workingDir string) bool {
+	switch {
+	case workingDir == "":
+		return false
+
+	case strings.HasPrefix(workingDir, "$(params.shp-"), strings.HasPrefix(workingDir, "/workspace"):
+		return true
+
+	default:
+		return !filepath.IsAbs(workingDir)
+	}
+}
+
+// usesOutputDirectory checks whether a step writes the image into the output
+// directory, in which case Shipwright adds a step to push the image
+func usesOutputDirectory(step shipwrightBuild.BuildStep) bool {
+	var values = append(append([]string{}, step.Command...), step.Args...)
+	for _, env := range step.Env {
+		values = append(values, env.Value)
+	}
+
+	for _, value := range values {
+		if strings.Contains(value, "$(params.shp-output-directory)") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func divide(quantity resource.Quantity, divisor int64) resource.Quantity {
+	if divisor <= 1 {
+		return quantity
+	}
+
+	if quantity.Format == resource.BinarySI {
+		return *resource.NewQuantity(quantity.Value()/divisor, resource.BinarySI)
+	}
+
+	return *resource.NewMilliQuantity(quantity.MilliValue()/divisor, quantity.Format)
+}
+
+func multiply(quantity resource.Quantity, factor int64) resource.Quantity {
+	if quantity.Format == resource.BinarySI {
+		return *resource.NewQuantity(quantity.Value()*factor, resource.BinarySI)
+	}
+
+	return *resource.NewMilliQuantity(quantity.MilliValue()*factor, quantity.Format)
+}
+
+func maxQuantity(a resource.Quantity, b resource.Quantity) resource.Quantity {
+	if b.Cmp(a) > 0 {
+		return b
+	}
+
+	return a
+}
+
+func humanReadableMemory(q *resource.Quantity) string {
+	var mods = []string{"Byte", "KiB", "MiB", "GiB", "TiB"}
+
+	tmp := float64(q.Value())
+
+	var i int
+	for i = 0; tmp > 1023.9 && i < len(mods)-1; i++ {
+		tmp /= 1024.0
+	}
+
+	return fmt.Sprintf("%.1f %s", tmp, mods[i])
+}
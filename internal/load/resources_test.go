@@ -0,0 +1,145 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+)
+
+var _ = Describe("estimating buildrun resources", func() {
+	var strategy = func(steps ...shipwrightBuild.BuildStep) shipwrightBuild.BuilderStrategy {
+		return &shipwrightBuild.ClusterBuildStrategy{
+			Spec: shipwrightBuild.BuildStrategySpec{BuildSteps: steps},
+		}
+	}
+
+	var step = func(name string, requests corev1.ResourceList, limits corev1.ResourceList) shipwrightBuild.BuildStep {
+		return shipwrightBuild.BuildStep{
+			Container: corev1.Container{
+				Name:      name,
+				Resources: corev1.ResourceRequirements{Requests: requests, Limits: limits},
+			},
+		}
+	}
+
+	var resources = func(cpu string, memory string) corev1.ResourceList {
+		return corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		}
+	}
+
+	var names = func(estimate ResourceEstimate) []string {
+		var result = []string{}
+		for _, container := range estimate.Containers {
+			result = append(result, container.Name)
+		}
+
+		return result
+	}
+
+	It("should not fail for a build strategy without steps", func() {
+		var estimate = EstimateBuildRunResources(strategy(), nil, false)
+		Expect(names(estimate)).To(Equal([]string{"prepare", "source-default"}))
+		Expect(estimate.Requests.Cpu().IsZero()).To(BeTrue())
+		Expect(estimate.Requests.Memory().IsZero()).To(BeTrue())
+		Expect(estimate.Limits).To(BeEmpty())
+	})
+
+	It("should sum up the requests and limits of all steps", func() {
+		var estimate = EstimateBuildRunResources(strategy(
+			step("build", resources("500m", "1Gi"), resources("1", "2Gi")),
+			step("push", resources("250m", "2Gi"), resources("500m", "2Gi")),
+		), nil, false)
+
+		Expect(names(estimate)).To(Equal([]string{"prepare", "source-default", "build", "push"}))
+		Expect(estimate.Requests.Cpu().String()).To(Equal("750m"))
+		Expect(estimate.Requests.Memory().String()).To(Equal("3Gi"))
+
+		// the source step has no limits, so the pod is not limited
+		Expect(estimate.Limits).To(BeEmpty())
+	})
+
+	It("should use the limit as the request in case only a limit is configured", func() {
+		var estimate = EstimateBuildRunResources(strategy(
+			step("build", nil, resources("1", "1Gi")),
+		), nil, false)
+
+		Expect(estimate.Requests.Cpu().String()).To(Equal("1"))
+		Expect(estimate.Requests.Memory().String()).To(Equal("1Gi"))
+	})
+
+	It("should apply the limit range defaults like Tekton does", func() {
+		var limitRanges = []corev1.LimitRange{
+			{
+				Spec: corev1.LimitRangeSpec{
+					Limits: []corev1.LimitRangeItem{
+						{
+							Type:           corev1.LimitTypeContainer,
+							DefaultRequest: resources("900m", "768Mi"),
+							Default:        resources("2", "2Gi"),
+							Min:            resources("100m", "128Mi"),
+						},
+					},
+				},
+			},
+		}
+
+		var estimate = EstimateBuildRunResources(strategy(
+			step("build", nil, nil),
+			step("push", nil, nil),
+		), limitRanges, false)
+
+		// the init container gets the full default request, the three other
+		// containers get a third of it, but at least the minimum
+		Expect(estimate.Containers[0].Requests.Cpu().String()).To(Equal("900m"))
+		Expect(estimate.Containers[1].Requests.Cpu().String()).To(Equal("300m"))
+		Expect(estimate.Containers[1].Requests.Memory().String()).To(Equal("256Mi"))
+		Expect(estimate.Containers[1].Limits.Cpu().String()).To(Equal("2"))
+
+		// the pod request is the maximum of the init container and the sum
+		// of all other containers
+		Expect(estimate.Requests.Cpu().String()).To(Equal("900m"))
+		Expect(estimate.Requests.Memory().String()).To(Equal("768Mi"))
+		Expect(estimate.Limits.Cpu().String()).To(Equal("6"))
+		Expect(estimate.Limits.Memory().String()).To(Equal("6Gi"))
+	})
+
+	It("should include containers that are added by Tekton and Shipwright", func() {
+		var build = step("build", nil, nil)
+		build.WorkingDir = "$(params.shp-source-root)"
+		build.Args = []string{"--destination", "$(params.shp-output-directory)"}
+
+		var estimate = EstimateBuildRunResources(strategy(build), nil, true)
+		Expect(names(estimate)).To(Equal([]string{
+			"prepare",
+			"working-dir-initializer",
+			"source-default",
+			"build",
+			"image-processing",
+			"sidecar-tekton-log-results",
+		}))
+	})
+})
@@ -0,0 +1,634 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+	shipwrightBuildBeta "github.com/shipwright-io/build/pkg/apis/build/v1beta1"
+
+	"gopkg.in/yaml.v3"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// maxIncludeDepth limits nested includes to detect include cycles
+const maxIncludeDepth = 16
+
+// VariableEnvPrefix is the prefix of environment variables that override
+// the variables declared in a test plan, for example BUILD_LOAD_VAR_REGISTRY
+// for the variable registry
+const VariableEnvPrefix = "BUILD_LOAD_VAR_"
+
+var nonAlphanumeric = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// jsonFieldIndex matches list indices in the field paths of JSON errors
+var jsonFieldIndex = regexp.MustCompile(`\.(\d+)\b`)
+
+// stepPath matches the path of a test plan step
+var stepPath = regexp.MustCompile(`^\.steps\[\d+\]`)
+
+// ValidationError describes an issue in a test plan, the line is only known
+// for content that is directly defined in the test plan file
+type ValidationError struct {
+	Line    int
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	var location = strings.TrimPrefix(e.Path, ".")
+	if e.Line > 0 {
+		location = fmt.Sprintf("line %d: %s", e.Line, location)
+	}
+
+	return fmt.Sprintf("%s: %s", location, e.Message)
+}
+
+// ValidationErrors is the list of all issues found in a test plan
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	var lines = []string{fmt.Sprintf("test plan has %d issue(s):", len(errs))}
+	for _, err := range errs {
+		lines = append(lines, "  "+err.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks that the test plan contains everything that is required
+// to run it
+func (testplan TestPlan) Validate() error {
+	if issues := testplan.validate(); len(issues) > 0 {
+		return issues
+	}
+
+	return nil
+}
+
+func (testplan TestPlan) validate() ValidationErrors {
+	var (
+		issues    ValidationErrors
+		names     = map[string]int{}
+		sourceURL = ".buildSpec.source.url"
+	)
+
+	if testplan.APIVersion == TestPlanAPIVersionV1Beta1 {
+		sourceURL = ".buildSpec.source.git.url"
+	}
+
+	var issue = func(i int, path string, format string, a ...interface{}) {
+		issues = append(issues, ValidationError{
+			Path:    fmt.Sprintf(".steps[%d]%s", i, path),
+			Message: fmt.Sprintf(format, a...),
+		})
+	}
+
+	if _, _, err := testplan.Defaults.onFailure(); err != nil {
+		issues = append(issues, ValidationError{Path: ".defaults.onFailure", Message: err.Error()})
+	}
+
+	if len(testplan.Steps) == 0 {
+		issues = append(issues, ValidationError{Path: ".steps", Message: "test plan has no steps"})
+	}
+
+	for i, step := range testplan.Steps {
+		switch {
+		case len(step.Name) == 0:
+			issue(i, ".name", "missing step name")
+
+		default:
+			if other, ok := names[step.Name]; ok {
+				issue(i, ".name", "step name %s is already used by step %d", step.Name, other+1)
+			}
+
+			names[step.Name] = i
+		}
+
+		if (step.BuildSpec.Source.URL == nil || len(*step.BuildSpec.Source.URL) == 0) && step.BuildSpec.Source.BundleContainer == nil {
+			issue(i, sourceURL, "missing source URL")
+		}
+
+		if len(step.BuildSpec.Strategy.Name) == 0 {
+			issue(i, ".buildSpec.strategy.name", "missing build strategy name")
+		}
+
+		if len(step.BuildSpec.Output.Image) == 0 {
+			issue(i, ".buildSpec.output.image", "missing output image")
+
+		} else if _, err := getOutputImageURL(step.Name, step.BuildSpec.Output.Image); err != nil {
+			issue(i, ".buildSpec.output.image", "%v", err)
+		}
+
+		for field, value := range map[string]int{"parallel": step.Parallel, "repeat": step.Repeat, "warmup": step.Warmup} {
+			if value < 0 {
+				issue(i, "."+field, "must not be negative")
+			}
+		}
+
+		if _, _, err := step.onFailure(); err != nil {
+			issue(i, ".onFailure", "%v", err)
+		}
+
+		if len(step.ConcurrentWith) > 0 {
+			if other, ok := names[step.ConcurrentWith]; !ok || other == i {
+				issue(i, ".concurrentWith", "step %s is not defined before this step", step.ConcurrentWith)
+			}
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Path < issues[j].Path })
+	return issues
+}
+
+// documentLines maps the paths of all nodes in the YAML document to the line
+// they are defined in
+func documentLines(data []byte) map[string]int {
+	var lines = map[string]int{}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil || len(document.Content) == 0 {
+		return lines
+	}
+
+	var walk func(node *yaml.Node, path string)
+	walk = func(node *yaml.Node, path string) {
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				var key, value = node.Content[i], node.Content[i+1]
+				lines[path+"."+key.Value] = key.Line
+				walk(value, path+"."+key.Value)
+			}
+
+		case yaml.SequenceNode:
+			for i, entry := range node.Content {
+				lines[fmt.Sprintf("%s[%d]", path, i)] = entry.Line
+				walk(entry, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	}
+
+	walk(document.Content[0], "")
+	return lines
+}
+
+// withLines adds the line numbers to the validation errors, in case a path
+// is not part of the document, the line of the closest parent is used, but
+// only within the same step, since generated and included steps are not
+// part of the document
+func withLines(issues ValidationErrors, lines map[string]int) ValidationErrors {
+	for i, issue := range issues {
+		var minPath = stepPath.FindString(issue.Path)
+		for path := issue.Path; len(path) > 0 && len(path) >= len(minPath); path = parentPath(path) {
+			if line, ok := lines[path]; ok {
+				issues[i].Line = line
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+	return issues
+}
+
+func parentPath(path string) string {
+	if idx := strings.LastIndexAny(path, ".["); idx >= 0 {
+		return path[:idx]
+	}
+
+	return ""
+}
+
+type testPlanOptions struct {
+	baseDir   string
+	variables map[string]string
+}
+
+// TestPlanOption specifies optional settings for loading a test plan
+type TestPlanOption func(*testPlanOptions)
+
+// TestPlanBaseDir sets the directory that relative include paths are
+// resolved against
+func TestPlanBaseDir(value string) TestPlanOption {
+	return func(o *testPlanOptions) {
+		o.baseDir = value
+	}
+}
+
+// TestPlanVariables sets variables, which take precedence over the
+// variables declared in the test plan and the environment
+func TestPlanVariables(value map[string]string) TestPlanOption {
+	return func(o *testPlanOptions) {
+		o.variables = value
+	}
+}
+
+// testPlanMatrix describes steps that are generated from all combinations
+// of the configured strategies, sources, and parallel buildruns, each
+// generated step is based on the step template
+type testPlanMatrix struct {
+	Strategies []map[string]interface{} `json:"strategies"`
+	Sources    []testPlanMatrixSource   `json:"sources"`
+	Parallel   []int                    `json:"parallel"`
+	Step       map[string]interface{}   `json:"step"`
+}
+
+type testPlanMatrixSource struct {
+	Name   string                 `json:"name"`
+	Source map[string]interface{} `json:"source"`
+}
+
+// expandTestPlanMatrix replaces the matrix section of the test plan with
+// the generated steps, which are appended to the list of steps
+func expandTestPlanMatrix(testplan interface{}) error {
+	plan, ok := testplan.(map[string]interface{})
+	if !ok || plan["matrix"] == nil {
+		return nil
+	}
+
+	if issues := checkUnknownFields(plan["matrix"], reflect.TypeOf(testPlanMatrix{}), ".matrix", alphaBuildSpecType); len(issues) > 0 {
+		return issues
+	}
+
+	var matrix testPlanMatrix
+	if err := remarshal(plan["matrix"], &matrix); err != nil {
+		return fmt.Errorf("failed to read test plan matrix: %w", err)
+	}
+
+	delete(plan, "matrix")
+
+	steps, _ := plan["steps"].([]interface{})
+	for _, strategy := range orNil(matrix.Strategies) {
+		for i, source := range orNil(matrix.Sources) {
+			for _, parallel := range orNil(matrix.Parallel) {
+				var step map[string]interface{}
+				if err := remarshal(matrix.Step, &step); err != nil {
+					return fmt.Errorf("failed to read test plan matrix step: %w", err)
+				}
+
+				if step == nil {
+					step = map[string]interface{}{}
+				}
+
+				buildSpec, _ := step["buildSpec"].(map[string]interface{})
+				if buildSpec == nil {
+					buildSpec = map[string]interface{}{}
+					step["buildSpec"] = buildSpec
+				}
+
+				var nameParts = []string{}
+				if name, ok := step["name"].(string); ok && len(name) > 0 {
+					nameParts = append(nameParts, name)
+				}
+
+				if strategy != nil {
+					buildSpec["strategy"] = *strategy
+					nameParts = append(nameParts, fmt.Sprintf("%v", (*strategy)["name"]))
+				}
+
+				if source != nil {
+					buildSpec["source"] = source.Source
+					nameParts = append(nameParts, source.name(i))
+				}
+
+				if parallel != nil {
+					step["parallel"] = *parallel
+					nameParts = append(nameParts, fmt.Sprintf("p%d", *parallel))
+				}
+
+				step["name"] = strings.Join(nameParts, "-")
+				steps = append(steps, step)
+			}
+		}
+	}
+
+	plan["steps"] = steps
+	return nil
+}
+
+// checkTestPlanFields checks the test plan for unknown fields, build specs
+// are checked against the build spec format of the test plan API version
+func checkTestPlanFields(testplan interface{}) ValidationErrors {
+	var buildSpecType = alphaBuildSpecType
+	if plan, ok := testplan.(map[string]interface{}); ok {
+		switch apiVersion := plan["apiVersion"]; apiVersion {
+		case nil, "", TestPlanAPIVersionV1Alpha1:
+
+		case TestPlanAPIVersionV1Beta1:
+			buildSpecType = betaBuildSpecType
+
+		default:
+			return ValidationErrors{{
+				Path:    ".apiVersion",
+				Message: fmt.Sprintf("unsupported test plan API version %v, use one of %s, or %s", apiVersion, TestPlanAPIVersionV1Alpha1, TestPlanAPIVersionV1Beta1),
+			}}
+		}
+	}
+
+	return checkUnknownFields(testplan, reflect.TypeOf(TestPlan{}), "", buildSpecType)
+}
+
+func (source testPlanMatrixSource) name(idx int) string {
+	if len(source.Name) > 0 {
+		return source.Name
+	}
+
+	return fmt.Sprintf("source%d", idx+1)
+}
+
+// orNil returns pointers to the list entries, or a list with a single nil
+// entry in case the list is empty, so that an unused matrix dimension does
+// not prevent the combinations of the other dimensions
+func orNil[T any](list []T) []*T {
+	if len(list) == 0 {
+		return []*T{nil}
+	}
+
+	var result = make([]*T, len(list))
+	for i := range list {
+		result[i] = &list[i]
+	}
+
+	return result
+}
+
+func remarshal(in interface{}, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+// resolveTestPlanIncludes replaces step entries with an include key with
+// the content of the referenced file, which is either a list of steps, or
+// a single step that the remaining keys of the entry are merged into
+func resolveTestPlanIncludes(testplan interface{}, baseDir string, depth int) (bool, error) {
+	plan, ok := testplan.(map[string]interface{})
+	if !ok {
+		return false, nil
+	}
+
+	steps, _ := plan["steps"].([]interface{})
+	resolved, err := resolveIncludes(steps, baseDir, depth)
+	if err != nil {
+		return false, err
+	}
+
+	if resolved == nil {
+		return false, nil
+	}
+
+	plan["steps"] = resolved
+	return !reflect.DeepEqual(steps, resolved), nil
+}
+
+func resolveIncludes(steps []interface{}, baseDir string, depth int) ([]interface{}, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("failed to include step fragments, more than %d nested includes (include cycle?)", maxIncludeDepth)
+	}
+
+	var result []interface{}
+	for _, step := range steps {
+		entry, ok := step.(map[string]interface{})
+		if !ok || entry["include"] == nil {
+			result = append(result, step)
+			continue
+		}
+
+		path, ok := entry["include"].(string)
+		if !ok {
+			return nil, fmt.Errorf("failed to include step fragment, the include %v is not a file path", entry["include"])
+		}
+
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+
+		data, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to include step fragment: %w", err)
+		}
+
+		var fragment interface{}
+		if err := yaml.Unmarshal(data, &fragment); err != nil {
+			return nil, fmt.Errorf("failed to parse step fragment %s: %w", path, err)
+		}
+
+		switch fragment := fragment.(type) {
+		case []interface{}:
+			if len(entry) > 1 {
+				return nil, fmt.Errorf("failed to include step fragment %s, a list of steps cannot be combined with additional settings", path)
+			}
+
+			included, err := resolveIncludes(fragment, filepath.Dir(path), depth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, included...)
+
+		case map[string]interface{}:
+			delete(entry, "include")
+			included, err := resolveIncludes([]interface{}{mergeMaps(fragment, entry)}, filepath.Dir(path), depth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, included...)
+
+		default:
+			return nil, fmt.Errorf("failed to include step fragment %s, it needs to be a step or a list of steps", path)
+		}
+	}
+
+	return result, nil
+}
+
+// mergeMaps merges the override map into the base map, nested maps are
+// merged recursively, all other values are replaced
+func mergeMaps(base map[string]interface{}, override map[string]interface{}) map[string]interface{} {
+	for key, value := range override {
+		baseMap, baseIsMap := base[key].(map[string]interface{})
+		overrideMap, overrideIsMap := value.(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			base[key] = mergeMaps(baseMap, overrideMap)
+			continue
+		}
+
+		base[key] = value
+	}
+
+	return base
+}
+
+// renderTestPlanVariables renders all string values of the test plan as
+// templates using the declared variables, which can be overridden by
+// environment variables and the provided variables
+func renderTestPlanVariables(testplan interface{}, overrides map[string]string) error {
+	plan, ok := testplan.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	var variables = map[string]interface{}{}
+	if declared, ok := plan["variables"].(map[string]interface{}); ok {
+		for name, value := range declared {
+			variables[name] = value
+
+			if value, ok := os.LookupEnv(VariableEnvPrefix + nonAlphanumeric.ReplaceAllString(strings.ToUpper(name), "_")); ok {
+				variables[name] = value
+			}
+		}
+	}
+
+	for name, value := range overrides {
+		variables[name] = value
+	}
+
+	delete(plan, "variables")
+
+	return render(plan, variables, "")
+}
+
+func render(node interface{}, variables map[string]interface{}, path string) error {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		for key, value := range node {
+			if str, ok := value.(string); ok {
+				rendered, err := renderString(str, variables, path+"."+key)
+				if err != nil {
+					return err
+				}
+
+				node[key] = rendered
+				continue
+			}
+
+			if err := render(value, variables, path+"."+key); err != nil {
+				return err
+			}
+		}
+
+	case []interface{}:
+		for i, value := range node {
+			if str, ok := value.(string); ok {
+				rendered, err := renderString(str, variables, fmt.Sprintf("%s[%d]", path, i))
+				if err != nil {
+					return err
+				}
+
+				node[i] = rendered
+				continue
+			}
+
+			if err := render(value, variables, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func renderString(value string, variables map[string]interface{}, path string) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+
+	tmpl, err := template.New(path).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template in %s: %w", path, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, variables); err != nil {
+		return "", fmt.Errorf("failed to render template in %s: %w", path, err)
+	}
+
+	return buf.String(), nil
+}
+
+// RenderTestPlan writes the YAML of the builds and buildruns that running
+// the test plan would create, using the API version of the test plan
+func RenderTestPlan(testplan TestPlan, w io.Writer) error {
+	if err := testplan.Validate(); err != nil {
+		return err
+	}
+
+	for _, step := range testplan.Steps {
+		settings := testplan.settingsOf(step)
+		for run := 0; run < (step.Warmup+step.repeat())*step.parallel(); run++ {
+			name, buildSpec, err := testPlanRun(step, settings, run)
+			if err != nil {
+				return err
+			}
+
+			build := newBuild(testplan.Namespace, name, buildSpec, settings.BuildAnnotations)
+			buildRun := newBuildRun(name, build, settings.ServiceAccountName)
+
+			build.TypeMeta.APIVersion = shipwrightBuild.SchemeGroupVersion.String()
+			buildRun.TypeMeta.APIVersion = shipwrightBuild.SchemeGroupVersion.String()
+
+			var objects = []interface{}{build, buildRun}
+			if testplan.APIVersion == TestPlanAPIVersionV1Beta1 {
+				betaBuild, err := toBeta[shipwrightBuildBeta.Build](context.Background(), &build)
+				if err != nil {
+					return err
+				}
+
+				betaBuildRun, err := toBeta[shipwrightBuildBeta.BuildRun](context.Background(), &buildRun)
+				if err != nil {
+					return err
+				}
+
+				betaBuild.TypeMeta = metav1.TypeMeta{Kind: "Build", APIVersion: shipwrightBuildBeta.SchemeGroupVersion.String()}
+				betaBuildRun.TypeMeta = metav1.TypeMeta{Kind: "BuildRun", APIVersion: shipwrightBuildBeta.SchemeGroupVersion.String()}
+				objects = []interface{}{betaBuild, betaBuildRun}
+			}
+
+			for _, obj := range objects {
+				data, err := sigsyaml.Marshal(obj)
+				if err != nil {
+					return err
+				}
+
+				if _, err := fmt.Fprintf(w, "---\n%s\n", data); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
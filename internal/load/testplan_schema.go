@@ -0,0 +1,301 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+	shipwrightBuildBeta "github.com/shipwright-io/build/pkg/apis/build/v1beta1"
+)
+
+// Both the JSON Schema and the check for unknown fields are derived from
+// the Go types of the test plan and the Shipwright build specs, so that
+// they do not need to be maintained separately.
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	alphaBuildSpecType  = reflect.TypeOf(shipwrightBuild.BuildSpec{})
+	betaBuildSpecType   = reflect.TypeOf(shipwrightBuildBeta.BuildSpec{})
+
+	// types with a custom JSON format, which is not visible in their fields
+	customSchemas = map[reflect.Type]map[string]interface{}{
+		reflect.TypeOf(metav1.Duration{}):    {"type": "string"},
+		reflect.TypeOf(metav1.Time{}):        {"type": "string", "format": "date-time"},
+		reflect.TypeOf(resource.Quantity{}):  {"type": []string{"string", "number"}},
+		reflect.TypeOf(intstr.IntOrString{}): {"type": []string{"string", "integer"}},
+	}
+)
+
+// TestPlanJSONSchema returns the JSON Schema of the test plan YAML format
+func TestPlanJSONSchema() ([]byte, error) {
+	var generator = schemaGenerator{definitions: map[string]interface{}{}}
+
+	generator.schemaOf(reflect.TypeOf(TestPlan{}))
+	var alphaBuildSpec = generator.schemaOf(alphaBuildSpecType)
+	var betaBuildSpec = generator.schemaOf(betaBuildSpecType)
+	var matrix = generator.schemaOf(reflect.TypeOf(testPlanMatrix{}))
+
+	// The build spec format depends on the API version of the test plan, and
+	// steps can also be includes of steps defined in other files
+	step := generator.definitions[definitionName(reflect.TypeOf(TestPlanStep{}))].(map[string]interface{})
+	stepProperties := step["properties"].(map[string]interface{})
+	stepProperties["buildSpec"] = map[string]interface{}{"type": "object"}
+	stepProperties["include"] = map[string]interface{}{"type": "string"}
+
+	root := generator.definitions[definitionName(reflect.TypeOf(TestPlan{}))].(map[string]interface{})
+	rootProperties := root["properties"].(map[string]interface{})
+	rootProperties["apiVersion"] = map[string]interface{}{"enum": []string{TestPlanAPIVersionV1Alpha1, TestPlanAPIVersionV1Beta1}}
+	rootProperties["variables"] = map[string]interface{}{"type": "object"}
+	rootProperties["matrix"] = matrix
+
+	var buildSpecOf = func(buildSpec interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"properties": map[string]interface{}{
+				"steps": map[string]interface{}{
+					"items": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"buildSpec": buildSpec,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	var schema = map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"title":       "build-load test plan",
+		"definitions": generator.definitions,
+		"allOf": []interface{}{
+			map[string]interface{}{"$ref": "#/definitions/" + definitionName(reflect.TypeOf(TestPlan{}))},
+			map[string]interface{}{
+				"if": map[string]interface{}{
+					"properties": map[string]interface{}{"apiVersion": map[string]interface{}{"const": TestPlanAPIVersionV1Beta1}},
+					"required":   []string{"apiVersion"},
+				},
+				"then": buildSpecOf(betaBuildSpec),
+				"else": buildSpecOf(alphaBuildSpec),
+			},
+		},
+	}
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+type schemaGenerator struct {
+	definitions map[string]interface{}
+}
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if schema, ok := customSchemas[t]; ok {
+		return schema
+	}
+
+	if isJSONUnmarshaler(t) {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		var name = definitionName(t)
+		if _, ok := g.definitions[name]; !ok {
+			// reserve the name first to support recursive types
+			g.definitions[name] = map[string]interface{}{}
+
+			var properties = map[string]interface{}{}
+			for fieldName, fieldType := range jsonFields(t) {
+				properties[fieldName] = g.schemaOf(fieldType)
+			}
+
+			g.definitions[name] = map[string]interface{}{
+				"type":                 "object",
+				"properties":           properties,
+				"additionalProperties": false,
+			}
+		}
+
+		return map[string]interface{}{"$ref": "#/definitions/" + name}
+
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string"}
+		}
+
+		return map[string]interface{}{"type": "array", "items": g.schemaOf(t.Elem())}
+
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// definitionName uses the last two elements of the package path to create
+// unique, but readable names, for example core.v1.EnvVar
+func definitionName(t reflect.Type) string {
+	var pkg = t.PkgPath()
+	return fmt.Sprintf("%s.%s.%s", path.Base(path.Dir(pkg)), path.Base(pkg), t.Name())
+}
+
+// jsonFields returns the JSON field names of a struct type and their types,
+// including the fields of embedded structs
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	var fields = map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		var field = t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			var embedded = field.Type
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+
+			if embedded.Kind() == reflect.Struct {
+				for embeddedName, embeddedType := range jsonFields(embedded) {
+					fields[embeddedName] = embeddedType
+				}
+
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		fields[name] = field.Type
+	}
+
+	return fields
+}
+
+func isJSONUnmarshaler(t reflect.Type) bool {
+	return t.Implements(jsonUnmarshalerType) || reflect.PointerTo(t).Implements(jsonUnmarshalerType)
+}
+
+// checkUnknownFields reports all keys of the input that do not match with a
+// JSON field of the given type, the JSON package would silently ignore
+// those, or match them case-insensitively
+func checkUnknownFields(value interface{}, t reflect.Type, path string, buildSpecType reflect.Type) ValidationErrors {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == alphaBuildSpecType {
+		t = buildSpecType
+	}
+
+	if _, ok := customSchemas[t]; ok || isJSONUnmarshaler(t) {
+		return nil
+	}
+
+	var result ValidationErrors
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		var fields = jsonFields(t)
+
+		var keys = make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fieldType, ok := fields[key]
+			if !ok {
+				var message = "unknown field"
+				for name := range fields {
+					if strings.EqualFold(name, key) {
+						message = fmt.Sprintf("unknown field, did you mean %s?", name)
+					}
+				}
+
+				result = append(result, ValidationError{Path: path + "." + key, Message: message})
+				continue
+			}
+
+			result = append(result, checkUnknownFields(obj[key], fieldType, path+"."+key, buildSpecType)...)
+		}
+
+	case reflect.Slice, reflect.Array:
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+
+		for i, entry := range list {
+			result = append(result, checkUnknownFields(entry, t.Elem(), fmt.Sprintf("%s[%d]", path, i), buildSpecType)...)
+		}
+
+	case reflect.Map:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		for key, entry := range obj {
+			result = append(result, checkUnknownFields(entry, t.Elem(), path+"."+key, buildSpecType)...)
+		}
+	}
+
+	return result
+}
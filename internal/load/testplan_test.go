@@ -0,0 +1,394 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+)
+
+var _ = Describe("test plan loading", func() {
+	Context("using a matrix section", func() {
+		It("should expand the matrix into steps", func() {
+			testplan, err := NewTestPlan(strings.NewReader(`---
+namespace: test-namespace
+steps:
+- name: explicit
+  buildSpec:
+    source:
+      url: https://github.com/shipwright-io/sample-go
+    strategy:
+      name: kaniko
+    output:
+      image: registry.example.com/org
+matrix:
+  strategies:
+  - name: kaniko
+    kind: ClusterBuildStrategy
+  - name: buildah
+    kind: ClusterBuildStrategy
+  sources:
+  - name: go
+    source:
+      url: https://github.com/shipwright-io/sample-go
+      contextDir: docker-build
+  - source:
+      url: https://github.com/shipwright-io/sample-nodejs
+  parallel: [1, 5]
+  step:
+    repeat: 3
+    buildSpec:
+      output:
+        image: registry.example.com/org
+`))
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(testplan.Steps).To(HaveLen(9))
+
+			var names = []string{}
+			for _, step := range testplan.Steps {
+				names = append(names, step.Name)
+			}
+
+			Expect(names).To(Equal([]string{
+				"explicit",
+				"kaniko-go-p1",
+				"kaniko-go-p5",
+				"kaniko-source2-p1",
+				"kaniko-source2-p5",
+				"buildah-go-p1",
+				"buildah-go-p5",
+				"buildah-source2-p1",
+				"buildah-source2-p5",
+			}))
+
+			step := testplan.Steps[2]
+			Expect(step.Parallel).To(Equal(5))
+			Expect(step.Repeat).To(Equal(3))
+			Expect(step.BuildSpec.Strategy.Name).To(Equal("kaniko"))
+			Expect(*step.BuildSpec.Source.URL).To(Equal("https://github.com/shipwright-io/sample-go"))
+			Expect(*step.BuildSpec.Source.ContextDir).To(Equal("docker-build"))
+			Expect(step.BuildSpec.Output.Image).To(Equal("registry.example.com/org"))
+		})
+
+		It("should expand the matrix before converting v1beta1 build specs", func() {
+			testplan, err := NewTestPlan(strings.NewReader(`---
+apiVersion: shipwright.io/v1beta1
+matrix:
+  strategies:
+  - name: kaniko
+  - name: buildah
+  sources:
+  - name: go
+    source:
+      type: Git
+      git:
+        url: https://github.com/shipwright-io/sample-go
+  step:
+    name: release
+    buildSpec:
+      output:
+        image: registry.example.com/org
+`))
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(testplan.Steps).To(HaveLen(2))
+			Expect(testplan.Steps[1].Name).To(Equal("release-buildah-go"))
+			Expect(*testplan.Steps[1].BuildSpec.Source.URL).To(Equal("https://github.com/shipwright-io/sample-go"))
+		})
+	})
+
+	Context("using variables", func() {
+		const testplanWithVariables = `---
+variables:
+  registry: registry.example.com/org
+  secret: reg-cred
+namespace: "{{ .namespace }}"
+steps:
+- name: kaniko
+  buildSpec:
+    source:
+      url: https://github.com/shipwright-io/sample-go
+    strategy:
+      name: kaniko
+    output:
+      image: "{{ .registry }}"
+      credentials:
+        name: "{{ .secret }}"
+`
+
+		It("should render the variables in all fields", func() {
+			testplan, err := NewTestPlan(strings.NewReader(testplanWithVariables), TestPlanVariables(map[string]string{"namespace": "test-namespace"}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(testplan.Namespace).To(Equal("test-namespace"))
+			Expect(testplan.Steps[0].BuildSpec.Output.Image).To(Equal("registry.example.com/org"))
+			Expect(testplan.Steps[0].BuildSpec.Output.Credentials.Name).To(Equal("reg-cred"))
+		})
+
+		It("should use environment variables and explicit variables in that order of precedence", func() {
+			GinkgoT().Setenv(VariableEnvPrefix+"REGISTRY", "env.example.com/org")
+			GinkgoT().Setenv(VariableEnvPrefix+"SECRET", "env-cred")
+
+			testplan, err := NewTestPlan(strings.NewReader(testplanWithVariables), TestPlanVariables(map[string]string{
+				"namespace": "test-namespace",
+				"secret":    "set-cred",
+			}))
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(testplan.Steps[0].BuildSpec.Output.Image).To(Equal("env.example.com/org"))
+			Expect(testplan.Steps[0].BuildSpec.Output.Credentials.Name).To(Equal("set-cred"))
+		})
+
+		It("should fail for undefined variables", func() {
+			_, err := NewTestPlan(strings.NewReader(testplanWithVariables))
+			Expect(err).To(MatchError(ContainSubstring("namespace")))
+		})
+	})
+
+	Context("using includes", func() {
+		It("should include step fragments relative to the base directory", func() {
+			dir := GinkgoT().TempDir()
+			Expect(os.MkdirAll(filepath.Join(dir, "fragments"), 0o755)).To(Succeed())
+
+			Expect(os.WriteFile(filepath.Join(dir, "fragments", "kaniko.yml"), []byte(`---
+name: kaniko
+buildSpec:
+  strategy:
+    name: kaniko
+  output:
+    image: "{{ .registry }}"
+`), 0o600)).To(Succeed())
+
+			Expect(os.WriteFile(filepath.Join(dir, "fragments", "steps.yml"), []byte(`---
+- include: kaniko.yml
+  name: kaniko-nodejs
+  buildSpec:
+    source:
+      url: https://github.com/shipwright-io/sample-nodejs
+`), 0o600)).To(Succeed())
+
+			testplan, err := NewTestPlan(strings.NewReader(`---
+variables:
+  registry: registry.example.com/org
+steps:
+- include: fragments/kaniko.yml
+  buildSpec:
+    source:
+      url: https://github.com/shipwright-io/sample-go
+- include: fragments/steps.yml
+`), TestPlanBaseDir(dir))
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(testplan.Steps).To(HaveLen(2))
+			Expect(testplan.Steps[0].Name).To(Equal("kaniko"))
+			Expect(*testplan.Steps[0].BuildSpec.Source.URL).To(Equal("https://github.com/shipwright-io/sample-go"))
+			Expect(testplan.Steps[0].BuildSpec.Strategy.Name).To(Equal("kaniko"))
+			Expect(testplan.Steps[0].BuildSpec.Output.Image).To(Equal("registry.example.com/org"))
+			Expect(testplan.Steps[1].Name).To(Equal("kaniko-nodejs"))
+			Expect(*testplan.Steps[1].BuildSpec.Source.URL).To(Equal("https://github.com/shipwright-io/sample-nodejs"))
+		})
+
+		It("should detect include cycles", func() {
+			dir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(dir, "cycle.yml"), []byte("- include: cycle.yml\n"), 0o600)).To(Succeed())
+
+			_, err := NewTestPlan(strings.NewReader("steps:\n- include: cycle.yml\n"), TestPlanBaseDir(dir))
+			Expect(err).To(MatchError(ContainSubstring("include cycle")))
+		})
+	})
+
+	Context("validating test plans", func() {
+		It("should report unknown fields with their line number", func() {
+			_, err := NewTestPlan(strings.NewReader(`---
+namespace: test-namespace
+steps:
+- name: kaniko
+  buildspec:
+    source:
+      url: https://github.com/shipwright-io/sample-go
+`))
+
+			Expect(err).To(MatchError(ContainSubstring("line 5: steps[0].buildspec: unknown field, did you mean buildSpec?")))
+		})
+
+		It("should report unknown fields in build specs", func() {
+			_, err := NewTestPlan(strings.NewReader(`---
+steps:
+- name: kaniko
+  buildSpec:
+    source:
+      url: https://github.com/shipwright-io/sample-go
+      revison: main
+    strategy:
+      name: kaniko
+    output:
+      image: registry.example.com/org
+`))
+
+			Expect(err).To(MatchError(ContainSubstring("line 7: steps[0].buildSpec.source.revison: unknown field")))
+		})
+
+		It("should report missing required fields", func() {
+			_, err := NewTestPlan(strings.NewReader(`---
+steps:
+- name: kaniko
+  buildSpec:
+    strategy:
+      name: kaniko
+    output:
+      image: registry.example.com/org
+`))
+
+			Expect(err).To(MatchError(ContainSubstring("line 4: steps[0].buildSpec.source.url: missing source URL")))
+		})
+
+		It("should report values of the wrong type", func() {
+			_, err := NewTestPlan(strings.NewReader(`---
+steps:
+- name: kaniko
+  parallel: many
+`))
+
+			Expect(err).To(MatchError(ContainSubstring("line 4: steps[0].parallel: cannot use string value as int")))
+		})
+
+		It("should publish the current JSON Schema", func() {
+			schema, err := TestPlanJSONSchema()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(json.Valid(schema)).To(BeTrue())
+
+			published, err := os.ReadFile(filepath.Join("..", "..", "docs", "testplan.schema.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.TrimSpace(string(published))).To(Equal(string(schema)), "run make schema to update the published JSON Schema")
+		})
+	})
+
+	Context("rendering test plans", func() {
+		It("should render the builds and buildruns of all runs", func() {
+			testplan, err := NewTestPlan(strings.NewReader(`---
+apiVersion: shipwright.io/v1beta1
+namespace: test-namespace
+steps:
+- name: kaniko
+  parallel: 2
+  repeat: 2
+  buildSpec:
+    source:
+      type: Git
+      git:
+        url: https://github.com/shipwright-io/sample-go
+    strategy:
+      name: kaniko
+    output:
+      image: registry.example.com/org
+`))
+			Expect(err).ToNot(HaveOccurred())
+
+			var buf bytes.Buffer
+			Expect(RenderTestPlan(*testplan, &buf)).To(Succeed())
+
+			var output = buf.String()
+			Expect(strings.Count(output, "kind: Build\n")).To(Equal(4))
+			Expect(strings.Count(output, "kind: BuildRun\n")).To(Equal(4))
+			Expect(output).To(ContainSubstring("apiVersion: shipwright.io/v1beta1"))
+			Expect(output).To(ContainSubstring("name: test-plan-step-kaniko-3"))
+			Expect(output).To(ContainSubstring("image: registry.example.com/org/test-plan-step-kaniko-0:latest"))
+		})
+	})
+
+	Context("using defaults and step overrides", func() {
+		It("should apply the defaults to all steps, unless a step overrides them", func() {
+			testplan, err := NewTestPlan(strings.NewReader(`---
+namespace: test-namespace
+defaults:
+  serviceAccountName: builder
+  timeout: 10m
+  onFailure: continue
+  buildAnnotations:
+    team: a
+    purpose: load
+steps:
+- name: one
+  buildSpec:
+    source:
+      url: https://github.com/shipwright-io/sample-go
+    strategy:
+      name: kaniko
+    output:
+      image: registry.example.com/org
+- name: two
+  serviceAccountName: pipeline
+  timeout: 5m
+  onFailure: retry(2)
+  buildAnnotations:
+    team: b
+  buildSpec:
+    source:
+      url: https://github.com/shipwright-io/sample-go
+    strategy:
+      name: kaniko
+    output:
+      image: registry.example.com/org
+`))
+			Expect(err).ToNot(HaveOccurred())
+
+			var buf bytes.Buffer
+			Expect(RenderTestPlan(*testplan, &buf)).To(Succeed())
+
+			documents := strings.Split(buf.String(), "---\n")
+			Expect(documents).To(HaveLen(5))
+
+			Expect(documents[1]).To(ContainSubstring("team: a"))
+			Expect(documents[1]).To(ContainSubstring("purpose: load"))
+			Expect(documents[1]).To(ContainSubstring("timeout: 10m0s"))
+			Expect(documents[2]).To(ContainSubstring("name: builder"))
+
+			Expect(documents[3]).To(ContainSubstring("team: b"))
+			Expect(documents[3]).To(ContainSubstring("purpose: load"))
+			Expect(documents[3]).To(ContainSubstring("timeout: 5m0s"))
+			Expect(documents[4]).To(ContainSubstring("name: pipeline"))
+		})
+
+		It("should reject unknown failure policies", func() {
+			_, err := NewTestPlan(strings.NewReader(`---
+defaults:
+  onFailure: retry
+steps:
+- name: one
+  onFailure: ignore
+  buildSpec:
+    source:
+      url: https://github.com/shipwright-io/sample-go
+    strategy:
+      name: kaniko
+    output:
+      image: registry.example.com/org
+`))
+
+			Expect(err).To(MatchError(ContainSubstring("line 3: defaults.onFailure: unsupported failure policy retry")))
+			Expect(err).To(MatchError(ContainSubstring("line 6: steps[0].onFailure: unsupported failure policy ignore")))
+		})
+	})
+})
@@ -0,0 +1,323 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gonvenience/bunt"
+	"github.com/gonvenience/neat"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const metricsAPIPath = "/apis/metrics.k8s.io/v1beta1"
+
+// UsageSample is the CPU and memory usage of the controller pods and the
+// nodes at one point in time, together with the number of active buildruns
+// of the run, which is nil in case the buildruns could not be listed
+type UsageSample struct {
+	Time            time.Time
+	ActiveBuildRuns *int
+	Controllers     map[string]corev1.ResourceList
+	Nodes           map[string]corev1.ResourceList
+}
+
+// metricsList is the subset of the pod and node metrics lists of the
+// metrics.k8s.io API that is required to sum up the usage
+type metricsList struct {
+	Items []struct {
+		Metadata   metav1.ObjectMeta   `json:"metadata"`
+		Usage      corev1.ResourceList `json:"usage"`
+		Containers []struct {
+			Usage corev1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// UsageSampler periodically samples the resource usage until it is stopped
+type UsageSampler struct {
+	kubeAccess  KubeAccess
+	namingCfg   NamingConfig
+	controllers map[string][]controllerPods
+	warned      map[string]bool
+
+	sync.Mutex
+	samples []UsageSample
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// StartUsageSampling samples the resource usage of the pods of the
+// controller deployments and of the nodes using the metrics.k8s.io API,
+// which requires the metrics server to be installed in the cluster, the
+// active buildruns are counted in the namespaces of the naming config
+func StartUsageSampling(kubeAccess KubeAccess, namingCfg NamingConfig, endpoints []MetricsEndpoint, interval time.Duration) *UsageSampler {
+	controllers, err := lookUpControllers(kubeAccess, endpoints)
+	if err != nil {
+		warn("unable to look up the controller deployments, only the nodes are sampled: %v", err)
+	}
+
+	var sampler = &UsageSampler{
+		kubeAccess:  kubeAccess,
+		namingCfg:   namingCfg,
+		controllers: controllers,
+		warned:      map[string]bool{},
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	go func() {
+		defer close(sampler.done)
+
+		var ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			sampler.sample()
+
+			select {
+			case <-ticker.C:
+			case <-sampler.stop:
+				return
+			case <-kubeAccess.Context.Done():
+				return
+			}
+		}
+	}()
+
+	return sampler
+}
+
+// Stop ends the sampling and returns all samples
+func (sampler *UsageSampler) Stop() []UsageSample {
+	close(sampler.stop)
+	<-sampler.done
+
+	sampler.Lock()
+	defer sampler.Unlock()
+	return sampler.samples
+}
+
+func (sampler *UsageSampler) sample() {
+	var sample = UsageSample{
+		Time:        time.Now(),
+		Controllers: map[string]corev1.ResourceList{},
+		Nodes:       map[string]corev1.ResourceList{},
+	}
+
+	if activeBuildRuns, err := sampler.activeBuildRuns(); err == nil {
+		sample.ActiveBuildRuns = &activeBuildRuns
+	} else {
+		sampler.warnOnce("buildruns", "unable to look up the active buildruns: %v", err)
+	}
+
+	var names = make([]string, 0, len(sampler.controllers))
+	for name := range sampler.controllers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, controller := range sampler.controllers[name] {
+			list, err := sampler.metrics(fmt.Sprintf("%s/namespaces/%s/pods", metricsAPIPath, controller.namespace), controller.selector)
+			if err != nil {
+				sampler.warnOnce(name, "unable to sample the resource usage of %s: %v", name, err)
+				continue
+			}
+
+			for _, item := range list.Items {
+				var usage = corev1.ResourceList{}
+				for _, container := range item.Containers {
+					for resourceName, quantity := range container.Usage {
+						var sum = usage[resourceName]
+						sum.Add(quantity)
+						usage[resourceName] = sum
+					}
+				}
+
+				sample.Controllers[fmt.Sprintf("%s %s", name, item.Metadata.Name)] = usage
+			}
+		}
+	}
+
+	if list, err := sampler.metrics(metricsAPIPath+"/nodes", ""); err == nil {
+		for _, item := range list.Items {
+			sample.Nodes[item.Metadata.Name] = item.Usage
+		}
+	} else {
+		sampler.warnOnce("nodes", "unable to sample the resource usage of the nodes: %v", err)
+	}
+
+	sampler.Lock()
+	defer sampler.Unlock()
+	sampler.samples = append(sampler.samples, sample)
+}
+
+// activeBuildRuns counts the buildruns of this run that did not complete,
+// which are the ones with the name prefix in the namespaces of the run
+func (sampler *UsageSampler) activeBuildRuns() (int, error) {
+	var namespaces = sampler.namingCfg.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{sampler.namingCfg.Namespace}
+	}
+
+	var count int
+	for _, namespace := range namespaces {
+		buildRuns, err := listBuildRuns(sampler.kubeAccess, namespace)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, buildRun := range buildRuns {
+			if strings.HasPrefix(buildRun.Name, sampler.namingCfg.Prefix+"-") && buildRun.Status.CompletionTime == nil {
+				count++
+			}
+		}
+	}
+
+	return count, nil
+}
+
+func (sampler *UsageSampler) metrics(path string, labelSelector string) (*metricsList, error) {
+	var request = sampler.kubeAccess.Client.CoreV1().RESTClient().Get().AbsPath(path)
+	if labelSelector != "" {
+		request = request.Param("labelSelector", labelSelector)
+	}
+
+	data, err := request.DoRaw(sampler.kubeAccess.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	var list metricsList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// warnOnce warns about a failed sample only once, so that a missing metrics
+// server does not flood the output
+func (sampler *UsageSampler) warnOnce(key string, format string, a ...interface{}) {
+	if !sampler.warned[key] {
+		sampler.warned[key] = true
+		warn(format, a...)
+	}
+}
+
+// usagePeak is the highest usage of a pod or node during the run
+type usagePeak struct {
+	name            string
+	cpu             float64
+	memory          int64
+	activeBuildRuns *int
+}
+
+func usagePeaks(samples []UsageSample, selectUsage func(UsageSample) map[string]corev1.ResourceList) []usagePeak {
+	var peaks = map[string]*usagePeak{}
+	for _, sample := range samples {
+		for name, usage := range selectUsage(sample) {
+			peak, ok := peaks[name]
+			if !ok {
+				peak = &usagePeak{name: name}
+				peaks[name] = peak
+			}
+
+			if cpu := usage.Cpu().AsApproximateFloat64(); cpu > peak.cpu {
+				peak.cpu, peak.activeBuildRuns = cpu, sample.ActiveBuildRuns
+			}
+
+			if memory := usage.Memory().Value(); memory > peak.memory {
+				peak.memory = memory
+			}
+		}
+	}
+
+	var result = make([]usagePeak, 0, len(peaks))
+	for _, peak := range peaks {
+		result = append(result, *peak)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result
+}
+
+// UsageReport renders the peak CPU and memory usage of the controller pods
+// and nodes, and the number of active buildruns at the time of the CPU peak
+func UsageReport(samples []UsageSample) string {
+	if len(samples) == 0 {
+		return "No resource usage samples.\n"
+	}
+
+	var tableData = [][]string{
+		{
+			bunt.Sprintf("*Pod or node*"),
+			bunt.Sprintf("*Peak CPU*"),
+			bunt.Sprintf("*Active buildruns at CPU peak*"),
+			bunt.Sprintf("*Peak memory*"),
+		},
+	}
+
+	var peakLoad = "unknown"
+	var maxActiveBuildRuns = -1
+	for _, sample := range samples {
+		if sample.ActiveBuildRuns != nil && *sample.ActiveBuildRuns > maxActiveBuildRuns {
+			maxActiveBuildRuns = *sample.ActiveBuildRuns
+			peakLoad = strconv.Itoa(maxActiveBuildRuns)
+		}
+	}
+
+	for _, selectUsage := range []func(UsageSample) map[string]corev1.ResourceList{
+		func(sample UsageSample) map[string]corev1.ResourceList { return sample.Controllers },
+		func(sample UsageSample) map[string]corev1.ResourceList { return sample.Nodes },
+	} {
+		for _, peak := range usagePeaks(samples, selectUsage) {
+			var memory = humanReadableMemory(resource.NewQuantity(peak.memory, resource.BinarySI))
+			tableData = append(tableData, []string{
+				peak.name,
+				fmt.Sprintf("%.3f", peak.cpu),
+				activeBuildRuns(peak.activeBuildRuns),
+				memory,
+			})
+		}
+	}
+
+	table, err := neat.Table(tableData, neat.AlignRight(1, 2, 3), neat.CustomSeparator(bunt.Sprintf(" DimGray{│} ")))
+	if err != nil {
+		panic(err)
+	}
+
+	return bunt.Sprintf("Resource usage during the run (%d samples, at most %s active buildruns):\n%s\n", len(samples), peakLoad, table)
+}
+
+func activeBuildRuns(count *int) string {
+	if count == nil {
+		return "unknown"
+	}
+
+	return strconv.Itoa(*count)
+}
@@ -0,0 +1,187 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gonvenience/bunt"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+
+	shipwrightBuild "github.com/shipwright-io/build/pkg/apis/build/v1alpha1"
+	buildfake "github.com/shipwright-io/build/pkg/client/clientset/versioned/fake"
+)
+
+var _ = Describe("resource usage", func() {
+	var usage = func(cpu string, memory string) corev1.ResourceList {
+		return corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		}
+	}
+
+	var start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var samples = []UsageSample{
+		{
+			Time:            start,
+			ActiveBuildRuns: p(2),
+			Controllers:     map[string]corev1.ResourceList{"Shipwright shipwright-build-controller-1": usage("100m", "64Mi")},
+			Nodes:           map[string]corev1.ResourceList{"node-1": usage("1", "4Gi")},
+		},
+		{
+			Time:            start.Add(10 * time.Second),
+			ActiveBuildRuns: p(8),
+			Controllers:     map[string]corev1.ResourceList{"Shipwright shipwright-build-controller-1": usage("400m", "96Mi")},
+			Nodes:           map[string]corev1.ResourceList{"node-1": usage("3500m", "6Gi")},
+		},
+		{
+			Time:            start.Add(20 * time.Second),
+			ActiveBuildRuns: p(1),
+			Controllers:     map[string]corev1.ResourceList{"Shipwright shipwright-build-controller-1": usage("50m", "128Mi")},
+			Nodes:           map[string]corev1.ResourceList{"node-1": usage("500m", "5Gi")},
+		},
+	}
+
+	BeforeEach(func() {
+		bunt.SetColorSettings(bunt.OFF, bunt.OFF)
+	})
+
+	AfterEach(func() {
+		bunt.SetColorSettings(bunt.AUTO, bunt.AUTO)
+	})
+
+	It("should report the peak usage and the load at the CPU peak", func() {
+		report := UsageReport(samples)
+		Expect(report).To(ContainSubstring("3 samples, at most 8 active buildruns"))
+		Expect(report).To(MatchRegexp(`Shipwright shipwright-build-controller-1\s+│\s+0\.400\s+│\s+8\s+│\s+128\.0 MiB`))
+		Expect(report).To(MatchRegexp(`node-1\s+│\s+3\.500\s+│\s+8\s+│\s+6\.0 GiB`))
+	})
+
+	It("should plot the usage with the load overlaid in the HTML report", func() {
+		var buf bytes.Buffer
+		Expect(CreateBuildrunResultsChartJS([]Result{}, &buf, WithResourceUsage(samples))).To(Succeed())
+		Expect(buf.String()).To(ContainSubstring(`<canvas id="usageChart3"></canvas>`))
+		Expect(buf.String()).To(ContainSubstring(`"label":"active buildruns"`))
+		Expect(buf.String()).To(ContainSubstring(`"data":[2,8,1]`))
+		Expect(buf.String()).To(ContainSubstring(`"data":[0.1,0.4,0.05]`))
+	})
+
+	It("should report the load as unknown in case the buildruns could not be listed", func() {
+		var unknown = []UsageSample{
+			{
+				Time:        start,
+				Controllers: map[string]corev1.ResourceList{},
+				Nodes:       map[string]corev1.ResourceList{"node-1": usage("1", "4Gi")},
+			},
+			{
+				Time:            start.Add(10 * time.Second),
+				ActiveBuildRuns: p(3),
+				Controllers:     map[string]corev1.ResourceList{},
+				Nodes:           map[string]corev1.ResourceList{"node-1": usage("500m", "4Gi")},
+			},
+		}
+
+		report := UsageReport(unknown)
+		Expect(report).To(ContainSubstring("2 samples, at most 3 active buildruns"))
+		Expect(report).To(MatchRegexp(`node-1\s+│\s+1\.000\s+│\s+unknown\s+│`))
+
+		var buf bytes.Buffer
+		Expect(CreateBuildrunResultsChartJS([]Result{}, &buf, WithResourceUsage(unknown))).To(Succeed())
+		Expect(buf.String()).To(ContainSubstring(`"data":[null,3]`))
+	})
+
+	Context("sampling", func() {
+		var server *httptest.Server
+		var kubeAccess KubeAccess
+
+		var buildRun = func(namespace string, name string, completed bool) *shipwrightBuild.BuildRun {
+			var buildRun = &shipwrightBuild.BuildRun{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+			if completed {
+				buildRun.Status.CompletionTime = &metav1.Time{Time: start}
+			}
+
+			return buildRun
+		}
+
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/apis/metrics.k8s.io/v1beta1/nodes":
+					_, _ = w.Write([]byte(`{"items":[{"metadata":{"name":"node-1"},"usage":{"cpu":"1","memory":"4Gi"}}]}`))
+
+				default:
+					w.WriteHeader(http.StatusNotFound)
+					_, _ = w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","code":404}`))
+				}
+			}))
+
+			client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+			Expect(err).ToNot(HaveOccurred())
+
+			kubeAccess = KubeAccess{
+				Context: context.Background(),
+				Client:  client,
+				BuildClient: buildfake.NewSimpleClientset(
+					buildRun("ns-a", "test-kaniko-1-1", false),
+					buildRun("ns-a", "test-kaniko-2-1", true),
+					buildRun("ns-b", "test-kaniko-3-1", false),
+					buildRun("ns-a", "other-kaniko-1-1", false),
+					buildRun("ns-c", "test-kaniko-4-1", false),
+				),
+			}
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should only count the active buildruns of the run", func() {
+			samples := StartUsageSampling(kubeAccess, NamingConfig{Namespaces: []string{"ns-a", "ns-b"}, Prefix: "test"}, nil, time.Hour).Stop()
+			Expect(samples).ToNot(BeEmpty())
+			Expect(samples[0].ActiveBuildRuns).To(Equal(p(2)))
+			Expect(samples[0].Nodes).To(HaveKey("node-1"))
+		})
+
+		It("should leave the load unknown in case the buildruns cannot be listed", func() {
+			kubeAccess.BuildClient.(*buildfake.Clientset).PrependReactor("list", "buildruns", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, fmt.Errorf("etcdserver: request timed out")
+			})
+
+			samples := StartUsageSampling(kubeAccess, NamingConfig{Namespace: "ns-a", Prefix: "test"}, nil, time.Hour).Stop()
+			Expect(samples).ToNot(BeEmpty())
+			Expect(samples[0].ActiveBuildRuns).To(BeNil())
+			Expect(samples[0].Nodes).To(HaveKey("node-1"))
+		})
+	})
+})
@@ -0,0 +1,249 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Workload is one type of buildrun in a mixed workload, the weight defines
+// its share of all buildruns
+type Workload struct {
+	Name        string `yaml:"name"`
+	Weight      int    `yaml:"weight"`
+	BuildConfig `yaml:",inline"`
+}
+
+// WorkloadResults contains the results of all buildruns of one workload
+type WorkloadResults struct {
+	Name    string
+	Results []Result
+}
+
+// NewWorkloads reads the workloads of a mixed workload scenario, each
+// workload is based on the provided defaults
+func NewWorkloads(in io.Reader, defaults BuildConfig) ([]Workload, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode once with strict field checks, and then once more per workload
+	// on top of the defaults, since a strict decoder always creates new
+	// list entries
+	var strict struct {
+		Workloads []Workload `yaml:"workloads"`
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&strict); err != nil {
+		return nil, fmt.Errorf("failed to read workloads: %w", err)
+	}
+
+	var scenario struct {
+		Workloads []yaml.Node `yaml:"workloads"`
+	}
+
+	if err := yaml.Unmarshal(data, &scenario); err != nil {
+		return nil, err
+	}
+
+	var (
+		workloads = make([]Workload, len(scenario.Workloads))
+		names     = map[string]struct{}{}
+	)
+
+	for i, node := range scenario.Workloads {
+		workloads[i] = Workload{Weight: 1, BuildConfig: defaults}
+		if err := node.Decode(&workloads[i]); err != nil {
+			return nil, err
+		}
+
+		var workload = workloads[i]
+		switch {
+		case len(workload.Name) == 0:
+			return nil, fmt.Errorf("workload in line %d has no name", node.Line)
+
+		case len(validation.IsDNS1123Label(workload.Name)) > 0:
+			// the name becomes part of the names of the created objects
+			return nil, fmt.Errorf("workload name %s in line %d is invalid: %s", workload.Name, node.Line, strings.Join(validation.IsDNS1123Label(workload.Name), ", "))
+
+		case workload.Weight < 1:
+			return nil, fmt.Errorf("workload %s needs to have a weight of at least one", workload.Name)
+
+		case len(workload.ClusterBuildStrategy) == 0 && len(workload.BuildStrategy) == 0:
+			return nil, fmt.Errorf("workload %s has no build strategy", workload.Name)
+
+		case len(workload.ClusterBuildStrategy) > 0 && len(workload.BuildStrategy) > 0:
+			return nil, fmt.Errorf("workload %s has both a build strategy and a cluster build strategy", workload.Name)
+
+		case len(workload.SourceURL) == 0:
+			return nil, fmt.Errorf("workload %s has no source URL", workload.Name)
+
+		case len(workload.OutputImageURL) == 0:
+			return nil, fmt.Errorf("workload %s has no output image URL", workload.Name)
+		}
+
+		if _, ok := names[workload.Name]; ok {
+			return nil, fmt.Errorf("workload name %s is used more than once", workload.Name)
+		}
+
+		names[workload.Name] = struct{}{}
+	}
+
+	if len(workloads) == 0 {
+		return nil, fmt.Errorf("no workloads defined")
+	}
+
+	return workloads, nil
+}
+
+// DistributeBuildRuns splits the total number of buildruns across the
+// workloads according to their weights using the largest remainder method
+func DistributeBuildRuns(workloads []Workload, total int) []int {
+	var sum int
+	for _, workload := range workloads {
+		sum += workload.Weight
+	}
+
+	var (
+		counts     = make([]int, len(workloads))
+		remainders = make([]int, len(workloads))
+		order      = make([]int, len(workloads))
+		assigned   int
+	)
+
+	for i, workload := range workloads {
+		counts[i] = total * workload.Weight / sum
+		remainders[i] = total * workload.Weight % sum
+		order[i] = i
+		assigned += counts[i]
+	}
+
+	sort.SliceStable(order, func(i, j int) bool { return remainders[order[i]] > remainders[order[j]] })
+	for i := 0; assigned < total; i++ {
+		counts[order[i%len(order)]]++
+		assigned++
+	}
+
+	return counts
+}
+
+// CheckWorkloads sanity checks the cluster for a mixed workload, like
+// CheckSystemAndConfig does for a single type of buildruns
+func CheckWorkloads(kubeAccess KubeAccess, namingCfg NamingConfig, workloads []Workload, parallel int) error {
+	if err := checkPermissions(kubeAccess, namingCfg); err != nil {
+		return err
+	}
+
+	var demands = []podDemand{}
+	for i, count := range DistributeBuildRuns(workloads, parallel) {
+		buildStrategy, err := lookUpBuildStrategy(kubeAccess, namingCfg.Namespace, workloads[i].BuildConfig)
+		if err != nil {
+			return fmt.Errorf("workload %s: %w", workloads[i].Name, err)
+		}
+
+		if err := checkCredentials(kubeAccess, namingCfg.Namespace, workloads[i].BuildConfig); err != nil {
+			return fmt.Errorf("workload %s: %w", workloads[i].Name, err)
+		}
+
+		if buildStrategy != nil && count > 0 {
+			demands = append(demands, newPodDemand(lookUpResourceEstimate(kubeAccess, namingCfg.Namespace, buildStrategy), count, buildStrategy.GetName(), workloads[i].BuildConfig))
+		}
+	}
+
+	checkExistingBuildRuns(kubeAccess)
+
+	if len(demands) > 0 {
+		if err := checkNamespacePolicies(kubeAccess, namingCfg, demands); err != nil {
+			return err
+		}
+
+		return checkResources(kubeAccess, demands)
+	}
+
+	return nil
+}
+
+// ExecuteMixedBuildRuns executes the given total number of buildruns in
+// parallel, split across the workloads according to their weights, in case
+// of errors, the results of the buildruns that did complete are returned
+// alongside the error
+func ExecuteMixedBuildRuns(kubeAccess KubeAccess, namingCfg NamingConfig, workloads []Workload, parallel int) ([]WorkloadResults, error) {
+	var counts = DistributeBuildRuns(workloads, parallel)
+
+	var errors = make(chan error, len(workloads))
+	var wg sync.WaitGroup
+	wg.Add(len(workloads))
+
+	var workloadResults = make([]WorkloadResults, len(workloads))
+	for i, workload := range workloads {
+		workloadResults[i].Name = workload.Name
+
+		go func(idx int, workload Workload) {
+			defer wg.Done()
+
+			if counts[idx] == 0 {
+				warn("workload %s gets no buildruns with its weight and a total of %d buildruns", workload.Name, parallel)
+				return
+			}
+
+			// the workload name is part of the prefix, so that workloads
+			// using the same build strategy do not share the same names
+			var workloadNamingCfg = namingCfg
+			workloadNamingCfg.Prefix = fmt.Sprintf("%s-%s", namingCfg.Prefix, workload.Name)
+
+			results, err := ExecuteParallelBuildRuns(kubeAccess, workloadNamingCfg, workload.BuildConfig, counts[idx])
+			if err != nil {
+				errors <- fmt.Errorf("workload %s: %w", workload.Name, err)
+			}
+
+			workloadResults[idx].Results = results
+		}(i, workload)
+	}
+
+	wg.Wait()
+	close(errors)
+
+	var completed = []WorkloadResults{}
+	for _, workloadResult := range workloadResults {
+		if len(workloadResult.Results) > 0 {
+			completed = append(completed, workloadResult)
+		}
+	}
+
+	return completed, wrapErrorChanResults(errors, "failed to execute mixed workload")
+}
+
+// CombinedResults returns the results of all workloads in one list
+func CombinedResults(workloadResults []WorkloadResults) []Result {
+	var results = []Result{}
+	for _, workloadResult := range workloadResults {
+		results = append(results, workloadResult.Results...)
+	}
+
+	return results
+}
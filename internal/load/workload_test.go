@@ -0,0 +1,136 @@
+/*
+Copyright © 2020 The Homeport Team
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package load_test
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/homeport/build-load/internal/load"
+)
+
+var _ = Describe("mixed workloads", func() {
+	var defaults = BuildConfig{
+		ServiceAccountName: "generated",
+		SourceContextDir:   "/",
+		SourceRevision:     "master",
+		SourceDockerfile:   "Dockerfile",
+		OutputImageURL:     "docker.io/boatyard",
+	}
+
+	Context("reading a scenario", func() {
+		It("should apply the defaults to settings not configured in the workload", func() {
+			workloads, err := NewWorkloads(strings.NewReader(`---
+workloads:
+- name: node
+  weight: 6
+  clusterBuildStrategy: buildpacks-v3
+  sourceURL: https://github.com/shipwright-io/sample-nodejs
+  sourceContextDir: source-build
+- name: go
+  clusterBuildStrategy: kaniko
+  sourceURL: https://github.com/shipwright-io/sample-go
+  timeout: 10m
+`), defaults)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(workloads).To(HaveLen(2))
+
+			Expect(workloads[0].Name).To(Equal("node"))
+			Expect(workloads[0].Weight).To(Equal(6))
+			Expect(workloads[0].ClusterBuildStrategy).To(Equal("buildpacks-v3"))
+			Expect(workloads[0].SourceContextDir).To(Equal("source-build"))
+			Expect(workloads[0].SourceRevision).To(Equal("master"))
+			Expect(workloads[0].OutputImageURL).To(Equal("docker.io/boatyard"))
+
+			Expect(workloads[1].Weight).To(Equal(1))
+			Expect(workloads[1].SourceContextDir).To(Equal("/"))
+			Expect(workloads[1].Timeout).To(Equal(10 * time.Minute))
+		})
+
+		It("should reject unknown fields", func() {
+			_, err := NewWorkloads(strings.NewReader(`---
+workloads:
+- name: node
+  clusterBuildStrategy: buildpacks-v3
+  sourceUrl: https://github.com/shipwright-io/sample-nodejs
+`), defaults)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("sourceUrl"))
+		})
+
+		It("should reject invalid workloads", func() {
+			for input, message := range map[string]string{
+				"workloads: []": "no workloads defined",
+				"workloads: [{clusterBuildStrategy: kaniko, sourceURL: foo}]":                                                                   "has no name",
+				"workloads: [{name: Node_JS, clusterBuildStrategy: kaniko, sourceURL: foo}]":                                                    "workload name Node_JS in line 1 is invalid",
+				"workloads: [{name: a, sourceURL: foo}]":                                                                                        "workload a has no build strategy",
+				"workloads: [{name: a, weight: 0, clusterBuildStrategy: kaniko}]":                                                               "workload a needs to have a weight of at least one",
+				"workloads: [{name: a, clusterBuildStrategy: kaniko}]":                                                                          "workload a has no source URL",
+				"workloads: [{name: a, buildStrategy: a, clusterBuildStrategy: kaniko}]":                                                        "workload a has both a build strategy and a cluster build strategy",
+				"workloads: [{name: a, clusterBuildStrategy: kaniko, sourceURL: foo}, {name: a, clusterBuildStrategy: kaniko, sourceURL: bar}]": "workload name a is used more than once",
+			} {
+				_, err := NewWorkloads(strings.NewReader(input), defaults)
+				Expect(err).To(HaveOccurred(), input)
+				Expect(err.Error()).To(ContainSubstring(message), input)
+			}
+		})
+	})
+
+	Context("distributing buildruns", func() {
+		var weighted = func(weights ...int) []Workload {
+			var workloads = make([]Workload, len(weights))
+			for i, weight := range weights {
+				workloads[i] = Workload{Weight: weight}
+			}
+
+			return workloads
+		}
+
+		It("should split the buildruns according to the weights", func() {
+			Expect(DistributeBuildRuns(weighted(6, 3, 1), 10)).To(Equal([]int{6, 3, 1}))
+			Expect(DistributeBuildRuns(weighted(6, 3, 1), 20)).To(Equal([]int{12, 6, 2}))
+		})
+
+		It("should assign the remaining buildruns to the largest remainders", func() {
+			Expect(DistributeBuildRuns(weighted(6, 3, 1), 5)).To(Equal([]int{3, 2, 0}))
+			Expect(DistributeBuildRuns(weighted(1, 1, 1), 4)).To(Equal([]int{2, 1, 1}))
+			Expect(DistributeBuildRuns(weighted(1, 1, 1), 2)).To(Equal([]int{1, 1, 0}))
+		})
+	})
+
+	Context("reports", func() {
+		It("should group the CSV results by workload", func() {
+			var buf bytes.Buffer
+			Expect(CreateWorkloadResultsCSV([]WorkloadResults{
+				{Name: "node", Results: []Result{{Value{MockLabel1, time.Second}}}},
+				{Name: "go", Results: []Result{{Value{MockLabel1, 2 * time.Second}}, {Value{MockLabel1, 3 * time.Second}}}},
+			}, &buf)).To(Succeed())
+
+			Expect(buf.String()).To(Equal(`workload, buildrun, mock #1
+node    , 1       , 1000
+go      , 1       , 2000
+go      , 2       , 3000
+`))
+		})
+	})
+})